@@ -6,3 +6,6 @@ CREATE TABLE abi (
     UNIQUE KEY(abi_id)
 );
 -- +goose StatementEnd
+
+-- +goose Down
+DROP TABLE abi;
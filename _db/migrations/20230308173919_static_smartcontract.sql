@@ -10,4 +10,7 @@ CREATE TABLE smartcontract (
 	block_timestamp bigint unsigned NOT NULL, 
     CONSTRAINT smartcontract_id PRIMARY KEY (network_id, address),
     FOREIGN KEY (abi_id) REFERENCES abi(abi_id) 
-);
\ No newline at end of file
+);
+
+-- +goose Down
+DROP TABLE smartcontract;
@@ -9,3 +9,6 @@ CREATE TABLE configuration (
     PRIMARY KEY (organization, project, network_id, group_name, smartcontract_name),
     CONSTRAINT smartcontract_id FOREIGN KEY (network_id, address) REFERENCES smartcontract(network_id, address) 
 );
+
+-- +goose Down
+DROP TABLE configuration;
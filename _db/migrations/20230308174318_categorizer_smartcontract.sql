@@ -6,3 +6,6 @@ CREATE TABLE indexer_smartcontract (
     block_timestamp bigint UNSIGNED,
     CONSTRAINT smartcontract_id PRIMARY KEY (network_id, address)
 );
+
+-- +goose Down
+DROP TABLE indexer_smartcontract;
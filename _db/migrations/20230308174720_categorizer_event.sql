@@ -13,3 +13,6 @@ CREATE TABLE indexer_event (
     INDEX (block_number, block_timestamp, event_name),
     FOREIGN KEY (network_id, address) REFERENCES indexer_smartcontract(network_id, address) 
 );
+
+-- +goose Down
+DROP TABLE indexer_event;
@@ -1,2 +1,10 @@
 -- +goose Up
 ALTER TABLE configuration MODIFY group_name varchar(127);
+
+-- +goose Down
+-- The group names that are not the smallint numbers can not be converted back.
+-- The strict mode makes the migration fail, instead of silently losing them.
+SET @sds_sql_mode = @@SESSION.sql_mode;
+SET SESSION sql_mode = CONCAT(@@SESSION.sql_mode, ',STRICT_ALL_TABLES');
+ALTER TABLE configuration MODIFY group_name smallint unsigned;
+SET SESSION sql_mode = @sds_sql_mode;
@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE audit_log (
+    audit_id bigint unsigned NOT NULL AUTO_INCREMENT,
+    command varchar(31) NOT NULL,
+    table_names varchar(255) NOT NULL,
+    fields json,
+    where_clause text,
+    arguments json,
+    rows_affected bigint unsigned NOT NULL,
+    service varchar(255) NOT NULL,
+    created_at datetime(6) NOT NULL,
+    PRIMARY KEY (audit_id),
+    INDEX (table_names, created_at),
+    INDEX (service, created_at)
+);
+
+-- +goose Down
+DROP TABLE audit_log;
@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE queue_job (
+    job_id bigint unsigned NOT NULL AUTO_INCREMENT,
+    queue varchar(127) NOT NULL,
+    payload json NOT NULL,
+    status varchar(15) NOT NULL,
+    attempts int unsigned NOT NULL DEFAULT 0,
+    max_attempts int unsigned NOT NULL,
+    visible_at datetime(6) NOT NULL,
+    claimed_by varchar(255),
+    claim_token char(32),
+    last_error text,
+    created_at datetime(6) NOT NULL,
+    updated_at datetime(6) NOT NULL,
+    PRIMARY KEY (job_id),
+    INDEX (queue, status, visible_at)
+);
+
+-- +goose Down
+DROP TABLE queue_job;
@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE outbox (
+    outbox_id bigint unsigned NOT NULL AUTO_INCREMENT,
+    topic varchar(255) NOT NULL,
+    payload json NOT NULL,
+    service varchar(255) NOT NULL,
+    created_at datetime(6) NOT NULL,
+    delivered_at datetime(6),
+    PRIMARY KEY (outbox_id),
+    INDEX (delivered_at, outbox_id)
+);
+
+-- +goose Down
+DROP TABLE outbox;
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Seascape-Foundation/mysql-seascape-extension/handler"
+	"github.com/Seascape-Foundation/sds-common-lib/data_type/key_value"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/command"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/message"
+	"github.com/Seascape-Foundation/sds-service-lib/configuration"
+	"github.com/Seascape-Foundation/sds-service-lib/log"
+	"github.com/Seascape-Foundation/sds-service-lib/remote"
+)
+
+// AnyService is the identity in the access rule that matches the services without their own rule
+const AnyService = "*"
+
+// TableAccess lists the columns of the table that the service can use.
+// If the Columns are empty, then all columns are allowed.
+type TableAccess struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns,omitempty"`
+}
+
+// AccessRule is the list of commands and tables allowed for the service.
+//
+// The Service is the curve public key of the service, Anonymous or AnyService.
+// If the Tables are empty, then the commands are allowed on any table.
+type AccessRule struct {
+	Service  string        `json:"service"`
+	Commands []string      `json:"commands"`
+	Tables   []TableAccess `json:"tables,omitempty"`
+}
+
+// accessList keeps the access rules of the client services defined in the "Access" section of seascape.yml.
+// If the section is omitted, then all services have full access.
+type accessList struct {
+	enabled bool
+	rules   map[string]AccessRule
+}
+
+// newAccessList reads the access rules from the seascape.yml.
+//
+// Example:
+//
+//	Access:
+//	  - Service: "anonymous"
+//	    Commands: ["select", "select-row", "exist"]
+//	    Tables:
+//	      - Name: "abi"
+//	        Columns: ["abi_id", "body"]
+func newAccessList(appConfig *configuration.Config, logger log.Logger) (*accessList, error) {
+	list := &accessList{rules: make(map[string]AccessRule)}
+
+	raw := appConfig.Engine().Get("access")
+	if raw == nil {
+		logger.Warn("the 'Access' section is missing in seascape.yml, any client has access to any table")
+		return list, nil
+	}
+
+	kv, err := key_value.NewFromInterface(map[string]interface{}{"rules": raw})
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert the 'Access' section into key-value: %w", err)
+	}
+	var parsed struct {
+		Rules []AccessRule `json:"rules"`
+	}
+	if err := kv.Interface(&parsed); err != nil {
+		return nil, fmt.Errorf("the 'Access' section should be the list of rules: %w", err)
+	}
+
+	for _, rule := range parsed.Rules {
+		if len(rule.Service) == 0 {
+			return nil, fmt.Errorf("the access rule %v is missing the Service", rule)
+		}
+		if _, ok := list.rules[rule.Service]; ok {
+			return nil, fmt.Errorf("the access rule for '%s' service is duplicated", rule.Service)
+		}
+		list.rules[rule.Service] = rule
+	}
+	list.enabled = true
+
+	return list, nil
+}
+
+// check returns an error if the service is not allowed to execute the command with the given query parameters.
+func (list *accessList) check(service string, name command.Name, parameters handler.DatabaseQueryRequest) error {
+	if !list.enabled {
+		return nil
+	}
+
+	rule, ok := list.rule(service)
+	if !ok {
+		return fmt.Errorf("no access rule for the service")
+	}
+
+	if !contains(rule.Commands, name.String()) {
+		return fmt.Errorf("'%s' command is not allowed", name)
+	}
+	// the operations, the json patches and the expectation are compiled by UPDATE only
+	if name != handler.UPDATE && (len(parameters.Operations) > 0 || len(parameters.JsonPatches) > 0 || parameters.Expect != nil) {
+		return fmt.Errorf("the operations, the json patches and the expectation are allowed in '%s' only", handler.UPDATE)
+	}
+	// the expressions could read any column or table, for example by the subquery
+	for _, field := range parameters.Fields {
+		if !handler.IsColumn(field) {
+			return fmt.Errorf("'%s' field is not a column, the expressions are not allowed", field)
+		}
+	}
+	// the subqueries and the functions of the conditions are rejected even if any table is allowed
+	if _, err := handler.ConditionColumns(parameters.Where); err != nil {
+		return fmt.Errorf("where: %w", err)
+	}
+	if len(rule.Tables) == 0 {
+		return nil
+	}
+
+	tables := make(map[string]TableAccess, len(parameters.Tables))
+	for _, table := range parameters.Tables {
+		access, ok := rule.table(table)
+		if !ok {
+			return fmt.Errorf("'%s' table is not allowed", table)
+		}
+		tables[table] = access
+	}
+	// the columns of the joined tables are qualified by the alias
+	for _, join := range parameters.Joins {
+		access, ok := rule.table(join.Table)
+		if !ok {
+			return fmt.Errorf("'%s' table is not allowed", join.Table)
+		}
+		tables[join.Name()] = access
+	}
+
+	// the fields of the operations, the aggregations, the groups and the expectation
+	columns := make([]string, 0, len(parameters.Operations)+len(parameters.Aggregations)+len(parameters.GroupBy)+1)
+	for _, operation := range parameters.Operations {
+		columns = append(columns, operation.Field)
+	}
+	for _, aggregation := range parameters.Aggregations {
+		// COUNT(*) counts the rows without reading the columns
+		if len(aggregation.Column) > 0 && aggregation.Column != "*" {
+			columns = append(columns, aggregation.Column)
+		}
+	}
+	columns = append(columns, parameters.GroupBy...)
+	if parameters.Expect != nil {
+		columns = append(columns, parameters.Expect.Column)
+	}
+	for _, field := range columns {
+		if !columnAllowed(tables, field) {
+			return fmt.Errorf("'%s' field is not allowed", field)
+		}
+	}
+	if err := jsonColumnsAllowed(tables, parameters); err != nil {
+		return err
+	}
+	if err := conditionAllowed(tables, parameters); err != nil {
+		return err
+	}
+
+	if len(parameters.Fields) == 0 {
+		// the update sets only the columns of the operations and the json patches
+		if name == handler.UPDATE && (len(parameters.Operations) > 0 || len(parameters.JsonPatches) > 0) {
+			return nil
+		}
+		// the aggregate reads only the columns of the aggregations and the groups
+		if name == handler.AGGREGATE {
+			return nil
+		}
+		for table, access := range tables {
+			if len(access.Columns) > 0 {
+				return fmt.Errorf("only some columns of '%s' table are allowed, list the Fields", table)
+			}
+		}
+		return nil
+	}
+	for _, field := range parameters.Fields {
+		if !columnAllowed(tables, field) {
+			return fmt.Errorf("'%s' field is not allowed", field)
+		}
+	}
+
+	return nil
+}
+
+// jsonColumnsAllowed returns an error if the json patches or the json filters
+// use the column that is not allowed.
+func jsonColumnsAllowed(tables map[string]TableAccess, parameters handler.DatabaseQueryRequest) error {
+	for _, patch := range parameters.JsonPatches {
+		if !columnAllowed(tables, patch.Column) {
+			return fmt.Errorf("'%s' json column is not allowed", patch.Column)
+		}
+	}
+	for _, filter := range parameters.JsonFilters {
+		if !columnAllowed(tables, filter.Column) {
+			return fmt.Errorf("'%s' json column is not allowed", filter.Column)
+		}
+	}
+	return nil
+}
+
+// conditionAllowed returns an error if the Where, the ORDER BY or the join conditions
+// use the column that is not allowed.
+func conditionAllowed(tables map[string]TableAccess, parameters handler.DatabaseQueryRequest) error {
+	columns, err := handler.ConditionColumns(parameters.Where)
+	if err != nil {
+		return fmt.Errorf("where: %w", err)
+	}
+	for _, order := range parameters.OrderBy {
+		if parts := strings.Fields(order); len(parts) > 0 {
+			columns = append(columns, parts[0])
+		}
+	}
+	for _, join := range parameters.Joins {
+		for _, on := range join.On {
+			columns = append(columns, on.Left, on.Right)
+		}
+	}
+
+	for _, column := range columns {
+		if !columnAllowed(tables, column) {
+			return fmt.Errorf("'%s' column is not allowed in the conditions", column)
+		}
+	}
+	return nil
+}
+
+// rule returns the access rule of the service.
+// If the service has no own rule, then returns the rule of AnyService.
+func (list *accessList) rule(service string) (AccessRule, bool) {
+	rule, ok := list.rules[service]
+	if !ok {
+		rule, ok = list.rules[AnyService]
+	}
+	return rule, ok
+}
+
+// tableVisible returns true if the service can execute the command on the table.
+func (list *accessList) tableVisible(service string, name command.Name, table string) bool {
+	if !list.enabled {
+		return true
+	}
+
+	rule, ok := list.rule(service)
+	if !ok || !contains(rule.Commands, name.String()) {
+		return false
+	}
+	if len(rule.Tables) == 0 {
+		return true
+	}
+	_, ok = rule.table(table)
+	return ok
+}
+
+// table returns the access to the table
+func (rule AccessRule) table(name string) (TableAccess, bool) {
+	for _, table := range rule.Tables {
+		if table.Name == name {
+			return table, true
+		}
+	}
+	return TableAccess{}, false
+}
+
+// columnAllowed returns true if the field is allowed by any of the tables.
+// The field could be qualified by the table name.
+// The field that is not a column name (for example an expression) is never allowed.
+func columnAllowed(tables map[string]TableAccess, field string) bool {
+	tableName := ""
+	column := field
+	if i := strings.Index(field, "."); i > 0 {
+		tableName, column = field[:i], field[i+1:]
+	}
+	if !identifierRegex.MatchString(column) || (len(tableName) > 0 && !identifierRegex.MatchString(tableName)) {
+		return false
+	}
+
+	for name, access := range tables {
+		if len(tableName) > 0 && tableName != name {
+			continue
+		}
+		if len(access.Columns) == 0 {
+			return true
+		}
+		if contains(access.Columns, column) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func contains(list []string, value string) bool {
+	for _, element := range list {
+		if element == value {
+			return true
+		}
+	}
+	return false
+}
+
+// guarded wraps the command handler into the mode check and the access control.
+// The request is rejected before the handler builds the query.
+func (database *Database) guarded(name command.Name, handle command.HandleFunc) command.HandleFunc {
+	return func(request message.Request, logger log.Logger, clients remote.Clients) message.Reply {
+		if code, err := database.mode.check(name); err != nil {
+			return failWithCode(code, err.Error())
+		}
+
+		var queryParameters handler.DatabaseQueryRequest
+		if err := request.Parameters.Interface(&queryParameters); err != nil {
+			return message.Fail("parameter validation:" + err.Error())
+		}
+
+		service := identity(request)
+		if err := database.access.check(service, name, queryParameters); err != nil {
+			logger.Warn("access denied", "service", service, "command", name, "tables", queryParameters.Tables, "reason", err)
+			return failWithCode(handler.AccessDenied, "access denied: "+err.Error())
+		}
+
+		return handle(request, logger, clients)
+	}
+}
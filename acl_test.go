@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Seascape-Foundation/mysql-seascape-extension/handler"
+	"github.com/stretchr/testify/suite"
+)
+
+// Define the suite, and absorb the built-in basic suite
+// functionality from testify - including a T() method which
+// returns the current testing context
+type TestAclSuite struct {
+	suite.Suite
+	list *accessList
+}
+
+func (suite *TestAclSuite) SetupTest() {
+	suite.list = &accessList{
+		enabled: true,
+		rules: map[string]AccessRule{
+			Anonymous: {
+				Service:  Anonymous,
+				Commands: []string{handler.SelectAll.String(), handler.DELETE.String(), handler.UPDATE.String()},
+				Tables: []TableAccess{
+					{Name: "abi"},
+					{Name: "smartcontract", Columns: []string{"address", "abi_id"}},
+				},
+			},
+			"indexer": {
+				Service:  "indexer",
+				Commands: []string{handler.SelectAll.String()},
+			},
+		},
+	}
+}
+
+func (suite *TestAclSuite) TestColumnAllowed() {
+	tables := map[string]TableAccess{
+		"abi":           {Name: "abi"},
+		"smartcontract": {Name: "smartcontract", Columns: []string{"address"}},
+	}
+	suite.Require().True(columnAllowed(tables, "address"))
+	suite.Require().True(columnAllowed(tables, "abi.body"))
+	suite.Require().True(columnAllowed(tables, "smartcontract.address"))
+	suite.Require().False(columnAllowed(tables, "smartcontract.abi_id"))
+	suite.Require().False(columnAllowed(tables, "secret_table.address"))
+
+	// the expressions are not the columns, even if all columns of the table are allowed
+	suite.Require().False(columnAllowed(tables, "(SELECT 1)"))
+	suite.Require().False(columnAllowed(tables, "abi.body, secret"))
+	suite.Require().False(columnAllowed(tables, "COUNT(*)"))
+}
+
+func (suite *TestAclSuite) TestCheck() {
+	allowed := []handler.DatabaseQueryRequest{
+		{Tables: []string{"abi"}, Where: "abi_id = ?", Arguments: []interface{}{"a"}},
+		{Tables: []string{"smartcontract"}, Fields: []string{"address"}, Where: "abi_id IN (?)", OrderBy: []string{"address DESC"}},
+		{Tables: []string{"abi"}, Where: "JSON_EXTRACT(body, '$.name') = ? AND created_at > NOW() - INTERVAL 1 DAY"},
+	}
+	for _, parameters := range allowed {
+		suite.Require().NoError(suite.list.check(Anonymous, handler.SelectAll, parameters), parameters.Where)
+	}
+
+	denied := []handler.DatabaseQueryRequest{
+		{Tables: []string{"secret_table"}},
+		{Tables: []string{"smartcontract"}},
+		{Tables: []string{"smartcontract"}, Fields: []string{"network_id"}},
+		{Tables: []string{"smartcontract"}, Fields: []string{"address"}, Where: "network_id = ?"},
+		{Tables: []string{"smartcontract"}, Fields: []string{"address"}, OrderBy: []string{"network_id"}},
+		{Tables: []string{"abi"}, Fields: []string{"(SELECT secret FROM secret_table)"}},
+		{Tables: []string{"abi"}, Where: "abi_id IN (SELECT secret FROM secret_table)"},
+		{Tables: []string{"abi"}, Where: "abi_id IN (TABLE secret_table)"},
+		{Tables: []string{"abi"}, Where: "EXISTS (TABLE secret_table)"},
+		{Tables: []string{"abi"}, Where: "abi_id = LOAD_FILE('/etc/passwd')"},
+		{Tables: []string{"abi"}, Where: "SLEEP(10) = 0"},
+		{Tables: []string{"abi"}, Operations: []handler.FieldOperation{{Field: "body", Operation: "set-null"}}},
+	}
+	for _, parameters := range denied {
+		suite.Require().Error(suite.list.check(Anonymous, handler.SelectAll, parameters), parameters.Where)
+	}
+
+	// the command and the service without the rule
+	suite.Require().Error(suite.list.check(Anonymous, handler.INSERT, handler.DatabaseQueryRequest{Tables: []string{"abi"}}))
+	suite.Require().Error(suite.list.check("unknown", handler.SelectAll, handler.DatabaseQueryRequest{Tables: []string{"abi"}}))
+
+	// any table is allowed, but the subqueries and the functions are not
+	suite.Require().NoError(suite.list.check("indexer", handler.SelectAll, handler.DatabaseQueryRequest{Tables: []string{"secret_table"}}))
+	suite.Require().Error(suite.list.check("indexer", handler.SelectAll, handler.DatabaseQueryRequest{Tables: []string{"abi"}, Where: "SLEEP(10) = 0"}))
+	suite.Require().Error(suite.list.check("indexer", handler.SelectAll, handler.DatabaseQueryRequest{Tables: []string{"abi"}, Where: "abi_id IN (TABLE secret)"}))
+
+	// the update sets the allowed columns only
+	suite.Require().NoError(suite.list.check(Anonymous, handler.UPDATE, handler.DatabaseQueryRequest{
+		Tables:     []string{"smartcontract"},
+		Where:      "address = ?",
+		Operations: []handler.FieldOperation{{Field: "abi_id", Operation: "set-null"}},
+	}))
+	suite.Require().Error(suite.list.check(Anonymous, handler.UPDATE, handler.DatabaseQueryRequest{
+		Tables:     []string{"smartcontract"},
+		Where:      "address = ?",
+		Operations: []handler.FieldOperation{{Field: "network_id", Operation: "set-null"}},
+	}))
+
+	// the disabled list allows everything
+	suite.Require().NoError((&accessList{}).check(Anonymous, handler.DELETE, handler.DatabaseQueryRequest{Tables: []string{"secret_table"}}))
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestAcl(t *testing.T) {
+	suite.Run(t, new(TestAclSuite))
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Seascape-Foundation/mysql-seascape-extension/handler"
+	"github.com/Seascape-Foundation/sds-common-lib/data_type/key_value"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/command"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/message"
+	"github.com/Seascape-Foundation/sds-service-lib/configuration"
+)
+
+// Audit sinks, where the audit entries are written
+const (
+	AuditNone  = "none"
+	AuditTable = "table"
+	AuditFile  = "file"
+)
+
+// The maximum length of the string argument in the audit entry.
+// The longer strings are truncated.
+const auditArgumentCap = 256
+
+// Anonymous is the identity of the service that connected without the curve authentication
+const Anonymous = "anonymous"
+
+// identifierRegex matches the table and column names that are safe to put into the query
+var identifierRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// AuditConfigurations The configuration parameters of the audit log of the write operations.
+//
+// SDS_AUDIT is one of: "none", "table" or "file".
+// If SDS_AUDIT_STRICT is true, then the write fails when it can not be audited.
+// Otherwise, the auditing failure is only logged.
+// Only the table sink can be strict, since the file is not a part of the transaction.
+//
+// SDS_AUDIT_REDACT is the comma separated list of the fields whose values are not written into the audit.
+var AuditConfigurations = configuration.DefaultConfig{
+	Title: "Audit",
+	Parameters: key_value.New(map[string]interface{}{
+		"SDS_AUDIT":        AuditNone,
+		"SDS_AUDIT_TABLE":  "audit_log",
+		"SDS_AUDIT_FILE":   "./audit.jsonl",
+		"SDS_AUDIT_STRICT": false,
+		"SDS_AUDIT_REDACT": "password,secret,private_key",
+	}),
+}
+
+// AuditEntry is the record of the write operation
+type AuditEntry struct {
+	Command   string        `json:"command"`
+	Tables    []string      `json:"tables"`
+	Fields    []string      `json:"fields,omitempty"`
+	Where     string        `json:"where,omitempty"`
+	Arguments []interface{} `json:"arguments,omitempty"` // sanitised arguments
+	Rows      int64         `json:"rows_affected"`
+	Service   string        `json:"service"` // identity of the requesting service
+	Timestamp time.Time     `json:"timestamp"`
+}
+
+// auditor records the write operations
+type auditor struct {
+	mutex  sync.Mutex
+	sink   string
+	table  string
+	file   *os.File
+	strict bool
+	redact map[string]bool
+}
+
+// execer is implemented by sql.DB and sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// newAuditor returns the auditor with the sink set in the configuration
+func newAuditor(appConfig *configuration.Config) (*auditor, error) {
+	a := &auditor{
+		sink:   appConfig.GetString("SDS_AUDIT"),
+		table:  appConfig.GetString("SDS_AUDIT_TABLE"),
+		strict: appConfig.GetBool("SDS_AUDIT_STRICT"),
+		redact: make(map[string]bool),
+	}
+	for _, field := range strings.Split(appConfig.GetString("SDS_AUDIT_REDACT"), ",") {
+		field = strings.TrimSpace(field)
+		if len(field) > 0 {
+			a.redact[strings.ToLower(field)] = true
+		}
+	}
+
+	switch a.sink {
+	case AuditNone:
+		return a, nil
+	case AuditTable:
+		if !identifierRegex.MatchString(a.table) {
+			return nil, fmt.Errorf("'SDS_AUDIT_TABLE' %s is not a valid table name", a.table)
+		}
+		return a, nil
+	case AuditFile:
+		if a.strict {
+			return nil, fmt.Errorf("the '%s' audit can not be strict, the file is written after the commit", AuditFile)
+		}
+		file, err := os.OpenFile(appConfig.GetString("SDS_AUDIT_FILE"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("os.OpenFile: %w", err)
+		}
+		a.file = file
+		return a, nil
+	}
+
+	return nil, fmt.Errorf("unsupported 'SDS_AUDIT' %s, expected '%s', '%s' or '%s'", a.sink, AuditNone, AuditTable, AuditFile)
+}
+
+// enabled returns true if the write operations are audited
+func (a *auditor) enabled() bool {
+	return a.sink != AuditNone
+}
+
+// identity returns the public key of the requesting service.
+// If the service is not authenticated, then it returns Anonymous.
+func identity(request message.Request) string {
+	publicKey := request.GetPublicKey()
+	if len(publicKey) == 0 {
+		return Anonymous
+	}
+	return publicKey
+}
+
+// newEntry creates the audit entry of the write operation
+func (a *auditor) newEntry(request message.Request, name command.Name, parameters handler.DatabaseQueryRequest, rows int64) AuditEntry {
+	return AuditEntry{
+		Command:   name.String(),
+		Tables:    parameters.Tables,
+		Fields:    parameters.Fields,
+		Where:     parameters.Where,
+		Arguments: a.sanitize(parameters),
+		Rows:      rows,
+		Service:   identity(request),
+		Timestamp: time.Now().UTC(),
+	}
+}
+
+// sanitize the arguments for the audit.
+//
+// The values of the redacted fields are hidden.
+// The binary data and the long strings are truncated.
+// The arguments after the fields are the arguments of the WHERE clause.
+func (a *auditor) sanitize(parameters handler.DatabaseQueryRequest) []interface{} {
+	arguments := make([]interface{}, len(parameters.Arguments))
+	for i, argument := range parameters.Arguments {
+		if i < len(parameters.Fields) && a.redact[strings.ToLower(parameters.Fields[i])] {
+			arguments[i] = "[redacted]"
+			continue
+		}
+
+		switch value := argument.(type) {
+		case []byte:
+			arguments[i] = fmt.Sprintf("[%d bytes]", len(value))
+		case string:
+			if len(value) > auditArgumentCap {
+				arguments[i] = value[:auditArgumentCap] + fmt.Sprintf("...[%d bytes]", len(value))
+			} else {
+				arguments[i] = value
+			}
+		default:
+			arguments[i] = value
+		}
+	}
+
+	return arguments
+}
+
+// record writes the entry into the sink.
+// For the table sink, the entry is inserted by the given execer.
+// The file entry is written only after the statement is committed,
+// so the file has no entries of the rolled back statements.
+func (a *auditor) record(exec execer, entry AuditEntry) error {
+	switch a.sink {
+	case AuditTable:
+		fields, err := json.Marshal(entry.Fields)
+		if err != nil {
+			return fmt.Errorf("json.Marshal(fields): %w", err)
+		}
+		arguments, err := json.Marshal(entry.Arguments)
+		if err != nil {
+			return fmt.Errorf("json.Marshal(arguments): %w", err)
+		}
+
+		query := `INSERT INTO ` + a.table + ` (command, table_names, fields, where_clause, arguments, rows_affected, service, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+		_, err = exec.Exec(query,
+			entry.Command,
+			strings.Join(entry.Tables, ","),
+			fields,
+			entry.Where,
+			arguments,
+			entry.Rows,
+			entry.Service,
+			entry.Timestamp,
+		)
+		if err != nil {
+			return fmt.Errorf("exec.Exec: %w", err)
+		}
+	case AuditFile:
+		bytes, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("json.Marshal: %w", err)
+		}
+
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+		if _, err := a.file.Write(append(bytes, '\n')); err != nil {
+			return fmt.Errorf("file.Write: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// execWrite executes the insert, update or delete statement and records it in the audit log.
+// Returns the amount of the affected rows.
+//
+// In the strict mode, the statement and the audit entry are committed in one transaction,
+// so the statement is rolled back if it can not be audited.
+// Otherwise, the failed auditing is logged, but the statement is not rolled back.
+//
+// If the request is a part of the client's transaction, then the statement and the audit entry
+// are executed in that transaction.
+//
+// The outbox messages of the request are written in the same transaction as the statement.
+// The change events are published after the statement is committed.
+func (database *Database) execWrite(request message.Request, name command.Name, parameters handler.DatabaseQueryRequest, query string) (int64, error) {
+	if err := parameters.ValidateOutbox(); err != nil {
+		return 0, fmt.Errorf("outbox: %w", err)
+	}
+	stmt := database.newStatement(query, parameters)
+
+	if len(parameters.TransactionId) > 0 {
+		return database.execInTransaction(request, name, parameters, query, stmt)
+	}
+
+	if (!database.audit.enabled() || !database.audit.strict) && len(parameters.Outbox) == 0 && !database.changes.locking(name) {
+		capture, err := database.captureChanges(database.Connection, name, parameters)
+		if err != nil {
+			database.failed(stmt, err)
+			return 0, fmt.Errorf("changes: %w", err)
+		}
+		result, err := database.Connection.Exec(query, parameters.Arguments...)
+		if err != nil {
+			database.failed(stmt, err)
+			return 0, fmt.Errorf("db.Connection.Exec: %w", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			database.failed(stmt, err)
+			return 0, fmt.Errorf("result.RowsAffected: %w", err)
+		}
+		database.done(stmt, affected)
+		capture.finish(result, affected)
+		database.changes.publish(capture)
+
+		if database.audit.enabled() {
+			entry := database.audit.newEntry(request, name, parameters, affected)
+			if err := database.audit.record(database.Connection, entry); err != nil {
+				database.logger.Warn("failed to audit the write operation", "command", name, "tables", parameters.Tables, "error", err)
+			}
+		}
+
+		return affected, nil
+	}
+
+	tx, err := database.Connection.Begin()
+	if err != nil {
+		database.failed(stmt, err)
+		return 0, fmt.Errorf("db.Connection.Begin: %w", err)
+	}
+	capture, err := database.captureChanges(tx, name, parameters)
+	if err != nil {
+		_ = tx.Rollback()
+		database.failed(stmt, err)
+		return 0, fmt.Errorf("changes: %w", err)
+	}
+	result, err := tx.Exec(query, parameters.Arguments...)
+	if err != nil {
+		_ = tx.Rollback()
+		database.failed(stmt, err)
+		return 0, fmt.Errorf("tx.Exec: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		_ = tx.Rollback()
+		database.failed(stmt, err)
+		return 0, fmt.Errorf("result.RowsAffected: %w", err)
+	}
+
+	entry := database.audit.newEntry(request, name, parameters, affected)
+	if database.audit.sink == AuditTable {
+		if err := database.audit.record(tx, entry); err != nil {
+			if database.audit.strict {
+				_ = tx.Rollback()
+				database.failed(stmt, err)
+				return 0, fmt.Errorf("audit is unavailable, the write is rolled back: %w", err)
+			}
+			database.logger.Warn("failed to audit the write operation", "command", name, "tables", parameters.Tables, "error", err)
+		}
+	}
+	outboxIds, err := database.outbox.write(tx, identity(request), parameters.Outbox, affected)
+	defer database.outbox.finish(outboxIds)
+	if err != nil {
+		_ = tx.Rollback()
+		database.failed(stmt, err)
+		return 0, fmt.Errorf("outbox is unavailable, the write is rolled back: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		database.failed(stmt, err)
+		return 0, fmt.Errorf("tx.Commit: %w", err)
+	}
+	database.done(stmt, affected)
+	if database.audit.sink == AuditFile {
+		database.recordFile(entry)
+	}
+	capture.finish(result, affected)
+	database.changes.publish(capture)
+
+	return affected, nil
+}
+
+// execInTransaction executes the write statement in the client's transaction.
+//
+// In the strict mode, the whole transaction is rolled back if the statement can not be audited.
+// The change events are published when the client commits the transaction.
+func (database *Database) execInTransaction(request message.Request, name command.Name, parameters handler.DatabaseQueryRequest, query string, stmt *statement) (int64, error) {
+	tx, release, err := database.transactions.get(parameters.TransactionId, identity(request))
+	if err != nil {
+		database.failed(stmt, err)
+		return 0, fmt.Errorf("transaction: %w", err)
+	}
+	defer release()
+
+	// the file entry is written after the client commits the transaction
+	var entry *AuditEntry
+	if database.audit.sink == AuditFile {
+		err := database.transactions.afterCommit(parameters.TransactionId, identity(request), func() {
+			if entry != nil {
+				database.recordFile(*entry)
+			}
+		})
+		if err != nil {
+			database.failed(stmt, err)
+			return 0, fmt.Errorf("transaction: %w", err)
+		}
+	}
+
+	capture, err := database.captureChanges(tx, name, parameters)
+	if err != nil {
+		database.failed(stmt, err)
+		return 0, fmt.Errorf("changes: %w", err)
+	}
+	// the events are registered before the statement, so the executed statement never fails on it.
+	// If the statement fails, then the events have no affected rows and they are not published.
+	if capture != nil {
+		err := database.transactions.afterCommit(parameters.TransactionId, identity(request), func() {
+			database.changes.publish(capture)
+		})
+		if err != nil {
+			database.failed(stmt, err)
+			return 0, fmt.Errorf("transaction: %w", err)
+		}
+	}
+	result, err := tx.Exec(query, parameters.Arguments...)
+	if err != nil {
+		database.failed(stmt, err)
+		return 0, fmt.Errorf("tx.Exec: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		database.failed(stmt, err)
+		return 0, fmt.Errorf("result.RowsAffected: %w", err)
+	}
+	database.done(stmt, affected)
+	capture.finish(result, affected)
+
+	if database.audit.sink == AuditFile {
+		fileEntry := database.audit.newEntry(request, name, parameters, affected)
+		entry = &fileEntry
+	} else if database.audit.sink == AuditTable {
+		tableEntry := database.audit.newEntry(request, name, parameters, affected)
+		if err := database.audit.record(tx, tableEntry); err != nil {
+			if database.audit.strict {
+				database.rollback(request, parameters.TransactionId)
+				return 0, fmt.Errorf("audit is unavailable, the transaction is rolled back: %w", err)
+			}
+			database.logger.Warn("failed to audit the write operation", "command", name, "tables", parameters.Tables, "error", err)
+		}
+	}
+	outboxIds, err := database.outbox.write(tx, identity(request), parameters.Outbox, affected)
+	if len(outboxIds) > 0 {
+		// the messages are pending until the client ends the transaction
+		finish := func() {
+			database.outbox.finish(outboxIds)
+		}
+		if err := database.transactions.afterEnd(parameters.TransactionId, identity(request), finish); err != nil {
+			finish()
+		}
+	}
+	if err != nil {
+		database.rollback(request, parameters.TransactionId)
+		return 0, fmt.Errorf("outbox is unavailable, the transaction is rolled back: %w", err)
+	}
+	return affected, nil
+}
+
+// recordFile writes the entry of the committed statement into the file sink.
+// The statement can not be rolled back anymore, so the failure is only logged.
+func (database *Database) recordFile(entry AuditEntry) {
+	if err := database.audit.record(nil, entry); err != nil {
+		database.logger.Warn("failed to audit the write operation", "command", entry.Command, "tables", entry.Tables, "error", err)
+	}
+}
+
+// rollback the client's transaction, that can not be committed
+func (database *Database) rollback(request message.Request, transactionId string) {
+	if err := database.transactions.end(transactionId, identity(request), false); err != nil {
+		database.logger.Warn("failed to roll back the transaction", "transaction_id", transactionId, "error", err)
+	}
+}
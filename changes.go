@@ -0,0 +1,372 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Seascape-Foundation/mysql-seascape-extension/handler"
+	"github.com/Seascape-Foundation/mysql-seascape-extension/schema"
+	"github.com/Seascape-Foundation/sds-common-lib/data_type/key_value"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/command"
+	"github.com/Seascape-Foundation/sds-service-lib/configuration"
+	"github.com/Seascape-Foundation/sds-service-lib/log"
+	zmq "github.com/pebbe/zmq4"
+)
+
+// ChangesConfigurations The configuration parameters of the table change notifications.
+//
+// SDS_CHANGES_URL is the endpoint of the PUB socket, for example "tcp://*:4011".
+// If it's empty, then the change events are not published.
+// SDS_CHANGES_KEY_LIMIT is the maximum amount of the primary keys in the event.
+// If the statement changed more rows, then the event is truncated.
+var ChangesConfigurations = configuration.DefaultConfig{
+	Title: "Changes",
+	Parameters: key_value.New(map[string]interface{}{
+		"SDS_CHANGES_URL":       "",
+		"SDS_CHANGES_KEY_LIMIT": uint64(1000),
+	}),
+}
+
+// changes publishes the change events of the write commands.
+//
+// The events are published after the statement is committed,
+// so the subscribers never see the change that was rolled back.
+type changes struct {
+	url      string
+	keyLimit uint64
+	logger   log.Logger
+
+	socketMutex sync.Mutex // the zmq socket is not thread safe
+	socket      *zmq.Socket
+
+	mutex       sync.RWMutex
+	primaryKeys map[string][]keyColumn // the cached primary keys of the tables, reset after the migrations
+}
+
+// keyColumn is the primary key column with its type, that encodes the key values
+type keyColumn struct {
+	name         string
+	databaseType string // as sql.ColumnType.DatabaseTypeName returns it, for example "UNSIGNED BIGINT"
+}
+
+// keyNames returns the names of the key columns
+func keyNames(columns []keyColumn) []string {
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.name
+	}
+	return names
+}
+
+// encode returns the key value encoded by the column type,
+// so the key is the same whether it's taken from the arguments, the selected row or the last insert id.
+func (column keyColumn) encode(value interface{}) (interface{}, error) {
+	encoded, err := handler.EncodeValue(column.databaseType, value)
+	if err != nil {
+		return nil, fmt.Errorf("key '%s': %w", column.name, err)
+	}
+	return encoded, nil
+}
+
+func newChanges(url string, keyLimit uint64, logger log.Logger) *changes {
+	return &changes{
+		url:         url,
+		keyLimit:    keyLimit,
+		logger:      logger,
+		primaryKeys: make(map[string][]keyColumn),
+	}
+}
+
+// newChangesFromConfig returns the change notifications set in the configuration
+func newChangesFromConfig(appConfig *configuration.Config, logger log.Logger) (*changes, error) {
+	keyLimit := appConfig.GetUint64("SDS_CHANGES_KEY_LIMIT")
+	if keyLimit == 0 {
+		return nil, fmt.Errorf("the 'SDS_CHANGES_KEY_LIMIT' can not be zero")
+	}
+
+	return newChanges(appConfig.GetString("SDS_CHANGES_URL"), keyLimit, logger), nil
+}
+
+// enabled returns true if the change events are published
+func (c *changes) enabled() bool {
+	return len(c.url) > 0
+}
+
+// locking returns true if the command selects the changed rows before the statement.
+// The rows are locked, so the statement runs in the transaction.
+func (c *changes) locking(name command.Name) bool {
+	return c.enabled() && name != handler.INSERT
+}
+
+// primaryKey returns the primary key columns of the table.
+// The columns are loaded from the schema on the first call.
+func (c *changes) primaryKey(q schema.Querier, databaseName string, table string) ([]keyColumn, error) {
+	c.mutex.RLock()
+	columns, ok := c.primaryKeys[table]
+	c.mutex.RUnlock()
+	if ok {
+		return columns, nil
+	}
+
+	tables, err := schema.Load(q, databaseName, table)
+	if err != nil {
+		return nil, fmt.Errorf("schema.Load: %w", err)
+	}
+	columns = make([]keyColumn, 0)
+	for _, loaded := range tables {
+		for _, name := range loaded.PrimaryKey {
+			for _, column := range loaded.Columns {
+				if column.Name == name {
+					columns = append(columns, keyColumn{name: name, databaseType: databaseTypeName(column)})
+				}
+			}
+		}
+	}
+
+	c.mutex.Lock()
+	c.primaryKeys[table] = columns
+	c.mutex.Unlock()
+
+	return columns, nil
+}
+
+// reset removes the cached primary keys, so they are loaded from the changed schema
+func (c *changes) reset() {
+	c.mutex.Lock()
+	c.primaryKeys = make(map[string][]keyColumn)
+	c.mutex.Unlock()
+}
+
+// databaseTypeName returns the type of the schema column as sql.ColumnType.DatabaseTypeName returns it
+func databaseTypeName(column schema.Column) string {
+	name := strings.ToUpper(column.DataType)
+	if strings.Contains(strings.ToLower(column.Type), "unsigned") {
+		name = "UNSIGNED " + name
+	}
+	return name
+}
+
+// tableName returns the table name without the alias and the quotes
+func tableName(table string) string {
+	fields := strings.Fields(table)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.Trim(fields[0], "`")
+}
+
+// changeCapture keeps the change events of one write statement until they are published
+type changeCapture struct {
+	events    []handler.ChangeEvent
+	generated *keyColumn // the auto increment primary key that is not set by the insert
+}
+
+// captureChanges prepares the change events of the write statement.
+// Returns nil if the change events are not published.
+//
+// For UPDATE and DELETE, the primary keys of the changed rows are selected and locked by the executor,
+// before the statement is executed.
+// For INSERT, the primary keys are taken from the inserted fields.
+func (database *Database) captureChanges(exec executor, name command.Name, parameters handler.DatabaseQueryRequest) (*changeCapture, error) {
+	if !database.changes.enabled() {
+		return nil, nil
+	}
+
+	operation := handler.ChangeInsert
+	switch name {
+	case handler.UPDATE:
+		operation = handler.ChangeUpdate
+	case handler.DELETE:
+		operation = handler.ChangeDelete
+	}
+	var fields []string
+	if name != handler.DELETE {
+		fields = parameters.ChangedFields()
+	}
+
+	capture := &changeCapture{events: make([]handler.ChangeEvent, 0, len(parameters.Tables))}
+	for _, table := range parameters.Tables {
+		capture.events = append(capture.events, handler.ChangeEvent{
+			Table:     tableName(table),
+			Operation: operation,
+			Fields:    fields,
+			Truncated: true,
+		})
+	}
+	// the changed rows of the multi-table statement are not known
+	if len(capture.events) != 1 {
+		return capture, nil
+	}
+
+	event := &capture.events[0]
+	primaryKey, err := database.changes.primaryKey(database.Connection, database.parameters.name, event.Table)
+	if err != nil {
+		return nil, fmt.Errorf("primary key of '%s': %w", event.Table, err)
+	}
+	if len(primaryKey) == 0 {
+		return capture, nil
+	}
+
+	if name == handler.INSERT {
+		key := make(map[string]interface{}, len(primaryKey))
+		for _, column := range primaryKey {
+			for i, field := range parameters.Fields {
+				if field == column.name && i < len(parameters.Arguments) {
+					value, err := column.encode(parameters.Arguments[i])
+					if err != nil {
+						// the database converts the argument or rejects the insert, the key is unknown
+						return capture, nil
+					}
+					key[column.name] = value
+				}
+			}
+		}
+		if len(key) == len(primaryKey) {
+			event.Keys = []map[string]interface{}{key}
+			event.Truncated = false
+		} else if len(primaryKey) == 1 {
+			capture.generated = &primaryKey[0]
+		}
+		return capture, nil
+	}
+
+	query, arguments, err := parameters.BuildChangedKeysQuery(name == handler.UPDATE, keyNames(primaryKey), database.changes.keyLimit+1)
+	if err != nil {
+		return nil, fmt.Errorf("BuildChangedKeysQuery: %w", err)
+	}
+	keys, err := selectKeys(exec, query, arguments, primaryKey)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(keys)) <= database.changes.keyLimit {
+		event.Keys = keys
+		event.Truncated = false
+	}
+
+	return capture, nil
+}
+
+// orderDeleted adds the primary key to the order of the delete with the limit.
+// The keys of the deleted rows are selected in the same order,
+// so the rows with the same values of the OrderBy are not mixed up.
+func (database *Database) orderDeleted(parameters *handler.DatabaseQueryRequest) error {
+	if !database.changes.locking(handler.DELETE) || parameters.Limit == 0 || len(parameters.Tables) != 1 {
+		return nil
+	}
+	primaryKey, err := database.changes.primaryKey(database.Connection, database.parameters.name, tableName(parameters.Tables[0]))
+	if err != nil {
+		return fmt.Errorf("primary key of '%s': %w", parameters.Tables[0], err)
+	}
+	parameters.OrderByKeys(keyNames(primaryKey))
+	return nil
+}
+
+// selectKeys returns the primary key values of the selected rows
+func selectKeys(exec executor, query string, arguments []interface{}, primaryKey []keyColumn) ([]map[string]interface{}, error) {
+	rows, err := exec.Query(query, arguments...)
+	if err != nil {
+		return nil, fmt.Errorf("exec.Query: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	keys := make([]map[string]interface{}, 0)
+	values := make([]interface{}, len(primaryKey))
+	pointers := make([]interface{}, len(primaryKey))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, fmt.Errorf("rows.Scan: %w", err)
+		}
+		key := make(map[string]interface{}, len(primaryKey))
+		for i, column := range primaryKey {
+			value, err := column.encode(values[i])
+			if err != nil {
+				return nil, err
+			}
+			key[column.name] = value
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err: %w", err)
+	}
+
+	return keys, nil
+}
+
+// finish sets the result of the executed statement.
+// The generated primary key of the inserted row is taken from the last insert id.
+func (capture *changeCapture) finish(result sql.Result, affected int64) {
+	if capture == nil {
+		return
+	}
+	for i := range capture.events {
+		capture.events[i].Rows = affected
+	}
+
+	if capture.generated != nil && affected > 0 {
+		id, err := result.LastInsertId()
+		if err != nil || id <= 0 {
+			return
+		}
+		value, err := capture.generated.encode(id)
+		if err == nil {
+			capture.events[0].Keys = []map[string]interface{}{{capture.generated.name: value}}
+			capture.events[0].Truncated = false
+		}
+	}
+}
+
+// startChanges binds the PUB socket of the change events
+func (database *Database) startChanges() error {
+	if !database.changes.enabled() {
+		return nil
+	}
+
+	socket, err := zmq.NewSocket(zmq.PUB)
+	if err != nil {
+		return fmt.Errorf("zmq error for new pub socket: %w", err)
+	}
+	if err := socket.Bind(database.changes.url); err != nil {
+		_ = socket.Close()
+		return fmt.Errorf("socket.Bind: %s: %w", database.changes.url, err)
+	}
+
+	database.changes.socket = socket
+	database.logger.Info("change events are published", "url", database.changes.url)
+	return nil
+}
+
+// publish sends the change events of the committed statement, if it changed any rows.
+// The topic of the event is the table name.
+//
+// The events are not persisted, the failure to publish is only logged.
+func (c *changes) publish(capture *changeCapture) {
+	if capture == nil || c.socket == nil {
+		return
+	}
+
+	c.socketMutex.Lock()
+	defer c.socketMutex.Unlock()
+
+	for _, event := range capture.events {
+		if event.Rows == 0 {
+			continue
+		}
+		bytes, err := json.Marshal(event)
+		if err != nil {
+			c.logger.Warn("failed to encode the change event", "table", event.Table, "error", err)
+			continue
+		}
+		if _, err := c.socket.SendMessage(event.Table, bytes); err != nil {
+			c.logger.Warn("failed to publish the change event", "table", event.Table, "error", err)
+		}
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Seascape-Foundation/mysql-seascape-extension/handler"
+	"github.com/Seascape-Foundation/mysql-seascape-extension/schema"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/command"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/message"
+	"github.com/Seascape-Foundation/sds-service-lib/log"
+	"github.com/Seascape-Foundation/sds-service-lib/remote"
+)
+
+const (
+	defaultBatchSize = 1000
+	maxBatchSize     = 50000
+	defaultPause     = 100 * time.Millisecond
+	maxPause         = time.Minute
+	maxRunningJobs   = 4
+	// jobRetention is how long the finished jobs are kept for CHUNKED_STATUS
+	jobRetention = time.Hour
+)
+
+// job is the chunked delete or update running in the background
+type job struct {
+	mutex   sync.Mutex
+	status  handler.JobStatusReply
+	service string // only the service that started the job can see and cancel it
+	cancel  context.CancelFunc
+}
+
+// progress returns the copy of the job status
+func (j *job) progress() handler.JobStatusReply {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return j.status
+}
+
+// batchDone adds the rows touched by the batch
+func (j *job) batchDone(rows int64) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	j.status.Batches++
+	j.status.Rows += uint64(rows)
+}
+
+// finish sets the final status of the job
+func (j *job) finish(status string, err error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	j.status.Status = status
+	j.status.FinishedAt = time.Now().Unix()
+	if err != nil {
+		j.status.Error = err.Error()
+	}
+}
+
+// jobs keeps the chunked jobs by their id
+type jobs struct {
+	mutex sync.Mutex
+	list  map[string]*job
+}
+
+func newJobs() *jobs {
+	return &jobs{list: make(map[string]*job)}
+}
+
+// add the new job, removing the expired finished jobs
+func (list *jobs) add(id string, added *job) error {
+	list.mutex.Lock()
+	defer list.mutex.Unlock()
+
+	running := 0
+	for jobId, listed := range list.list {
+		status := listed.progress()
+		if status.Status == handler.JobRunning {
+			running++
+		} else if time.Since(time.Unix(status.FinishedAt, 0)) > jobRetention {
+			delete(list.list, jobId)
+		}
+	}
+	if running >= maxRunningJobs {
+		return fmt.Errorf("too many running jobs, the limit is %d", maxRunningJobs)
+	}
+
+	list.list[id] = added
+	return nil
+}
+
+// get returns the job of the service
+func (list *jobs) get(id string, service string) (*job, error) {
+	list.mutex.Lock()
+	defer list.mutex.Unlock()
+
+	listed, ok := list.list[id]
+	if !ok || listed.service != service {
+		return nil, fmt.Errorf("job '%s' not found", id)
+	}
+	return listed, nil
+}
+
+// chunked is the prepared job
+type chunked struct {
+	request    message.Request // the request that started the job, for the audit and the tracing
+	name       command.Name    // DELETE or UPDATE
+	parameters handler.DatabaseQueryRequest
+	primaryKey []string
+	batchSize  uint64
+	pause      time.Duration
+}
+
+// run deletes or updates the rows in batches until there are no more rows or the job is cancelled.
+//
+// Each batch selects the primary keys of the next rows after the last batch,
+// then deletes or updates the rows matching the query within the range of these keys.
+func (database *Database) runChunked(ctx context.Context, running *job, c chunked) {
+	defer func() {
+		running.cancel()
+		summary := running.progress()
+		database.logger.Info("chunked job finished", "job_id", summary.JobId, "status", summary.Status,
+			"batches", summary.Batches, "rows", summary.Rows, "error", summary.Error)
+	}()
+
+	table := c.parameters.Tables[0]
+	keys := strings.Join(c.primaryKey, ", ")
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(c.primaryKey)), ", ")
+
+	setArguments, whereArguments := c.parameters.UpdateArguments()
+	if c.name == handler.DELETE {
+		setArguments, whereArguments = nil, c.parameters.Arguments
+	}
+
+	var last []interface{}
+	for {
+		select {
+		case <-ctx.Done():
+			running.finish(handler.JobCancelled, nil)
+			return
+		default:
+		}
+		// the mode could be switched while the job is running
+		if _, err := database.mode.check(c.name); err != nil {
+			running.finish(handler.JobFailed, err)
+			return
+		}
+
+		// the primary keys of the next batch
+		conditions := make([]string, 0, 2)
+		arguments := make([]interface{}, 0, len(whereArguments)+len(last))
+		if len(c.parameters.Where) > 0 {
+			conditions = append(conditions, "("+c.parameters.Where+")")
+			arguments = append(arguments, whereArguments...)
+		}
+		if last != nil {
+			conditions = append(conditions, "("+keys+") > ("+placeholders+")")
+			arguments = append(arguments, last...)
+		}
+		query := "SELECT " + keys + " FROM " + table
+		if len(conditions) > 0 {
+			query += " WHERE " + strings.Join(conditions, " AND ")
+		}
+		query += " ORDER BY " + keys + " LIMIT " + fmt.Sprint(c.batchSize)
+
+		first, batchLast, amount, err := database.selectKeys(query, arguments, len(c.primaryKey))
+		if err != nil {
+			running.finish(handler.JobFailed, err)
+			return
+		}
+		if amount == 0 {
+			break
+		}
+
+		// the rows within the range of the selected keys
+		batch := c.parameters
+		rangeCondition := "(" + keys + ") >= (" + placeholders + ") AND (" + keys + ") <= (" + placeholders + ")"
+		if len(batch.Where) > 0 {
+			batch.Where = "(" + batch.Where + ") AND " + rangeCondition
+		} else {
+			batch.Where = rangeCondition
+		}
+		batch.Arguments = make([]interface{}, 0, len(setArguments)+len(whereArguments)+len(first)*2)
+		batch.Arguments = append(batch.Arguments, setArguments...)
+		batch.Arguments = append(batch.Arguments, whereArguments...)
+		batch.Arguments = append(batch.Arguments, first...)
+		batch.Arguments = append(batch.Arguments, batchLast...)
+
+		var mutation string
+		if c.name == handler.DELETE {
+			mutation, err = batch.BuildDeleteQuery()
+		} else {
+			mutation, err = batch.BuildUpdateQuery()
+		}
+		if err != nil {
+			running.finish(handler.JobFailed, err)
+			return
+		}
+		affected, err := database.execWrite(c.request, c.name, batch, mutation)
+		if err != nil {
+			running.finish(handler.JobFailed, err)
+			return
+		}
+		running.batchDone(affected)
+
+		if uint64(amount) < c.batchSize {
+			break
+		}
+		last = batchLast
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(c.pause):
+		}
+	}
+
+	running.finish(handler.JobDone, nil)
+}
+
+// selectKeys returns the first and the last primary keys of the batch, and the amount of the selected rows
+func (database *Database) selectKeys(query string, arguments []interface{}, columns int) ([]interface{}, []interface{}, int, error) {
+	rows, err := database.Connection.Query(query, arguments...)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("db.Connection.Query: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var first, last []interface{}
+	amount := 0
+	for rows.Next() {
+		scans := make([]interface{}, columns)
+		for i := range scans {
+			scans[i] = &scans[i]
+		}
+		if err := rows.Scan(scans...); err != nil {
+			return nil, nil, 0, fmt.Errorf("rows.Scan: %w", err)
+		}
+		// the strings are compared by the column collation, the bytes would be compared as binary
+		for i, scanned := range scans {
+			if bytes, ok := scanned.([]byte); ok {
+				scans[i] = string(bytes)
+			}
+		}
+		if first == nil {
+			first = scans
+		}
+		last = scans
+		amount++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, 0, fmt.Errorf("rows.Err: %w", err)
+	}
+
+	return first, last, amount, nil
+}
+
+// starts the background delete or update in batches, returns the job id
+var onChunkedStart = func(request message.Request, logger log.Logger, _ remote.Clients) message.Reply {
+	if db == nil || db.Connection == nil {
+		return message.Fail("database.Connection is nil, please open the connection first")
+	}
+
+	var parameters handler.ChunkedRequest
+	err := request.Parameters.Interface(&parameters)
+	if err != nil {
+		return message.Fail("parameter validation:" + err.Error())
+	}
+	if err := parameters.Validate(); err != nil {
+		return message.Fail("parameter validation: " + err.Error())
+	}
+
+	queryParameters := parameters.DatabaseQueryRequest
+	name := handler.DELETE
+	if parameters.Command == handler.ChunkedUpdate {
+		name = handler.UPDATE
+	}
+	// the batches are the deletes or the updates, so the service needs the access to them too
+	service := identity(request)
+	if err := db.access.check(service, name, queryParameters); err != nil {
+		logger.Warn("access denied", "service", service, "command", name, "tables", queryParameters.Tables, "reason", err)
+		return failWithCode(handler.AccessDenied, "access denied: "+err.Error())
+	}
+	if name == handler.UPDATE {
+		if err := queryParameters.DeserializeBytes(); err != nil {
+			return message.Fail("serialization failed: " + err.Error())
+		}
+		if err := db.encodeJsonArguments(&queryParameters); err != nil {
+			return message.Fail("json arguments: " + err.Error())
+		}
+	}
+	if err := queryParameters.ExpandLists(name == handler.UPDATE, db.parameters.maxInList); err != nil {
+		return message.Fail("list arguments: " + err.Error())
+	}
+	if err := queryParameters.CompileOperations(); err != nil {
+		return message.Fail("operations: " + err.Error())
+	}
+	if err := queryParameters.CompileJson(); err != nil {
+		return message.Fail("json filters: " + err.Error())
+	}
+
+	tables, err := schema.Load(db.Connection, db.parameters.name, queryParameters.Tables[0])
+	if err != nil {
+		return message.Fail("schema.Load: " + err.Error())
+	}
+	if len(tables) == 0 {
+		return message.Fail("not found: " + queryParameters.Tables[0])
+	}
+	if len(tables[0].PrimaryKey) == 0 {
+		return message.Fail("the table '" + queryParameters.Tables[0] + "' has no primary key")
+	}
+
+	batchSize := parameters.BatchSize
+	if batchSize == 0 {
+		batchSize = defaultBatchSize
+	} else if batchSize > maxBatchSize {
+		return message.Fail(fmt.Sprintf("batch_size can not be greater than %d", maxBatchSize))
+	}
+	pause := time.Duration(parameters.Pause) * time.Millisecond
+	if parameters.Pause == 0 {
+		pause = defaultPause
+	} else if pause > maxPause {
+		return message.Fail(fmt.Sprintf("pause can not be greater than %d milliseconds", maxPause.Milliseconds()))
+	}
+
+	id, err := randomId()
+	if err != nil {
+		return message.Fail(err.Error())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	started := &job{
+		status: handler.JobStatusReply{
+			JobId:     id,
+			Command:   parameters.Command,
+			Table:     queryParameters.Tables[0],
+			Status:    handler.JobRunning,
+			StartedAt: time.Now().Unix(),
+		},
+		service: identity(request),
+		cancel:  cancel,
+	}
+	if err := db.jobs.add(id, started); err != nil {
+		cancel()
+		return message.Fail(err.Error())
+	}
+
+	go db.runChunked(ctx, started, chunked{
+		request:    request,
+		name:       name,
+		parameters: queryParameters,
+		primaryKey: tables[0].PrimaryKey,
+		batchSize:  batchSize,
+		pause:      pause,
+	})
+
+	reply := handler.ChunkedStartReply{JobId: id}
+	replyMessage, err := command.Reply(&reply)
+	if err != nil {
+		return message.Fail("command.Reply: " + err.Error())
+	}
+
+	return replyMessage
+}
+
+// returns the progress of the chunked job
+var onChunkedStatus = func(request message.Request, _ log.Logger, _ remote.Clients) message.Reply {
+	if db == nil {
+		return message.Fail("database is nil, please open the connection first")
+	}
+
+	var parameters handler.JobRequest
+	err := request.Parameters.Interface(&parameters)
+	if err != nil {
+		return message.Fail("parameter validation:" + err.Error())
+	}
+
+	running, err := db.jobs.get(parameters.JobId, identity(request))
+	if err != nil {
+		return message.Fail(err.Error())
+	}
+
+	reply := running.progress()
+	replyMessage, err := command.Reply(&reply)
+	if err != nil {
+		return message.Fail("command.Reply: " + err.Error())
+	}
+
+	return replyMessage
+}
+
+// stops the chunked job after the current batch, returns its progress
+var onChunkedCancel = func(request message.Request, _ log.Logger, _ remote.Clients) message.Reply {
+	if db == nil {
+		return message.Fail("database is nil, please open the connection first")
+	}
+
+	var parameters handler.JobRequest
+	err := request.Parameters.Interface(&parameters)
+	if err != nil {
+		return message.Fail("parameter validation:" + err.Error())
+	}
+
+	running, err := db.jobs.get(parameters.JobId, identity(request))
+	if err != nil {
+		return message.Fail(err.Error())
+	}
+	running.cancel()
+
+	reply := running.progress()
+	replyMessage, err := command.Reply(&reply)
+	if err != nil {
+		return message.Fail("command.Reply: " + err.Error())
+	}
+
+	return replyMessage
+}
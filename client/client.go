@@ -0,0 +1,495 @@
+// Package client is the typed Go client of the database extension.
+//
+// Example:
+//
+//	type Abi struct {
+//		Id   string          `db:"abi_id"`
+//		Body json.RawMessage `db:"body"`
+//	}
+//
+//	database := client.New(socket)
+//	var abi Abi
+//	err := database.SelectOne(client.Table("abi").Where("abi_id = ?", id), &abi)
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Seascape-Foundation/mysql-seascape-extension/handler"
+	"github.com/Seascape-Foundation/sds-common-lib/data_type/key_value"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/command"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/message"
+	"github.com/Seascape-Foundation/sds-service-lib/remote"
+)
+
+// ErrNotFound is returned by SelectOne if no row matches the query
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict is matched by ConflictError with errors.Is
+var ErrConflict = errors.New("conflict")
+
+// ConflictError is returned by Update if the row doesn't have the value set by Query.Expect
+type ConflictError struct {
+	// The current row with the expected column and the updated fields
+	Row map[string]interface{}
+}
+
+func (e *ConflictError) Error() string {
+	return "conflict: the row doesn't have the expected value"
+}
+
+// Is returns true for ErrConflict
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// Decode the current row into the pointer to the struct or the map
+func (e *ConflictError) Decode(dest interface{}) error {
+	return decodeRow(e.Row, dest)
+}
+
+// Client sends the commands to the database extension
+type Client struct {
+	socket        *remote.ClientSocket
+	transactionId string
+}
+
+// Tx is the client bound to the transaction.
+// All commands sent through Tx are executed in the transaction.
+type Tx struct {
+	Client
+}
+
+// New returns the client that sends the commands through the socket
+func New(socket *remote.ClientSocket) *Client {
+	return &Client{socket: socket}
+}
+
+// request sends the command, returns the reply parameters.
+//
+// The parameters are not converted by key_value.NewFromInterface,
+// since it loses the precision of the big numbers.
+func (c *Client) request(name command.Name, request interface{}) (key_value.KeyValue, error) {
+	raw, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal: %w", err)
+	}
+	parameters, err := key_value.NewFromString(string(raw))
+	if err != nil {
+		return nil, fmt.Errorf("key_value.NewFromString: %w", err)
+	}
+
+	requestMessage := message.Request{
+		Command:    name.String(),
+		Parameters: parameters,
+	}
+	reply, err := c.socket.RequestRemoteService(&requestMessage)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return reply, nil
+}
+
+// query sends the command with the query, returns the reply parameters
+func (c *Client) query(name command.Name, q *Query) (key_value.KeyValue, error) {
+	request, err := q.Request()
+	if err != nil {
+		return nil, fmt.Errorf("query.Request: %w", err)
+	}
+	request.TransactionId = c.transactionId
+
+	return c.request(name, request)
+}
+
+// Insert the row with the fields set by Query.Set or Query.Values
+func (c *Client) Insert(q *Query) error {
+	_, err := c.query(handler.INSERT, q)
+	return err
+}
+
+// Update the fields set by Query.Set or Query.Values of the rows matching the Where condition
+//
+// If the query has the expectation, and the row has another value, then *ConflictError is returned.
+func (c *Client) Update(q *Query) error {
+	reply, err := c.query(handler.UPDATE, q)
+	if err != nil {
+		return err
+	}
+	return conflictOf(reply)
+}
+
+// conflictOf returns the ConflictError if the reply of UPDATE has the conflict flag
+func conflictOf(reply key_value.KeyValue) error {
+	if conflict, _ := reply["conflict"].(bool); !conflict {
+		return nil
+	}
+
+	switch row := reply["row"].(type) {
+	case key_value.KeyValue:
+		return &ConflictError{Row: row.Map()}
+	case map[string]interface{}:
+		return &ConflictError{Row: row}
+	case nil:
+		return &ConflictError{}
+	default:
+		return fmt.Errorf("the conflict row is expected to be a map, not %T", row)
+	}
+}
+
+// Delete the rows matching the Where condition
+func (c *Client) Delete(q *Query) error {
+	request, err := q.Request()
+	if err != nil {
+		return fmt.Errorf("query.Request: %w", err)
+	}
+	if len(request.Where) == 0 && len(request.JsonFilters) == 0 {
+		return fmt.Errorf("missing Where, call DeleteAll to delete all rows")
+	}
+	request.TransactionId = c.transactionId
+
+	_, err = c.request(handler.DELETE, request)
+	return err
+}
+
+// DeleteAll deletes all rows of the table.
+// The rows could be bounded by Query.OrderBy and Query.Limit.
+func (c *Client) DeleteAll(q *Query) error {
+	request, err := q.Request()
+	if err != nil {
+		return fmt.Errorf("query.Request: %w", err)
+	}
+	if len(request.Where) > 0 || len(request.JsonFilters) > 0 {
+		return fmt.Errorf("DeleteAll has the Where condition, call Delete instead")
+	}
+	request.TransactionId = c.transactionId
+	request.AllRows = true
+
+	_, err = c.request(handler.DELETE, request)
+	return err
+}
+
+// SelectOne decodes the first row matching the query into the pointer to the struct or the map.
+// Returns ErrNotFound if there is no matching row.
+func (c *Client) SelectOne(q *Query, dest interface{}) error {
+	reply, err := c.query(handler.SelectRow, q)
+	if err != nil {
+		if handler.ErrorCodeOf(err.Error()) == handler.NotFound {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return decodeRow(reply["outputs"], dest)
+}
+
+// Select decodes the rows matching the query into the pointer to the slice of structs or maps
+func (c *Client) Select(q *Query, dest interface{}) error {
+	reply, err := c.query(handler.SelectAll, q)
+	if err != nil {
+		return err
+	}
+
+	rows, ok := reply["rows"].([]interface{})
+	if !ok && reply["rows"] != nil {
+		return fmt.Errorf("the rows are expected to be a list, not %T", reply["rows"])
+	}
+	return decodeRows(rows, dest)
+}
+
+// Exist returns true if any row matches the query
+func (c *Client) Exist(q *Query) (bool, error) {
+	reply, err := c.query(handler.EXIST, q)
+	if err != nil {
+		return false, err
+	}
+
+	exist, err := reply.GetBoolean("exist")
+	if err != nil {
+		return false, fmt.Errorf("reply.GetBoolean: %w", err)
+	}
+	return exist, nil
+}
+
+// Count returns the amount of rows matching the query
+func (c *Client) Count(q *Query) (uint64, error) {
+	reply, err := c.query(handler.COUNT, q)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := strconv.ParseUint(fmt.Sprint(reply["count"]), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("strconv.ParseUint: %w", err)
+	}
+	return count, nil
+}
+
+// Aggregate decodes the aggregations of the query into the pointer to the slice of structs or maps.
+// Each row has the GroupBy columns and the aggregations named by their aliases.
+//
+// Example:
+//
+//	var counts []struct {
+//		Address string `db:"address"`
+//		Count   uint64 `db:"count"`
+//	}
+//	err := database.Aggregate(client.Table("indexer_event").GroupBy("address").Aggregate(handler.CountFunction, "", ""), &counts)
+func (c *Client) Aggregate(q *Query, dest interface{}) error {
+	reply, err := c.query(handler.AGGREGATE, q)
+	if err != nil {
+		return err
+	}
+
+	rows, ok := reply["rows"].([]interface{})
+	if !ok && reply["rows"] != nil {
+		return fmt.Errorf("the rows are expected to be a list, not %T", reply["rows"])
+	}
+	return decodeRows(rows, dest)
+}
+
+// ChunkedDelete starts deleting the rows matching the query in the background,
+// in batches of batchSize rows with the pause between them. Returns the job id.
+// If batchSize or pause is zero, then the extension uses its default.
+//
+// Deleting all rows requires Query.AllRows.
+func (c *Client) ChunkedDelete(q *Query, batchSize uint64, pause time.Duration) (string, error) {
+	return c.startChunked(handler.ChunkedDelete, q, batchSize, pause)
+}
+
+// ChunkedUpdate starts updating the rows matching the query in the background,
+// in batches of batchSize rows with the pause between them. Returns the job id.
+func (c *Client) ChunkedUpdate(q *Query, batchSize uint64, pause time.Duration) (string, error) {
+	return c.startChunked(handler.ChunkedUpdate, q, batchSize, pause)
+}
+
+func (c *Client) startChunked(mutation string, q *Query, batchSize uint64, pause time.Duration) (string, error) {
+	if len(c.transactionId) > 0 {
+		return "", fmt.Errorf("the chunked %s can not run in the transaction", mutation)
+	}
+	request, err := q.Request()
+	if err != nil {
+		return "", fmt.Errorf("query.Request: %w", err)
+	}
+
+	reply, err := c.request(handler.ChunkedStart, handler.ChunkedRequest{
+		DatabaseQueryRequest: request,
+		Command:              mutation,
+		BatchSize:            batchSize,
+		Pause:                uint64(pause.Milliseconds()),
+	})
+	if err != nil {
+		return "", err
+	}
+	id, err := reply.GetString("job_id")
+	if err != nil {
+		return "", fmt.Errorf("reply.GetString: %w", err)
+	}
+	return id, nil
+}
+
+// JobStatus returns the progress of the chunked delete or update
+func (c *Client) JobStatus(id string) (handler.JobStatusReply, error) {
+	return c.job(handler.ChunkedStatus, id)
+}
+
+// CancelJob stops the chunked delete or update after the current batch.
+// Returns the progress, the job is still running until the batch is finished.
+func (c *Client) CancelJob(id string) (handler.JobStatusReply, error) {
+	return c.job(handler.ChunkedCancel, id)
+}
+
+func (c *Client) job(name command.Name, id string) (handler.JobStatusReply, error) {
+	var status handler.JobStatusReply
+	reply, err := c.request(name, handler.JobRequest{JobId: id})
+	if err != nil {
+		return status, err
+	}
+	if err := reply.Interface(&status); err != nil {
+		return status, fmt.Errorf("reply.Interface: %w", err)
+	}
+	return status, nil
+}
+
+// AcquireLock acquires the named lock shared by the services, waiting up to the timeout.
+// Returns false if the lock is held by another service after the timeout.
+// The lock is released after the lease, call AcquireLock again to extend it.
+// If the lease is zero, then the default lease of the extension.
+func (c *Client) AcquireLock(name string, timeout time.Duration, lease time.Duration) (handler.LockAcquireReply, error) {
+	var acquired handler.LockAcquireReply
+	request := handler.LockRequest{
+		Name:    name,
+		Timeout: uint64(timeout / time.Second),
+		Lease:   uint64(lease / time.Second),
+	}
+	reply, err := c.request(handler.LockAcquire, request)
+	if err != nil {
+		return acquired, err
+	}
+	if err := reply.Interface(&acquired); err != nil {
+		return acquired, fmt.Errorf("reply.Interface: %w", err)
+	}
+	return acquired, nil
+}
+
+// ReleaseLock releases the named lock. Returns false if the lock wasn't held by the service.
+func (c *Client) ReleaseLock(name string) (bool, error) {
+	reply, err := c.request(handler.LockRelease, handler.LockRequest{Name: name})
+	if err != nil {
+		return false, err
+	}
+	var released handler.LockReleaseReply
+	if err := reply.Interface(&released); err != nil {
+		return false, fmt.Errorf("reply.Interface: %w", err)
+	}
+	return released.Released, nil
+}
+
+// LockStatus returns whether the named lock is held and by which service
+func (c *Client) LockStatus(name string) (handler.LockStatusReply, error) {
+	var status handler.LockStatusReply
+	reply, err := c.request(handler.LockStatus, handler.LockRequest{Name: name})
+	if err != nil {
+		return status, err
+	}
+	if err := reply.Interface(&status); err != nil {
+		return status, fmt.Errorf("reply.Interface: %w", err)
+	}
+	return status, nil
+}
+
+// Push adds the job with the payload to the queue, returns the job id.
+// The payload is encoded as JSON. The job is visible to the workers after the delay.
+func (c *Client) Push(queue string, payload interface{}, delay time.Duration) (uint64, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("json.Marshal: %w", err)
+	}
+	request := handler.QueuePushRequest{
+		Queue:   queue,
+		Payload: raw,
+		Delay:   uint64(delay / time.Second),
+	}
+	reply, err := c.request(handler.QueuePush, request)
+	if err != nil {
+		return 0, err
+	}
+	var pushed handler.QueuePushReply
+	if err := reply.Interface(&pushed); err != nil {
+		return 0, fmt.Errorf("reply.Interface: %w", err)
+	}
+	return pushed.JobId, nil
+}
+
+// Claim claims up to the limit jobs of the queue.
+// The jobs are invisible to the other workers for the visibility timeout,
+// call Ack after the job is processed or Nack if it failed.
+// If the visibility is zero, then the default of the extension.
+// The payload is the JSON text, decode it by handler.QueueJob.Decode.
+func (c *Client) Claim(queue string, limit uint64, visibility time.Duration) ([]handler.QueueJob, error) {
+	request := handler.QueueClaimRequest{
+		Queue:      queue,
+		Limit:      limit,
+		Visibility: uint64(visibility / time.Second),
+	}
+	reply, err := c.request(handler.QueueClaim, request)
+	if err != nil {
+		return nil, err
+	}
+	var claimed handler.QueueClaimReply
+	if err := reply.Interface(&claimed); err != nil {
+		return nil, fmt.Errorf("reply.Interface: %w", err)
+	}
+	return claimed.Jobs, nil
+}
+
+// Ack removes the processed job from the queue
+func (c *Client) Ack(job handler.QueueJob) error {
+	_, err := c.request(handler.QueueAck, handler.QueueAckRequest{JobId: job.JobId, ClaimToken: job.ClaimToken})
+	return err
+}
+
+// Nack returns the failed job to the queue after the delay.
+// After the last attempt, the job is dead-lettered. Returns the status of the job.
+func (c *Client) Nack(job handler.QueueJob, delay time.Duration, reason error) (string, error) {
+	request := handler.QueueAckRequest{
+		JobId:      job.JobId,
+		ClaimToken: job.ClaimToken,
+		Delay:      uint64(delay / time.Second),
+	}
+	if reason != nil {
+		request.Error = reason.Error()
+	}
+	reply, err := c.request(handler.QueueNack, request)
+	if err != nil {
+		return "", err
+	}
+	var nacked handler.QueueAckReply
+	if err := reply.Interface(&nacked); err != nil {
+		return "", fmt.Errorf("reply.Interface: %w", err)
+	}
+	return nacked.Status, nil
+}
+
+// ReplayOutbox publishes the outbox messages again, starting from the outbox id
+func (c *Client) ReplayOutbox(from uint64) error {
+	_, err := c.request(handler.OutboxReplay, handler.OutboxReplayRequest{From: from})
+	return err
+}
+
+// Begin starts the transaction.
+// The transaction is rolled back by the extension if it's not used within the timeout.
+func (c *Client) Begin() (*Tx, error) {
+	if len(c.transactionId) > 0 {
+		return nil, fmt.Errorf("the nested transactions are not supported")
+	}
+
+	reply, err := c.request(handler.TxBegin, key_value.Empty())
+	if err != nil {
+		return nil, err
+	}
+	id, err := reply.GetString("transaction_id")
+	if err != nil {
+		return nil, fmt.Errorf("reply.GetString: %w", err)
+	}
+
+	return &Tx{Client{socket: c.socket, transactionId: id}}, nil
+}
+
+// Transaction runs the function in the transaction.
+// The transaction is committed if the function succeeds, otherwise rolled back.
+func (c *Client) Transaction(run func(tx *Tx) error) error {
+	tx, err := c.Begin()
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+
+	if err := run(tx); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rollbackErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Id of the transaction
+func (tx *Tx) Id() string {
+	return tx.transactionId
+}
+
+// Commit the transaction
+func (tx *Tx) Commit() error {
+	_, err := tx.request(handler.TxCommit, handler.TxRequest{TransactionId: tx.transactionId})
+	return err
+}
+
+// Rollback the transaction
+func (tx *Tx) Rollback() error {
+	_, err := tx.request(handler.TxRollback, handler.TxRequest{TransactionId: tx.transactionId})
+	return err
+}
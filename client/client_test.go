@@ -0,0 +1,177 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/Seascape-Foundation/sds-common-lib/data_type/key_value"
+	"github.com/stretchr/testify/suite"
+)
+
+// Define the suite, and absorb the built-in basic suite
+// functionality from testify - including a T() method which
+// returns the current testing context
+type TestClientSuite struct {
+	suite.Suite
+}
+
+type event struct {
+	NetworkId   string                 `db:"network_id"`
+	BlockNumber uint64                 `db:"block_number"`
+	LogIndex    *int16                 `db:"log_index"`
+	Amount      *big.Int               `db:"amount"`
+	Parameters  map[string]interface{} `db:"event_parameters"`
+	Raw         json.RawMessage        `db:"raw,omitempty"`
+	CreatedAt   time.Time              `db:"created_at,omitempty"`
+	Ignored     string
+}
+
+func (suite *TestClientSuite) TestQuery() {
+	request, err := Table("smartcontract").
+		Set("abi_id", "abi_1").
+		Where("network_id = ?", "56").
+		Where("address = ?", "0xdead").
+		Request()
+	suite.Require().NoError(err)
+	suite.Require().Equal([]string{"smartcontract"}, request.Tables)
+	suite.Require().Equal([]string{"abi_id"}, request.Fields)
+	suite.Require().Equal("(network_id = ?) AND (address = ?)", request.Where)
+	suite.Require().Equal([]interface{}{"abi_1", "56", "0xdead"}, request.Arguments)
+
+	request, err = Table("smartcontract").Where("address IN (?)", []string{"0x1", "0x2"}).Where("abi_id = ?", []byte("a")).Request()
+	suite.Require().NoError(err)
+	suite.Require().Equal([]interface{}{[]interface{}{"0x1", "0x2"}, "sds_base64:YQ=="}, request.Arguments)
+
+	_, err = Table().Request()
+	suite.Require().Error(err)
+	_, err = Table("abi").Set("body", make(chan int)).Request()
+	suite.Require().Error(err)
+}
+
+func (suite *TestClientSuite) TestValues() {
+	amount, _ := new(big.Int).SetString("115792089237316195423570985008687907853269984665640564039457584007913129639935", 10)
+	row := event{
+		NetworkId:   "56",
+		BlockNumber: 18446744073709551615,
+		Amount:      amount,
+		Parameters:  map[string]interface{}{"from": "0x1"},
+		Ignored:     "ignored",
+	}
+
+	request, err := Table("indexer_event").Values(&row).Request()
+	suite.Require().NoError(err)
+	suite.Require().Equal([]string{"network_id", "block_number", "log_index", "amount", "event_parameters"}, request.Fields)
+	suite.Require().Equal([]interface{}{
+		"56",
+		uint64(18446744073709551615),
+		nil,
+		json.Number(amount.String()),
+		`sds_json:{"from":"0x1"}`,
+	}, request.Arguments)
+
+	// the precision is kept in the request message
+	raw, err := json.Marshal(request)
+	suite.Require().NoError(err)
+	suite.Require().Contains(string(raw), `18446744073709551615,null,`+amount.String()+`,`)
+
+	request, err = Table("abi").Values(map[string]interface{}{"body": json.RawMessage(`{}`), "abi_id": "abi_1"}).Request()
+	suite.Require().NoError(err)
+	suite.Require().Equal([]string{"abi_id", "body"}, request.Fields)
+	suite.Require().Equal([]interface{}{"abi_1", "sds_json:{}"}, request.Arguments)
+}
+
+func (suite *TestClientSuite) TestDecodeRows() {
+	reply, err := key_value.NewFromString(`{"rows":[
+{"network_id":"56","block_number":18446744073709551615,"log_index":3,"amount":115792089237316195423570985008687907853269984665640564039457584007913129639935,
+"event_parameters":"sds_json:{\"value\":12345678901234567890}","raw":"sds_json:[1,2]","created_at":"2023-03-08 17:10:23.5"},
+{"network_id":"1","block_number":1,"log_index":null,"amount":"0","event_parameters":"sds_json:","raw":"sds_json:"}
+]}`)
+	suite.Require().NoError(err)
+
+	var events []event
+	suite.Require().NoError(decodeRows(reply["rows"].([]interface{}), &events))
+	suite.Require().Len(events, 2)
+
+	first := events[0]
+	suite.Require().Equal("56", first.NetworkId)
+	suite.Require().Equal(uint64(18446744073709551615), first.BlockNumber)
+	suite.Require().Equal(int16(3), *first.LogIndex)
+	suite.Require().Equal("115792089237316195423570985008687907853269984665640564039457584007913129639935", first.Amount.String())
+	suite.Require().Equal(json.RawMessage(`[1,2]`), first.Raw)
+	suite.Require().Equal(time.Date(2023, 3, 8, 17, 10, 23, 500000000, time.UTC), first.CreatedAt)
+	suite.Require().EqualValues(12345678901234567890.0, first.Parameters["value"])
+
+	second := events[1]
+	suite.Require().Nil(second.LogIndex)
+	suite.Require().Equal(int64(0), second.Amount.Int64())
+	suite.Require().Nil(second.Parameters)
+	suite.Require().Empty(second.Raw)
+
+	// the rows decoded into the maps keep the json numbers
+	var rows []map[string]interface{}
+	suite.Require().NoError(decodeRows(reply["rows"].([]interface{}), &rows))
+	suite.Require().Equal(json.Number("18446744073709551615"), rows[0]["block_number"])
+}
+
+func (suite *TestClientSuite) TestDecodeRow() {
+	var abi struct {
+		Id   string `db:"abi_id"`
+		Body []byte `db:"body"`
+	}
+	err := decodeRow(map[string]interface{}{"abi_id": "abi_1", "body": `sds_json:{"a":1}`}, &abi)
+	suite.Require().NoError(err)
+	suite.Require().Equal("abi_1", abi.Id)
+	suite.Require().Equal([]byte(`{"a":1}`), abi.Body)
+
+	suite.Require().Error(decodeRow(map[string]interface{}{}, abi))
+	suite.Require().Error(decodeRow(map[string]interface{}{"abi_id": 1.5, "body": "x"}, &struct {
+		Id int `db:"abi_id"`
+	}{}))
+
+	// the native JSON columns
+	var native struct {
+		Raw    json.RawMessage        `db:"raw"`
+		Bytes  []byte                 `db:"bytes"`
+		Text   string                 `db:"text"`
+		Map    map[string]interface{} `db:"map"`
+		Scalar json.RawMessage        `db:"scalar"`
+	}
+	object := map[string]interface{}{"a": json.Number("12345678901234567890")}
+	err = decodeRow(map[string]interface{}{"raw": object, "bytes": []interface{}{1}, "text": object, "map": object, "scalar": "abc"}, &native)
+	suite.Require().NoError(err)
+	suite.Require().Equal(json.RawMessage(`{"a":12345678901234567890}`), native.Raw)
+	suite.Require().Equal([]byte(`[1]`), native.Bytes)
+	suite.Require().Equal(`{"a":12345678901234567890}`, native.Text)
+	suite.Require().Equal(object, native.Map)
+	suite.Require().Equal(json.RawMessage(`"abc"`), native.Scalar)
+}
+
+func (suite *TestClientSuite) TestConflict() {
+	suite.Require().NoError(conflictOf(key_value.Empty()))
+
+	reply, err := key_value.NewFromString(`{"conflict":true,"row":{"name":"indexer","version":12345678901234567890}}`)
+	suite.Require().NoError(err)
+	err = conflictOf(reply)
+	suite.Require().ErrorIs(err, ErrConflict)
+
+	var conflict *ConflictError
+	suite.Require().True(errors.As(err, &conflict))
+	suite.Require().Equal("indexer", conflict.Row["name"])
+	var row struct {
+		Name    string `db:"name"`
+		Version uint64 `db:"version"`
+	}
+	suite.Require().NoError(conflict.Decode(&row))
+	suite.Require().Equal(uint64(12345678901234567890), row.Version)
+
+	suite.Require().Error(conflictOf(key_value.Empty().Set("conflict", true).Set("row", "x")))
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestClient(t *testing.T) {
+	suite.Run(t, new(TestClientSuite))
+}
@@ -0,0 +1,232 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/Seascape-Foundation/mysql-seascape-extension/handler"
+	"github.com/Seascape-Foundation/sds-common-lib/data_type"
+	"github.com/Seascape-Foundation/sds-common-lib/data_type/key_value"
+)
+
+// timeLayouts are the formats of the mysql DATE, DATETIME and TIMESTAMP values
+var timeLayouts = []string{
+	TimeLayout,
+	time.RFC3339Nano,
+	"2006-01-02",
+}
+
+// decodeRows decodes the rows of the select reply into the pointer to the slice of structs or maps
+func decodeRows(rows []interface{}, dest interface{}) error {
+	reflected := reflect.ValueOf(dest)
+	if reflected.Kind() != reflect.Ptr || reflected.IsNil() || reflected.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("dest should be a pointer to the slice, not %T", dest)
+	}
+	slice := reflected.Elem()
+	decoded := reflect.MakeSlice(slice.Type(), len(rows), len(rows))
+
+	for i, row := range rows {
+		if err := decodeValue(decoded.Index(i), row); err != nil {
+			return fmt.Errorf("row %d: %w", i, err)
+		}
+	}
+	slice.Set(decoded)
+
+	return nil
+}
+
+// decodeRow decodes the row of the select reply into the pointer to the struct or the map
+func decodeRow(row interface{}, dest interface{}) error {
+	reflected := reflect.ValueOf(dest)
+	if reflected.Kind() != reflect.Ptr || reflected.IsNil() {
+		return fmt.Errorf("dest should be a pointer, not %T", dest)
+	}
+
+	return decodeValue(reflected.Elem(), row)
+}
+
+// decodeValue sets the value returned by the extension into the target.
+//
+// The struct fields are matched to the columns by the `db` tag.
+// The JSON prefixed strings are decoded into the bytes, or unmarshalled into the maps, slices and structs.
+// The numbers are decoded from json.Number without losing the precision.
+func decodeValue(target reflect.Value, value interface{}) error {
+	if value == nil {
+		target.Set(reflect.Zero(target.Type()))
+		return nil
+	}
+
+	// the JSON and binary columns are returned as the prefixed strings
+	if str, ok := value.(string); ok && data_type.IsJsonPrefixed(str) {
+		return decodeRaw(target, []byte(data_type.DecodeJsonPrefixed(str)))
+	}
+	if str, ok := value.(string); ok {
+		raw, prefixed, err := handler.DecodeBase64Prefixed(str)
+		if err != nil {
+			return err
+		}
+		if prefixed {
+			return decodeRaw(target, raw)
+		}
+	}
+	if kv, ok := value.(key_value.KeyValue); ok {
+		value = kv.Map()
+	}
+	if reflected := reflect.ValueOf(value); reflected.Type().AssignableTo(target.Type()) {
+		target.Set(reflected)
+		return nil
+	}
+
+	switch target.Type() {
+	case timeType:
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("time expected as string, not %T", value)
+		}
+		parsed, err := parseTime(str)
+		if err != nil {
+			return err
+		}
+		target.Set(reflect.ValueOf(parsed))
+		return nil
+	case bigIntType:
+		number, ok := new(big.Int).SetString(fmt.Sprint(value), 10)
+		if !ok {
+			return fmt.Errorf("'%v' is not an integer", value)
+		}
+		target.Set(reflect.ValueOf(*number))
+		return nil
+	}
+
+	switch target.Kind() {
+	case reflect.Ptr:
+		element := reflect.New(target.Type().Elem())
+		if err := decodeValue(element.Elem(), value); err != nil {
+			return err
+		}
+		target.Set(element)
+		return nil
+	case reflect.String:
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			// the JSON column
+			return decodeJson(target, value)
+		}
+		target.SetString(fmt.Sprint(value))
+		return nil
+	case reflect.Bool:
+		switch v := value.(type) {
+		case bool:
+			target.SetBool(v)
+		default:
+			parsed, err := strconv.ParseBool(fmt.Sprint(v))
+			if err != nil {
+				return fmt.Errorf("strconv.ParseBool: %w", err)
+			}
+			target.SetBool(parsed)
+		}
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(fmt.Sprint(value), 10, target.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("strconv.ParseInt: %w", err)
+		}
+		target.SetInt(parsed)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(fmt.Sprint(value), 10, target.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("strconv.ParseUint: %w", err)
+		}
+		target.SetUint(parsed)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(fmt.Sprint(value), target.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("strconv.ParseFloat: %w", err)
+		}
+		target.SetFloat(parsed)
+		return nil
+	case reflect.Struct:
+		row, ok := value.(map[string]interface{})
+		if !ok {
+			return decodeJson(target, value)
+		}
+		for _, column := range columns(target.Type()) {
+			columnValue, ok := row[column.name]
+			if !ok {
+				continue
+			}
+			if err := decodeValue(target.Field(column.index), columnValue); err != nil {
+				return fmt.Errorf("column '%s': %w", column.name, err)
+			}
+		}
+		return nil
+	case reflect.Map, reflect.Slice, reflect.Array:
+		if target.Kind() == reflect.Slice && target.Type().Elem().Kind() == reflect.Uint8 {
+			if str, ok := value.(string); ok && target.Type() != rawMessageType {
+				target.SetBytes([]byte(str))
+				return nil
+			}
+			// the JSON column
+			return decodeJson(target, value)
+		}
+		return decodeJson(target, value)
+	}
+
+	return fmt.Errorf("unsupported target type %s", target.Type())
+}
+
+// decodeRaw sets the binary or JSON column into the target
+func decodeRaw(target reflect.Value, raw []byte) error {
+	if target.Kind() == reflect.Ptr {
+		element := reflect.New(target.Type().Elem())
+		if err := decodeRaw(element.Elem(), raw); err != nil {
+			return err
+		}
+		target.Set(element)
+		return nil
+	}
+
+	switch {
+	case target.Kind() == reflect.Slice && target.Type().Elem().Kind() == reflect.Uint8:
+		bytes := make([]byte, len(raw))
+		copy(bytes, raw)
+		target.SetBytes(bytes)
+		return nil
+	case target.Kind() == reflect.String:
+		target.SetString(string(raw))
+		return nil
+	case len(raw) == 0:
+		target.Set(reflect.Zero(target.Type()))
+		return nil
+	}
+
+	if err := json.Unmarshal(raw, target.Addr().Interface()); err != nil {
+		return fmt.Errorf("json.Unmarshal: %w", err)
+	}
+	return nil
+}
+
+// decodeJson converts the already decoded JSON value into the target
+func decodeJson(target reflect.Value, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+	return decodeRaw(target, raw)
+}
+
+func parseTime(value string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		parsed, err := time.Parse(layout, value)
+		if err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("'%s' is not a time", value)
+}
@@ -0,0 +1,186 @@
+package client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Seascape-Foundation/mysql-seascape-extension/handler"
+	"github.com/Seascape-Foundation/sds-common-lib/data_type"
+)
+
+// TimeLayout is the format of the time arguments, accepted by the mysql DATETIME and TIMESTAMP columns
+const TimeLayout = "2006-01-02 15:04:05.999999"
+
+// Tag is the struct tag with the column name
+const Tag = "db"
+
+var (
+	timeType   = reflect.TypeOf(time.Time{})
+	bigIntType = reflect.TypeOf(big.Int{})
+	// rawMessageType is decoded from the JSON values, rather than the strings
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// encodeArgument converts the value into the type that passes through the extension without losses.
+//
+// The binary values are prefixed as the extension expects (see handler.DatabaseQueryRequest.DeserializeBytes).
+// The maps, slices and structs are encoded as JSON for the JSON columns.
+// The big numbers are sent as the JSON numbers.
+func encodeArgument(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		if v == nil {
+			return nil, nil
+		}
+		return handler.Base64Prefix + base64.StdEncoding.EncodeToString(v), nil
+	case json.RawMessage:
+		if v == nil {
+			return nil, nil
+		}
+		return data_type.AddJsonPrefix(v), nil
+	case *big.Int:
+		if v == nil {
+			return nil, nil
+		}
+		return json.Number(v.String()), nil
+	case big.Int:
+		return json.Number(v.String()), nil
+	case time.Time:
+		return v.UTC().Format(TimeLayout), nil
+	case string, bool, json.Number,
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64:
+		return v, nil
+	}
+
+	reflected := reflect.ValueOf(value)
+	switch reflected.Kind() {
+	case reflect.Ptr:
+		if reflected.IsNil() {
+			return nil, nil
+		}
+		return encodeArgument(reflected.Elem().Interface())
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+		bytes, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("json.Marshal: %w", err)
+		}
+		return data_type.AddJsonPrefix(bytes), nil
+	case reflect.String:
+		return reflected.String(), nil
+	case reflect.Bool:
+		return reflected.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return reflected.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return reflected.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return reflected.Float(), nil
+	}
+
+	return nil, fmt.Errorf("unsupported argument %v of %T type", value, value)
+}
+
+// encodeWhereArgument converts the value into the argument of the where clause.
+// The slices and the arrays, except the bytes, are the lists of the arguments.
+func encodeWhereArgument(value interface{}) (interface{}, error) {
+	reflected := reflect.ValueOf(value)
+	if reflected.Kind() != reflect.Slice && reflected.Kind() != reflect.Array {
+		return encodeArgument(value)
+	}
+	if reflected.Type().Elem().Kind() == reflect.Uint8 {
+		return encodeArgument(value)
+	}
+
+	list := make([]interface{}, reflected.Len())
+	for i := range list {
+		encoded, err := encodeArgument(reflected.Index(i).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		list[i] = encoded
+	}
+	return list, nil
+}
+
+// column of the struct field
+type column struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+// columns returns the fields of the struct type that have the `db` tag
+func columns(structType reflect.Type) []column {
+	list := make([]column, 0, structType.NumField())
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		tag, ok := field.Tag.Lookup(Tag)
+		if !ok || !field.IsExported() {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		if parts[0] == "-" || len(parts[0]) == 0 {
+			continue
+		}
+		list = append(list, column{
+			name:      parts[0],
+			index:     i,
+			omitEmpty: len(parts) > 1 && parts[1] == "omitempty",
+		})
+	}
+	return list
+}
+
+// encodeRow returns the fields and their values of the struct or the map
+func encodeRow(row interface{}) ([]string, []interface{}, error) {
+	reflected := reflect.ValueOf(row)
+	for reflected.Kind() == reflect.Ptr {
+		if reflected.IsNil() {
+			return nil, nil, fmt.Errorf("row is nil")
+		}
+		reflected = reflected.Elem()
+	}
+
+	fields := make([]string, 0)
+	values := make([]interface{}, 0)
+
+	switch reflected.Kind() {
+	case reflect.Map:
+		if reflected.Type().Key().Kind() != reflect.String {
+			return nil, nil, fmt.Errorf("the map key should be string, not %s", reflected.Type().Key())
+		}
+		keys := reflected.MapKeys()
+		names := make([]string, len(keys))
+		for i, key := range keys {
+			names[i] = key.String()
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fields = append(fields, name)
+			values = append(values, reflected.MapIndex(reflect.ValueOf(name).Convert(reflected.Type().Key())).Interface())
+		}
+	case reflect.Struct:
+		for _, column := range columns(reflected.Type()) {
+			value := reflected.Field(column.index)
+			if column.omitEmpty && value.IsZero() {
+				continue
+			}
+			fields = append(fields, column.name)
+			values = append(values, value.Interface())
+		}
+	default:
+		return nil, nil, fmt.Errorf("row should be a struct or a map, not %T", row)
+	}
+
+	return fields, values, nil
+}
@@ -0,0 +1,396 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Seascape-Foundation/mysql-seascape-extension/handler"
+)
+
+// Query is the fluent builder of the database request.
+//
+// Example:
+//
+//	query := client.Table("smartcontract").
+//		Fields("network_id", "address", "abi_id").
+//		Where("network_id = ?", "56").
+//		Where("block_number > ?", 100)
+type Query struct {
+	tables    []string
+	joins     []handler.Join
+	fields    []string
+	where     string
+	whereArgs []interface{}
+	values    []interface{} // values of the fields for the insert and the update
+	filters   []handler.JsonFilter
+	patches   []handler.JsonPatch
+	// the atomic changes of the fields in the update
+	operations []handler.FieldOperation
+	expect     *handler.Expectation
+	rowLock    *handler.RowLock
+	outbox     []handler.OutboxMessage
+	// the aggregations, see Client.Aggregate
+	aggregations []handler.Aggregation
+	groupBy      []string
+	having       []handler.HavingCondition
+	orderBy      []string
+	limit        uint64
+	allRows      bool
+	err          error
+}
+
+// Table starts the query on the tables
+func Table(tables ...string) *Query {
+	return &Query{
+		tables:    tables,
+		fields:    make([]string, 0),
+		whereArgs: make([]interface{}, 0),
+		values:    make([]interface{}, 0),
+	}
+}
+
+// Join the table, which column equals to the column of the tables joined before.
+//
+// Example:
+//
+//	client.Table("smartcontract").
+//		Join("abi", "smartcontract.abi_id", "abi.abi_id").
+//		Fields("smartcontract.address", "abi.body")
+func (q *Query) Join(table string, left string, right string) *Query {
+	return q.JoinWith(handler.Join{Type: handler.InnerJoin, Table: table, On: []handler.JoinOn{{Left: left, Right: right}}})
+}
+
+// LeftJoin the table, keeping the rows that have no joined row
+func (q *Query) LeftJoin(table string, left string, right string) *Query {
+	return q.JoinWith(handler.Join{Type: handler.LeftJoin, Table: table, On: []handler.JoinOn{{Left: left, Right: right}}})
+}
+
+// JoinWith adds the join with the alias or the multiple columns
+func (q *Query) JoinWith(join handler.Join) *Query {
+	q.joins = append(q.joins, join)
+	return q
+}
+
+// Fields sets the fields to select
+func (q *Query) Fields(fields ...string) *Query {
+	q.fields = append(q.fields, fields...)
+	return q
+}
+
+// Where adds the condition with its arguments.
+// The multiple conditions are joined by AND.
+//
+// The slice argument is the list, that the extension expands into the placeholders:
+//
+//	q.Where("address IN (?)", []string{"0x1", "0x2"})
+func (q *Query) Where(condition string, arguments ...interface{}) *Query {
+	if len(q.where) == 0 {
+		q.where = condition
+	} else {
+		q.where = "(" + q.where + ") AND (" + condition + ")"
+	}
+
+	for _, argument := range arguments {
+		encoded, err := encodeWhereArgument(argument)
+		if err != nil && q.err == nil {
+			q.err = fmt.Errorf("where argument of '%s': %w", condition, err)
+		}
+		q.whereArgs = append(q.whereArgs, encoded)
+	}
+	return q
+}
+
+// WhereJson adds the condition on the value at the path of the JSON column.
+// The operator is "=", "!=", "<", "<=", ">", ">=" or "contains".
+//
+// Example:
+//
+//	client.Table("indexer_event").WhereJson("event_parameters", "$.to", "=", address)
+func (q *Query) WhereJson(column string, path string, operator string, value interface{}) *Query {
+	if err := handler.ValidateJsonPath(path, true); err != nil && q.err == nil {
+		q.err = err
+	}
+	q.filters = append(q.filters, handler.JsonFilter{
+		Column:   column,
+		Path:     path,
+		Operator: operator,
+		Value:    value,
+	})
+	return q
+}
+
+// JsonSet sets the value at the path of the JSON column in the update,
+// keeping the rest of the document.
+func (q *Query) JsonSet(column string, path string, value interface{}) *Query {
+	if err := handler.ValidateJsonPath(path, false); err != nil && q.err == nil {
+		q.err = err
+	}
+	patch := q.patch(column)
+	patch.Set = append(patch.Set, handler.JsonPathValue{Path: path, Value: value})
+	return q
+}
+
+// JsonRemove removes the paths of the JSON column in the update
+func (q *Query) JsonRemove(column string, paths ...string) *Query {
+	for _, path := range paths {
+		if err := handler.ValidateJsonPath(path, false); err != nil && q.err == nil {
+			q.err = err
+		}
+	}
+	patch := q.patch(column)
+	patch.Remove = append(patch.Remove, paths...)
+	return q
+}
+
+// patch returns the patch of the column, adding it if it doesn't exist
+func (q *Query) patch(column string) *handler.JsonPatch {
+	for i := range q.patches {
+		if q.patches[i].Column == column {
+			return &q.patches[i]
+		}
+	}
+	q.patches = append(q.patches, handler.JsonPatch{Column: column})
+	return &q.patches[len(q.patches)-1]
+}
+
+// Increment adds the value to the field in the update. The null field is treated as zero.
+func (q *Query) Increment(field string, value interface{}) *Query {
+	return q.operation(field, handler.IncrementOperation, value)
+}
+
+// Decrement subtracts the value from the field in the update. The null field is treated as zero.
+func (q *Query) Decrement(field string, value interface{}) *Query {
+	return q.operation(field, handler.DecrementOperation, value)
+}
+
+// Greatest sets the field to the value in the update, if the value is greater.
+//
+// Example, advance the checkpoint monotonically:
+//
+//	client.Table("indexer_smartcontract").
+//		Greatest("block_number", blockNumber).
+//		Where("network_id = ? AND address = ?", networkId, address)
+func (q *Query) Greatest(field string, value interface{}) *Query {
+	return q.operation(field, handler.GreatestOperation, value)
+}
+
+// Least sets the field to the value in the update, if the value is less
+func (q *Query) Least(field string, value interface{}) *Query {
+	return q.operation(field, handler.LeastOperation, value)
+}
+
+// SetNull sets the field to null in the update
+func (q *Query) SetNull(field string) *Query {
+	return q.operation(field, handler.SetNullOperation, nil)
+}
+
+// SetNow sets the field to the current time of the database in the update
+func (q *Query) SetNow(field string) *Query {
+	return q.operation(field, handler.SetNowOperation, nil)
+}
+
+func (q *Query) operation(field string, operation string, value interface{}) *Query {
+	q.operations = append(q.operations, handler.FieldOperation{
+		Field:     field,
+		Operation: operation,
+		Value:     value,
+	})
+	return q
+}
+
+// Expect updates the row only if the column has the value.
+// Otherwise, Client.Update returns *ConflictError with the current row.
+func (q *Query) Expect(column string, value interface{}) *Query {
+	q.expect = &handler.Expectation{Column: column, Value: value}
+	return q
+}
+
+// ExpectVersion updates the row only if the version column has the value,
+// and increments the version.
+//
+// Example:
+//
+//	client.Table("configuration").
+//		Set("value", value).
+//		Where("name = ?", name).
+//		ExpectVersion("version", version)
+func (q *Query) ExpectVersion(column string, version interface{}) *Query {
+	q.expect = &handler.Expectation{Column: column, Value: version, Increment: true}
+	return q
+}
+
+// Aggregate adds the aggregate function on the column.
+// The function is one of handler.CountFunction, handler.SumFunction and the rest.
+// The alias is the name of the result, if it's empty, then "function_column".
+func (q *Query) Aggregate(function string, column string, alias string) *Query {
+	q.aggregations = append(q.aggregations, handler.Aggregation{
+		Function: function,
+		Column:   column,
+		Alias:    alias,
+	})
+	return q
+}
+
+// GroupBy groups the aggregations by the columns
+func (q *Query) GroupBy(columns ...string) *Query {
+	q.groupBy = append(q.groupBy, columns...)
+	return q
+}
+
+// Having adds the condition on the aggregation alias or the GroupBy column.
+// The operator is "=", "!=", "<", "<=", ">" or ">=".
+// The multiple conditions are joined by AND.
+//
+// Example:
+//
+//	client.Table("indexer_event").GroupBy("address").Aggregate(handler.CountFunction, "", "").Having("count", ">", 10)
+func (q *Query) Having(column string, operator string, value interface{}) *Query {
+	encoded, err := encodeArgument(value)
+	if err != nil && q.err == nil {
+		q.err = fmt.Errorf("having value of '%s': %w", column, err)
+	}
+	q.having = append(q.having, handler.HavingCondition{
+		Column:   column,
+		Operator: operator,
+		Value:    encoded,
+	})
+	return q
+}
+
+// OrderBy sets the order of the selected or the deleted rows.
+// The column could be followed by ASC or DESC, for example "block_number DESC".
+func (q *Query) OrderBy(columns ...string) *Query {
+	q.orderBy = append(q.orderBy, columns...)
+	return q
+}
+
+// Limit sets the maximum amount of the selected or the deleted rows
+func (q *Query) Limit(limit uint64) *Query {
+	q.limit = limit
+	return q
+}
+
+// AllRows confirms that the chunked delete without the Where condition deletes all rows
+func (q *Query) AllRows() *Query {
+	q.allRows = true
+	return q
+}
+
+// ForUpdate locks the selected rows for the update until the end of the transaction.
+// The query must be sent through Tx.
+//
+// Example, claim the pending task that isn't claimed by another worker:
+//
+//	tx.SelectOne(client.Table("task").
+//		Where("status = ?", "pending").
+//		OrderBy("task_id").
+//		ForUpdate().
+//		SkipLocked(), &task)
+func (q *Query) ForUpdate() *Query {
+	q.lock().Mode = handler.LockForUpdate
+	return q
+}
+
+// ForShare locks the selected rows against the updates until the end of the transaction.
+// The query must be sent through Tx.
+func (q *Query) ForShare() *Query {
+	q.lock().Mode = handler.LockForShare
+	return q
+}
+
+// NoWait fails the locking query, if the rows are locked by another transaction
+func (q *Query) NoWait() *Query {
+	q.lock().NoWait = true
+	return q
+}
+
+// SkipLocked skips the rows locked by another transaction
+func (q *Query) SkipLocked() *Query {
+	q.lock().SkipLocked = true
+	return q
+}
+
+// lock returns the row lock, adding it if it doesn't exist
+func (q *Query) lock() *handler.RowLock {
+	if q.rowLock == nil {
+		q.rowLock = &handler.RowLock{}
+	}
+	return q.rowLock
+}
+
+// Publish adds the message to the outbox along with the insert, the update or the delete.
+// The payload is encoded as JSON. The message is published by the outbox relay
+// after the write is committed, if the write changed any rows.
+func (q *Query) Publish(topic string, payload interface{}) *Query {
+	raw, err := json.Marshal(payload)
+	if err != nil && q.err == nil {
+		q.err = fmt.Errorf("outbox payload of '%s': %w", topic, err)
+	}
+	q.outbox = append(q.outbox, handler.OutboxMessage{Topic: topic, Payload: raw})
+	return q
+}
+
+// Set the value of the field for the insert or the update
+func (q *Query) Set(field string, value interface{}) *Query {
+	encoded, err := encodeArgument(value)
+	if err != nil && q.err == nil {
+		q.err = fmt.Errorf("value of '%s' field: %w", field, err)
+	}
+	q.fields = append(q.fields, field)
+	q.values = append(q.values, encoded)
+	return q
+}
+
+// Values sets the fields of the struct or the map for the insert or the update.
+//
+// The fields of the struct are named by the `db` tag.
+// The fields without the tag are skipped, as well as
+// the zero fields with the "omitempty" option.
+func (q *Query) Values(row interface{}) *Query {
+	fields, values, err := encodeRow(row)
+	if err != nil {
+		if q.err == nil {
+			q.err = fmt.Errorf("encodeRow: %w", err)
+		}
+		return q
+	}
+	for i, field := range fields {
+		q.Set(field, values[i])
+	}
+	return q
+}
+
+// Request returns the database request of the query.
+// The values of the fields are followed by the arguments of the where clause.
+func (q *Query) Request() (handler.DatabaseQueryRequest, error) {
+	if q.err != nil {
+		return handler.DatabaseQueryRequest{}, q.err
+	}
+	if len(q.tables) == 0 {
+		return handler.DatabaseQueryRequest{}, fmt.Errorf("missing table")
+	}
+
+	arguments := make([]interface{}, 0, len(q.values)+len(q.whereArgs))
+	arguments = append(arguments, q.values...)
+	arguments = append(arguments, q.whereArgs...)
+
+	return handler.DatabaseQueryRequest{
+		Fields:       q.fields,
+		Tables:       q.tables,
+		Joins:        q.joins,
+		Where:        q.where,
+		Arguments:    arguments,
+		JsonFilters:  q.filters,
+		JsonPatches:  q.patches,
+		Operations:   q.operations,
+		Expect:       q.expect,
+		Aggregations: q.aggregations,
+		GroupBy:      q.groupBy,
+		Having:       q.having,
+		OrderBy:      q.orderBy,
+		Limit:        q.limit,
+		AllRows:      q.allRows,
+		Lock:         q.rowLock,
+		Outbox:       q.outbox,
+	}, nil
+}
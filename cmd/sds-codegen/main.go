@@ -0,0 +1,187 @@
+// The sds-codegen generates the Go row structs, the table and column name constants
+// and the typed client helpers of the database tables.
+//
+// The tables are read from the live database:
+//
+//	sds-codegen -dsn "root:tiger@tcp(localhost:3306)/sds_dev" -package tables -out tables_gen.go
+//
+// Or from the migrations, that are applied to the temporary database on the same server:
+//
+//	sds-codegen -dsn "root:tiger@tcp(localhost:3306)/" -migrations ./_db/migrations -package tables -out tables_gen.go
+//
+// It's intended to be called by go generate:
+//
+//	//go:generate go run github.com/Seascape-Foundation/mysql-seascape-extension/cmd/sds-codegen -dsn $SDS_CODEGEN_DSN -package tables -out tables_gen.go
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Seascape-Foundation/mysql-seascape-extension/codegen"
+	"github.com/Seascape-Foundation/mysql-seascape-extension/schema"
+	"github.com/go-sql-driver/mysql"
+	"github.com/pressly/goose/v3"
+)
+
+func main() {
+	dsn := flag.String("dsn", os.Getenv("SDS_CODEGEN_DSN"), "mysql data source name, for example root:tiger@tcp(localhost:3306)/sds_dev")
+	migrations := flag.String("migrations", "", "directory of the goose migrations. If set, the migrations are applied to the temporary database instead of reading the live schema")
+	packageName := flag.String("package", "tables", "package name of the generated file")
+	out := flag.String("out", "", "output file. If empty, then prints to stdout")
+	only := flag.String("tables", "", "comma separated tables to generate. If empty, then all tables except the goose version table and the extension's own tables")
+	flag.Parse()
+
+	if err := run(*dsn, *migrations, *packageName, *out, *only); err != nil {
+		fmt.Fprintln(os.Stderr, "sds-codegen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(dsn string, migrations string, packageName string, out string, only string) error {
+	if len(dsn) == 0 {
+		return fmt.Errorf("missing -dsn or SDS_CODEGEN_DSN")
+	}
+	config, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return fmt.Errorf("mysql.ParseDSN: %w", err)
+	}
+
+	var tables []schema.Table
+	var source string
+	if len(migrations) > 0 {
+		tables, err = loadMigrations(config, migrations)
+		source = migrations
+	} else {
+		tables, err = loadLive(config)
+		source = "the " + config.DBName + " database"
+	}
+	if err != nil {
+		return err
+	}
+
+	tables = filter(tables, only)
+	if len(tables) == 0 {
+		return fmt.Errorf("no tables to generate")
+	}
+
+	generated, err := codegen.Generate(packageName, source, tables)
+	if err != nil {
+		return fmt.Errorf("codegen.Generate: %w", err)
+	}
+
+	if len(out) == 0 {
+		_, err = os.Stdout.Write(generated)
+		return err
+	}
+	if err := os.WriteFile(out, generated, 0644); err != nil {
+		return fmt.Errorf("os.WriteFile: %w", err)
+	}
+	return nil
+}
+
+// loadLive returns the tables of the database in the data source name
+func loadLive(config *mysql.Config) ([]schema.Table, error) {
+	if len(config.DBName) == 0 {
+		return nil, fmt.Errorf("the database name is missing in -dsn")
+	}
+
+	connection, err := sql.Open("mysql", config.FormatDSN())
+	if err != nil {
+		return nil, fmt.Errorf("sql.Open: %w", err)
+	}
+	defer func() {
+		_ = connection.Close()
+	}()
+
+	tables, err := schema.Load(connection, config.DBName)
+	if err != nil {
+		return nil, fmt.Errorf("schema.Load: %w", err)
+	}
+	return tables, nil
+}
+
+// loadMigrations applies the migrations to the temporary database, and returns its tables.
+// The temporary database is dropped afterwards.
+func loadMigrations(config *mysql.Config, dir string) ([]schema.Table, error) {
+	scratchName := fmt.Sprintf("sds_codegen_%d", time.Now().UnixNano())
+
+	serverConfig := config.Clone()
+	serverConfig.DBName = ""
+	server, err := sql.Open("mysql", serverConfig.FormatDSN())
+	if err != nil {
+		return nil, fmt.Errorf("sql.Open: %w", err)
+	}
+	defer func() {
+		_ = server.Close()
+	}()
+
+	if _, err := server.Exec("CREATE DATABASE `" + scratchName + "`"); err != nil {
+		return nil, fmt.Errorf("create temporary database: %w", err)
+	}
+	defer func() {
+		if _, err := server.Exec("DROP DATABASE `" + scratchName + "`"); err != nil {
+			fmt.Fprintln(os.Stderr, "sds-codegen: failed to drop the temporary database", scratchName, err)
+		}
+	}()
+
+	scratchConfig := config.Clone()
+	scratchConfig.DBName = scratchName
+	scratch, err := sql.Open("mysql", scratchConfig.FormatDSN())
+	if err != nil {
+		return nil, fmt.Errorf("sql.Open: %w", err)
+	}
+	defer func() {
+		_ = scratch.Close()
+	}()
+
+	goose.SetLogger(goose.NopLogger())
+	if err := goose.SetDialect("mysql"); err != nil {
+		return nil, fmt.Errorf("goose.SetDialect: %w", err)
+	}
+	if err := goose.Up(scratch, dir); err != nil {
+		return nil, fmt.Errorf("goose.Up: %w", err)
+	}
+
+	tables, err := schema.Load(scratch, scratchName)
+	if err != nil {
+		return nil, fmt.Errorf("schema.Load: %w", err)
+	}
+	return tables, nil
+}
+
+// extensionTables are created by the migrations of the extension itself,
+// the services access them through the extension's commands, not as the rows.
+var extensionTables = map[string]bool{
+	"queue_job": true,
+	"outbox":    true,
+	"audit_log": true,
+}
+
+// filter returns the listed tables.
+// If the list is empty, then returns all tables except the goose version table and the extensionTables.
+func filter(tables []schema.Table, only string) []schema.Table {
+	names := make(map[string]bool)
+	for _, name := range strings.Split(only, ",") {
+		name = strings.TrimSpace(name)
+		if len(name) > 0 {
+			names[name] = true
+		}
+	}
+
+	filtered := make([]schema.Table, 0, len(tables))
+	for _, table := range tables {
+		if len(names) > 0 && !names[table.Name] {
+			continue
+		}
+		if len(names) == 0 && (table.Name == goose.TableName() || extensionTables[table.Name]) {
+			continue
+		}
+		filtered = append(filtered, table)
+	}
+	return filtered
+}
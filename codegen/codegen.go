@@ -0,0 +1,232 @@
+// Package codegen generates the Go row structs, the table and column name constants
+// and the typed client helpers from the database schema.
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/Seascape-Foundation/mysql-seascape-extension/schema"
+)
+
+// field of the generated struct
+type field struct {
+	Name   string // go name
+	Column string
+	Type   string
+}
+
+// table of the generated file
+type table struct {
+	Name   string // go name
+	Table  string
+	Fields []field
+}
+
+// file is the data of the template
+type file struct {
+	Package string
+	Source  string
+	Std     []string // standard library imports
+	Imports []string
+	Tables  []table
+}
+
+var fileTemplate = template.Must(template.New("file").Parse(`// Code generated by sds-codegen from {{.Source}}. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .Std}}
+	"{{.}}"
+{{- end}}
+{{if .Std}}
+{{end}}
+{{- range .Imports}}
+	"{{.}}"
+{{- end}}
+)
+{{range $table := .Tables}}
+// {{$table.Name}}Table is the name of the {{$table.Table}} table
+const {{$table.Name}}Table = "{{$table.Table}}"
+
+// The columns of the {{$table.Table}} table
+const (
+{{- range $table.Fields}}
+	{{$table.Name}}Column{{.Name}} = "{{.Column}}"
+{{- end}}
+)
+
+// {{$table.Name}}Columns lists all columns of the {{$table.Table}} table
+var {{$table.Name}}Columns = []string{
+{{- range $table.Fields}}
+	{{$table.Name}}Column{{.Name}},
+{{- end}}
+}
+
+// {{$table.Name}} is the row of the {{$table.Table}} table
+type {{$table.Name}} struct {
+{{- range $table.Fields}}
+	{{.Name}} {{.Type}} ` + "`db:\"{{.Column}}\"`" + `
+{{- end}}
+}
+
+// {{$table.Name}}Query starts the query on the {{$table.Table}} table
+func {{$table.Name}}Query() *client.Query {
+	return client.Table({{$table.Name}}Table)
+}
+
+// Select{{$table.Name}} returns the rows of the {{$table.Table}} table matching the query
+func Select{{$table.Name}}(c *client.Client, q *client.Query) ([]{{$table.Name}}, error) {
+	var rows []{{$table.Name}}
+	if err := c.Select(q.Fields({{$table.Name}}Columns...), &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// SelectOne{{$table.Name}} returns the first row of the {{$table.Table}} table matching the query
+func SelectOne{{$table.Name}}(c *client.Client, q *client.Query) (*{{$table.Name}}, error) {
+	var row {{$table.Name}}
+	if err := c.SelectOne(q.Fields({{$table.Name}}Columns...), &row); err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// Insert{{$table.Name}} inserts the row into the {{$table.Table}} table
+func Insert{{$table.Name}}(c *client.Client, row *{{$table.Name}}) error {
+	return c.Insert({{$table.Name}}Query().Values(row))
+}
+{{end}}`))
+
+// Generate returns the formatted Go source of the tables.
+// The source is the description of the schema origin, written in the header.
+func Generate(packageName string, source string, tables []schema.Table) ([]byte, error) {
+	data := file{
+		Package: packageName,
+		Source:  source,
+		Tables:  make([]table, len(tables)),
+	}
+	imports := map[string]bool{
+		"github.com/Seascape-Foundation/mysql-seascape-extension/client": true,
+	}
+
+	for i, schemaTable := range tables {
+		generated := table{
+			Name:   GoName(schemaTable.Name),
+			Table:  schemaTable.Name,
+			Fields: make([]field, len(schemaTable.Columns)),
+		}
+		for j, column := range schemaTable.Columns {
+			goType, typeImport := GoType(column)
+			if len(typeImport) > 0 {
+				imports[typeImport] = true
+			}
+			generated.Fields[j] = field{
+				Name:   GoName(column.Name),
+				Column: column.Name,
+				Type:   goType,
+			}
+		}
+		data.Tables[i] = generated
+	}
+
+	for path := range imports {
+		if strings.Contains(path, ".") {
+			data.Imports = append(data.Imports, path)
+		} else {
+			data.Std = append(data.Std, path)
+		}
+	}
+	sort.Strings(data.Std)
+	sort.Strings(data.Imports)
+
+	var buffer bytes.Buffer
+	if err := fileTemplate.Execute(&buffer, data); err != nil {
+		return nil, fmt.Errorf("fileTemplate.Execute: %w", err)
+	}
+	formatted, err := format.Source(buffer.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format.Source: %w", err)
+	}
+
+	return formatted, nil
+}
+
+// GoName converts the snake case name into the exported Go name.
+// For example, "network_id" becomes "NetworkId".
+func GoName(name string) string {
+	var builder strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool {
+		return r == '_' || r == '-' || r == ' '
+	}) {
+		builder.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+
+	goName := builder.String()
+	if len(goName) == 0 || (goName[0] >= '0' && goName[0] <= '9') {
+		goName = "X" + goName
+	}
+	return goName
+}
+
+// GoType returns the Go type of the column, and the import path required by the type.
+// The nullable columns are pointers, except the slices.
+func GoType(column schema.Column) (string, string) {
+	goType, typeImport := baseType(column)
+	if column.Nullable && !strings.HasPrefix(goType, "[]") && goType != "json.RawMessage" && !strings.HasPrefix(goType, "*") {
+		goType = "*" + goType
+	}
+	return goType, typeImport
+}
+
+func baseType(column schema.Column) (string, string) {
+	unsigned := strings.Contains(column.Type, "unsigned")
+
+	switch column.DataType {
+	case "tinyint":
+		if column.Type == "tinyint(1)" {
+			return "bool", ""
+		}
+		return integerType("8", unsigned), ""
+	case "smallint", "year":
+		return integerType("16", unsigned), ""
+	case "mediumint", "int", "integer":
+		return integerType("32", unsigned), ""
+	case "bigint":
+		return integerType("64", unsigned), ""
+	case "bit":
+		return "uint64", ""
+	case "decimal", "numeric":
+		// the integers that don't fit into uint64
+		if column.Scale != nil && *column.Scale == 0 && column.Precision != nil && *column.Precision > 19 {
+			return "*big.Int", "math/big"
+		}
+		return "string", ""
+	case "float":
+		return "float32", ""
+	case "double", "real":
+		return "float64", ""
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		return "[]byte", ""
+	case "json":
+		return "json.RawMessage", "encoding/json"
+	case "date", "datetime", "timestamp":
+		return "time.Time", "time"
+	}
+
+	// char, varchar, text, enum, set, time and the rest
+	return "string", ""
+}
+
+func integerType(bits string, unsigned bool) string {
+	if unsigned {
+		return "uint" + bits
+	}
+	return "int" + bits
+}
@@ -0,0 +1,78 @@
+package codegen
+
+import (
+	"testing"
+
+	"github.com/Seascape-Foundation/mysql-seascape-extension/schema"
+	"github.com/stretchr/testify/suite"
+)
+
+// Define the suite, and absorb the built-in basic suite
+// functionality from testify - including a T() method which
+// returns the current testing context
+type TestCodegenSuite struct {
+	suite.Suite
+}
+
+func (suite *TestCodegenSuite) TestGoName() {
+	suite.Require().Equal("NetworkId", GoName("network_id"))
+	suite.Require().Equal("IndexerSmartcontract", GoName("indexer_smartcontract"))
+	suite.Require().Equal("Abi", GoName("abi"))
+	suite.Require().Equal("X2fa", GoName("2fa"))
+}
+
+func (suite *TestCodegenSuite) TestGoType() {
+	precision, scale := int64(78), int64(0)
+
+	cases := []struct {
+		column   schema.Column
+		expected string
+		path     string
+	}{
+		{schema.Column{DataType: "varchar", Type: "varchar(20)"}, "string", ""},
+		{schema.Column{DataType: "smallint", Type: "smallint unsigned", Nullable: true}, "*uint16", ""},
+		{schema.Column{DataType: "bigint", Type: "bigint unsigned"}, "uint64", ""},
+		{schema.Column{DataType: "bigint", Type: "bigint"}, "int64", ""},
+		{schema.Column{DataType: "tinyint", Type: "tinyint(1)"}, "bool", ""},
+		{schema.Column{DataType: "json", Type: "json", Nullable: true}, "json.RawMessage", "encoding/json"},
+		{schema.Column{DataType: "blob", Type: "blob", Nullable: true}, "[]byte", ""},
+		{schema.Column{DataType: "datetime", Type: "datetime(6)"}, "time.Time", "time"},
+		{schema.Column{DataType: "decimal", Type: "decimal(78,0)", Precision: &precision, Scale: &scale, Nullable: true}, "*big.Int", "math/big"},
+		{schema.Column{DataType: "decimal", Type: "decimal(10,2)"}, "string", ""},
+	}
+	for _, c := range cases {
+		goType, path := GoType(c.column)
+		suite.Require().Equal(c.expected, goType, c.column.Type)
+		suite.Require().Equal(c.path, path, c.column.Type)
+	}
+}
+
+func (suite *TestCodegenSuite) TestGenerate() {
+	tables := []schema.Table{
+		{
+			Name: "abi",
+			Columns: []schema.Column{
+				{Name: "abi_id", DataType: "varchar", Type: "varchar(20)"},
+				{Name: "body", DataType: "json", Type: "json", Nullable: true},
+			},
+		},
+	}
+
+	source, err := Generate("tables", "_db/migrations", tables)
+	suite.Require().NoError(err)
+	generated := string(source)
+	suite.Require().Contains(generated, "// Code generated by sds-codegen from _db/migrations. DO NOT EDIT.")
+	suite.Require().Contains(generated, "package tables")
+	suite.Require().Contains(generated, `"encoding/json"`)
+	suite.Require().Contains(generated, `const AbiTable = "abi"`)
+	suite.Require().Contains(generated, `AbiColumnAbiId = "abi_id"`)
+	suite.Require().Contains(generated, "AbiId string          `db:\"abi_id\"`")
+	suite.Require().Contains(generated, "Body  json.RawMessage `db:\"body\"`")
+	suite.Require().Contains(generated, "func SelectAbi(c *client.Client, q *client.Query) ([]Abi, error)")
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestCodegen(t *testing.T) {
+	suite.Run(t, new(TestCodegenSuite))
+}
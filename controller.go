@@ -7,6 +7,7 @@ package main
 
 import (
 	"database/sql"
+	"fmt"
 	"github.com/Seascape-Foundation/mysql-seascape-extension/handler"
 	"github.com/Seascape-Foundation/sds-common-lib/data_type/database"
 	"github.com/Seascape-Foundation/sds-common-lib/data_type/key_value"
@@ -15,10 +16,45 @@ import (
 	"github.com/Seascape-Foundation/sds-service-lib/controller"
 	"github.com/Seascape-Foundation/sds-service-lib/log"
 	"github.com/Seascape-Foundation/sds-service-lib/remote"
+	"os"
 )
 
 var db *Database
 
+// registerCommand adds the command handler to the controller.
+// The handler is wrapped into the tracing, the mode check and the access control.
+func (database *Database) registerCommand(c *controller.Controller, name command.Name, handle command.HandleFunc) {
+	c.RegisterCommand(name, database.traced(name, database.guarded(name, handle)))
+}
+
+// failWithCode creates the failed reply with the error code.
+// The message is prefixed by the code.
+func failWithCode(code handler.ErrorCode, errorMessage string) message.Reply {
+	reply := message.Fail(code.Message(errorMessage))
+	reply.Parameters.Set(handler.CodeParameter, string(code))
+	return reply
+}
+
+// setValues sets the scanned values of the row.
+// In the typed mode, the values are encoded losslessly by handler.EncodeValue, and the NULL columns are omitted.
+// If jsonNative is true, then the JSON columns are set as the decoded JSON values, rather than the prefixed strings.
+func setValues(row key_value.KeyValue, fieldTypes []*sql.ColumnType, scans []interface{}, typed bool, jsonNative bool) error {
+	for i, v := range scans {
+		native := typed || (jsonNative && fieldTypes[i].DatabaseTypeName() == "JSON")
+		if !native {
+			if err := database.SetValue(row, fieldTypes[i], v); err != nil {
+				return fmt.Errorf("failed to set value for field %s of %s type: %w", fieldTypes[i].Name(), fieldTypes[i].DatabaseTypeName(), err)
+			}
+			continue
+		}
+
+		if err := handler.SetEncodedValue(row, fieldTypes[i].Name(), fieldTypes[i].DatabaseTypeName(), v); err != nil {
+			return fmt.Errorf("failed to encode value for field %s of %s type: %w", fieldTypes[i].Name(), fieldTypes[i].DatabaseTypeName(), err)
+		}
+	}
+	return nil
+}
+
 // run_puller creates a pull controller that gets the
 // new database credentials to reconnect.
 func (database *Database) runPuller() {
@@ -45,14 +81,21 @@ var onNewCredentials = func(request message.Request, _ log.Logger, _ remote.Clie
 		return message.Fail("the received database credentials are invalid")
 	}
 
-	if db.Connection == nil {
-		return message.Fail("database.Connection is nil, please open the connection first")
-	}
-
-	// establish the first connection
+	// establish the first connection, or replace it with the rotated credentials
+	first := db.Connection == nil
 	if err := db.Reconnect(credentials); err != nil {
 		return message.Fail("database.reconnect:" + err.Error())
 	}
+	// the startup migrations wait for the first credentials
+	if first {
+		exit, err := db.prepare()
+		if err != nil {
+			db.logger.Fatal("prepare", "error", err)
+		}
+		if exit {
+			os.Exit(0)
+		}
+	}
 
 	return message.Reply{
 		Status:     message.OK,
@@ -64,6 +107,7 @@ var onNewCredentials = func(request message.Request, _ log.Logger, _ remote.Clie
 // selects all rows from the database
 //
 // intended to be used once during the app launch for caching.
+// The cache is kept up to date by the change events, see SDS_CHANGES_URL.
 //
 // Minimize the database queries by using this
 var onSelectAll = func(request message.Request, _ log.Logger, _ remote.Clients) message.Reply {
@@ -78,22 +122,42 @@ var onSelectAll = func(request message.Request, _ log.Logger, _ remote.Clients)
 		return message.Fail("parameter validation:" + err.Error())
 	}
 
+	if err := queryParameters.ExpandLists(false, db.parameters.maxInList); err != nil {
+		return message.Fail("list arguments: " + err.Error())
+	}
+	if err := queryParameters.CompileJson(); err != nil {
+		return message.Fail("json filters: " + err.Error())
+	}
+
 	query, err := queryParameters.BuildSelectQuery()
 	if err != nil {
 		return message.Fail("query_parameter.BuildSelectQuery: " + err.Error())
 	}
 
+	q, release, err := db.executor(request, queryParameters.TransactionId)
+	if err != nil {
+		return message.Fail("transaction: " + err.Error())
+	}
+	defer release()
+
+	stmt := db.newStatement(query, queryParameters)
 	var rows *sql.Rows
 	if len(queryParameters.Where) > 0 {
-		rows, err = db.Connection.Query(query, queryParameters.Arguments...)
+		rows, err = q.Query(query, queryParameters.Arguments...)
 	} else {
-		rows, err = db.Connection.Query(query)
+		rows, err = q.Query(query)
 	}
 	if err != nil {
+		db.failed(stmt, err)
 		return message.Fail("db.Connection.Query: " + err.Error())
 	}
+	// the open rows block the commit and the rollback of the transaction
+	defer func() {
+		_ = rows.Close()
+	}()
 	fieldTypes, err := rows.ColumnTypes()
 	if err != nil {
+		db.failed(stmt, err)
 		return message.Fail("rows.ColumnTypes: " + err.Error())
 	}
 
@@ -108,24 +172,31 @@ var onSelectAll = func(request message.Request, _ log.Logger, _ remote.Clients)
 		}
 		err = rows.Scan(scans...)
 		if err != nil {
+			db.failed(stmt, err)
 			return message.Fail("failed to read database data into code: " + err.Error())
 		}
-		for i, v := range scans {
-			err := database.SetValue(row, fieldTypes[i], v)
-			if err != nil {
-				return message.Fail("failed to set value for field " + fieldTypes[i].Name() + " of " + fieldTypes[i].DatabaseTypeName() + " type: " + err.Error())
-			}
+		if err := setValues(row, fieldTypes, scans, queryParameters.Typed, db.parameters.jsonNative); err != nil {
+			db.failed(stmt, err)
+			return message.Fail(err.Error())
 		}
 
 		replyObjects = append(replyObjects, key_value.New(row))
 	}
+	if err := rows.Err(); err != nil {
+		db.failed(stmt, err)
+		return message.Fail("rows.Err: " + err.Error())
+	}
+	db.done(stmt, int64(len(replyObjects)))
 
 	reply := handler.SelectAllReply{
 		Rows: replyObjects,
 	}
-	replyMessage, err := command.Reply(&reply)
+	if queryParameters.Typed {
+		reply.Columns = handler.NewColumnMetadata(fieldTypes)
+	}
+	replyMessage, err := handler.Reply(&reply)
 	if err != nil {
-		return message.Fail("command.Reply: " + err.Error())
+		return message.Fail("handler.Reply: " + err.Error())
 	}
 
 	return replyMessage
@@ -144,21 +215,38 @@ var onExist = func(request message.Request, _ log.Logger, _ remote.Clients) mess
 		return message.Fail("parameter validation:" + err.Error())
 	}
 
+	if err := queryParameters.ExpandLists(false, db.parameters.maxInList); err != nil {
+		return message.Fail("list arguments: " + err.Error())
+	}
+	if err := queryParameters.CompileJson(); err != nil {
+		return message.Fail("json filters: " + err.Error())
+	}
+
 	query, err := queryParameters.BuildExistQuery()
 	if err != nil {
 		return message.Fail("query_parameter.BuildExistQuery: " + err.Error())
 	}
 
-	rows, err := db.Connection.Query(query, queryParameters.Arguments...)
+	q, release, err := db.executor(request, queryParameters.TransactionId)
 	if err != nil {
+		return message.Fail("transaction: " + err.Error())
+	}
+	defer release()
+
+	stmt := db.newStatement(query, queryParameters)
+	rows, err := q.Query(query, queryParameters.Arguments...)
+	if err != nil {
+		db.failed(stmt, err)
 		return message.Fail("db.Connection.Query: " + err.Error())
 	}
 	reply := handler.ExistReply{}
 
 	if rows.Next() {
 		reply.Exist = true
+		db.done(stmt, 1)
 	} else {
 		reply.Exist = false
+		db.done(stmt, 0)
 	}
 
 	replyMessage, err := command.Reply(&reply)
@@ -186,13 +274,28 @@ var onSelectRow = func(request message.Request, _ log.Logger, clients remote.Cli
 		return message.Fail("parameter validation:" + err.Error())
 	}
 
+	if err := queryParameters.ExpandLists(false, db.parameters.maxInList); err != nil {
+		return message.Fail("list arguments: " + err.Error())
+	}
+	if err := queryParameters.CompileJson(); err != nil {
+		return message.Fail("json filters: " + err.Error())
+	}
+
 	query, err := queryParameters.BuildSelectRowQuery()
 	if err != nil {
 		return message.Fail("query_parameter.BuildSelectRowQuery: " + err.Error())
 	}
 
-	rows, err := db.Connection.Query(query, queryParameters.Arguments...)
+	q, release, err := db.executor(request, queryParameters.TransactionId)
 	if err != nil {
+		return message.Fail("transaction: " + err.Error())
+	}
+	defer release()
+
+	stmt := db.newStatement(query, queryParameters)
+	rows, err := q.Query(query, queryParameters.Arguments...)
+	if err != nil {
+		db.failed(stmt, err)
 		return message.Fail("db.Connection.Query: " + err.Error())
 	}
 	defer func() {
@@ -204,6 +307,7 @@ var onSelectRow = func(request message.Request, _ log.Logger, clients remote.Cli
 
 	fieldTypes, err := rows.ColumnTypes()
 	if err != nil {
+		db.failed(stmt, err)
 		return message.Fail("rows.ColumnTypes: " + err.Error())
 	}
 
@@ -219,26 +323,34 @@ var onSelectRow = func(request message.Request, _ log.Logger, clients remote.Cli
 		}
 		err = rows.Scan(scans...)
 		if err != nil {
+			db.failed(stmt, err)
 			return message.Fail("failed to read database data into code: " + err.Error())
 		}
-		for i, v := range scans {
-			err := database.SetValue(row, fieldTypes[i], v)
-			if err != nil {
-				return message.Fail("failed to set value for field " + fieldTypes[i].Name() + " of " + fieldTypes[i].DatabaseTypeName() + " type: " + err.Error())
-			}
+		if err := setValues(row, fieldTypes, scans, queryParameters.Typed, db.parameters.jsonNative); err != nil {
+			db.failed(stmt, err)
+			return message.Fail(err.Error())
 		}
 	}
+	if err := rows.Err(); err != nil {
+		db.failed(stmt, err)
+		return message.Fail("rows.Err: " + err.Error())
+	}
 
 	if noResult {
-		return message.Fail("not found")
+		db.done(stmt, 0)
+		return failWithCode(handler.NotFound, "not found")
 	}
+	db.done(stmt, 1)
 
 	reply := handler.SelectRowReply{
 		Outputs: key_value.New(row),
 	}
-	replyMessage, err := command.Reply(&reply)
+	if queryParameters.Typed {
+		reply.Columns = handler.NewColumnMetadata(fieldTypes)
+	}
+	replyMessage, err := handler.Reply(&reply)
 	if err != nil {
-		return message.Fail("command.Reply: " + err.Error())
+		return message.Fail("handler.Reply: " + err.Error())
 	}
 
 	return replyMessage
@@ -257,19 +369,25 @@ var onDelete = func(request message.Request, _ log.Logger, _ remote.Clients) mes
 		return message.Fail("parameter validation:" + err.Error())
 	}
 
-	query, err := queryParameters.BuildDeleteQuery()
-	if err != nil {
-		return message.Fail("query_parameter.BuildDeleteQuery: " + err.Error())
+	if err := queryParameters.ExpandLists(false, db.parameters.maxInList); err != nil {
+		return message.Fail("list arguments: " + err.Error())
+	}
+	if err := queryParameters.CompileJson(); err != nil {
+		return message.Fail("json filters: " + err.Error())
 	}
 
-	result, err := db.Connection.Exec(query, queryParameters.Arguments...)
+	if err := db.orderDeleted(&queryParameters); err != nil {
+		return message.Fail("changes: " + err.Error())
+	}
+
+	query, err := queryParameters.BuildDeleteQuery()
 	if err != nil {
-		return message.Fail("db.Connection.Exec: " + err.Error())
+		return message.Fail("query_parameter.BuildDeleteQuery: " + err.Error())
 	}
 
-	affected, err := result.RowsAffected()
+	affected, err := db.execWrite(request, handler.DELETE, queryParameters, query)
 	if err != nil {
-		return message.Fail("result.RowsAffected: " + err.Error())
+		return message.Fail(err.Error())
 	}
 
 	if affected == 0 {
@@ -301,19 +419,18 @@ var onInsert = func(request message.Request, _ log.Logger, _ remote.Clients) mes
 	if err != nil {
 		return message.Fail("serialization failed: %w" + err.Error())
 	}
+	if err := db.encodeJsonArguments(&queryParameters); err != nil {
+		return message.Fail("json arguments: " + err.Error())
+	}
 
 	query, err := queryParameters.BuildInsertRowQuery()
 	if err != nil {
 		return message.Fail("query_parameter.BuildInsertRowQuery: " + err.Error())
 	}
 
-	result, err := db.Connection.Exec(query, queryParameters.Arguments...)
+	affected, err := db.execWrite(request, handler.INSERT, queryParameters, query)
 	if err != nil {
-		return message.Fail("db.Connection.Exec: " + err.Error())
-	}
-	affected, err := result.RowsAffected()
-	if err != nil {
-		return message.Fail("result.RowsAffected: " + err.Error())
+		return message.Fail(err.Error())
 	}
 
 	if affected == 0 {
@@ -345,22 +462,40 @@ var onUpdate = func(request message.Request, _ log.Logger, _ remote.Clients) mes
 	if err != nil {
 		return message.Fail("serialization failed: %w" + err.Error())
 	}
+	if err := db.encodeJsonArguments(&queryParameters); err != nil {
+		return message.Fail("json arguments: " + err.Error())
+	}
 
-	query, err := queryParameters.BuildUpdateQuery()
+	if err := queryParameters.ExpandLists(true, db.parameters.maxInList); err != nil {
+		return message.Fail("list arguments: " + err.Error())
+	}
+	current, err := queryParameters.CompileExpectation()
 	if err != nil {
-		return message.Fail("query_parameter.BuildUpdateQuery: " + err.Error())
+		return message.Fail("expectation: " + err.Error())
+	}
+	if err := queryParameters.CompileOperations(); err != nil {
+		return message.Fail("operations: " + err.Error())
+	}
+	if err := queryParameters.CompileJson(); err != nil {
+		return message.Fail("json patches: " + err.Error())
 	}
 
-	result, err := db.Connection.Exec(query, queryParameters.Arguments...)
+	query, err := queryParameters.BuildUpdateQuery()
 	if err != nil {
-		return message.Fail("db.Connection.Exec: " + err.Error())
+		return message.Fail("query_parameter.BuildUpdateQuery: " + err.Error())
 	}
-	affected, err := result.RowsAffected()
+
+	affected, err := db.execWrite(request, handler.UPDATE, queryParameters, query)
 	if err != nil {
-		return message.Fail("result.RowsAffected: " + err.Error())
+		return message.Fail(err.Error())
 	}
 
 	if affected == 0 {
+		if current != nil {
+			if reply, ok := conflictReply(request, *current); ok {
+				return reply
+			}
+		}
 		return message.Fail("no rows were inserted or updated")
 	}
 	reply := handler.UpdateReply{}
@@ -371,3 +506,199 @@ var onUpdate = func(request message.Request, _ log.Logger, _ remote.Clients) mes
 
 	return replyMessage
 }
+
+// conflictReply returns the UpdateReply with the Conflict flag and the current row,
+// if the row that wasn't updated exists, but doesn't have the expected value.
+// The reply is successful, since the failed reply loses the parameters on the way to the client.
+//
+// The current is the request returned by handler.DatabaseQueryRequest.CompileExpectation.
+func conflictReply(request message.Request, current handler.DatabaseQueryRequest) (message.Reply, bool) {
+	if err := current.CompileJson(); err != nil {
+		return message.Fail("json filters: " + err.Error()), true
+	}
+	query, err := current.BuildSelectRowQuery()
+	if err != nil {
+		return message.Fail("query_parameter.BuildSelectRowQuery: " + err.Error()), true
+	}
+
+	q, release, err := db.executor(request, current.TransactionId)
+	if err != nil {
+		return message.Fail("transaction: " + err.Error()), true
+	}
+	defer release()
+
+	stmt := db.newStatement(query, current)
+	rows, err := q.Query(query, current.Arguments...)
+	if err != nil {
+		db.failed(stmt, err)
+		return message.Fail("db.Connection.Query: " + err.Error()), true
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	if !rows.Next() {
+		db.done(stmt, 0)
+		return message.Reply{}, false
+	}
+	fieldTypes, err := rows.ColumnTypes()
+	if err != nil {
+		db.failed(stmt, err)
+		return message.Fail("rows.ColumnTypes: " + err.Error()), true
+	}
+	scans := make([]interface{}, len(fieldTypes))
+	for i := range scans {
+		scans[i] = &scans[i]
+	}
+	if err := rows.Scan(scans...); err != nil {
+		db.failed(stmt, err)
+		return message.Fail("failed to read database data into code: " + err.Error()), true
+	}
+	row := key_value.Empty()
+	if err := setValues(row, fieldTypes, scans, current.Typed, db.parameters.jsonNative); err != nil {
+		db.failed(stmt, err)
+		return message.Fail(err.Error()), true
+	}
+	db.done(stmt, 1)
+
+	reply := handler.UpdateReply{Conflict: true, Row: row}
+	replyMessage, err := handler.Reply(&reply)
+	if err != nil {
+		return message.Fail("handler.Reply: " + err.Error()), true
+	}
+	return replyMessage, true
+}
+
+// counts the rows that match to the query
+var onCount = func(request message.Request, _ log.Logger, _ remote.Clients) message.Reply {
+	if db == nil || db.Connection == nil {
+		return message.Fail("database.Connection is nil, please open the connection first")
+	}
+
+	var queryParameters handler.DatabaseQueryRequest
+	err := request.Parameters.Interface(&queryParameters)
+	if err != nil {
+		return message.Fail("parameter validation:" + err.Error())
+	}
+
+	if err := queryParameters.ExpandLists(false, db.parameters.maxInList); err != nil {
+		return message.Fail("list arguments: " + err.Error())
+	}
+	if err := queryParameters.CompileJson(); err != nil {
+		return message.Fail("json filters: " + err.Error())
+	}
+
+	query, err := queryParameters.BuildCountQuery()
+	if err != nil {
+		return message.Fail("query_parameter.BuildCountQuery: " + err.Error())
+	}
+
+	q, release, err := db.executor(request, queryParameters.TransactionId)
+	if err != nil {
+		return message.Fail("transaction: " + err.Error())
+	}
+	defer release()
+
+	stmt := db.newStatement(query, queryParameters)
+	rows, err := q.Query(query, queryParameters.Arguments...)
+	if err != nil {
+		db.failed(stmt, err)
+		return message.Fail("db.Connection.Query: " + err.Error())
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	reply := handler.CountReply{}
+	if rows.Next() {
+		if err := rows.Scan(&reply.Count); err != nil {
+			db.failed(stmt, err)
+			return message.Fail("rows.Scan: " + err.Error())
+		}
+	}
+	db.done(stmt, 1)
+
+	replyMessage, err := command.Reply(&reply)
+	if err != nil {
+		return message.Fail("command.Reply: " + err.Error())
+	}
+
+	return replyMessage
+}
+
+// returns the aggregations of the rows that match to the query, grouped by the columns
+var onAggregate = func(request message.Request, _ log.Logger, _ remote.Clients) message.Reply {
+	if db == nil || db.Connection == nil {
+		return message.Fail("database.Connection is nil, please open the connection first")
+	}
+
+	var queryParameters handler.DatabaseQueryRequest
+	err := request.Parameters.Interface(&queryParameters)
+	if err != nil {
+		return message.Fail("parameter validation:" + err.Error())
+	}
+
+	if err := queryParameters.ExpandLists(false, db.parameters.maxInList); err != nil {
+		return message.Fail("list arguments: " + err.Error())
+	}
+	if err := queryParameters.CompileJson(); err != nil {
+		return message.Fail("json filters: " + err.Error())
+	}
+
+	query, err := queryParameters.BuildAggregateQuery()
+	if err != nil {
+		return message.Fail("query_parameter.BuildAggregateQuery: " + err.Error())
+	}
+
+	q, release, err := db.executor(request, queryParameters.TransactionId)
+	if err != nil {
+		return message.Fail("transaction: " + err.Error())
+	}
+	defer release()
+
+	stmt := db.newStatement(query, queryParameters)
+	rows, err := q.Query(query, queryParameters.AggregateArguments()...)
+	if err != nil {
+		db.failed(stmt, err)
+		return message.Fail("db.Connection.Query: " + err.Error())
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	fieldTypes, err := rows.ColumnTypes()
+	if err != nil {
+		db.failed(stmt, err)
+		return message.Fail("rows.ColumnTypes: " + err.Error())
+	}
+
+	reply := handler.AggregateReply{
+		Rows:    make([]key_value.KeyValue, 0),
+		Columns: handler.NewColumnMetadata(fieldTypes),
+	}
+	for rows.Next() {
+		scans := make([]interface{}, len(fieldTypes))
+		for i := range scans {
+			scans[i] = &scans[i]
+		}
+		if err := rows.Scan(scans...); err != nil {
+			db.failed(stmt, err)
+			return message.Fail("failed to read database data into code: " + err.Error())
+		}
+
+		row := key_value.Empty()
+		if err := setValues(row, fieldTypes, scans, true, true); err != nil {
+			db.failed(stmt, err)
+			return message.Fail(err.Error())
+		}
+		reply.Rows = append(reply.Rows, row)
+	}
+	db.done(stmt, int64(len(reply.Rows)))
+
+	replyMessage, err := handler.Reply(&reply)
+	if err != nil {
+		return message.Fail("handler.Reply: " + err.Error())
+	}
+
+	return replyMessage
+}
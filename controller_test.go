@@ -28,8 +28,8 @@ type TestControllerSuite struct {
 func (suite *TestControllerSuite) SetupTest() {
 	suite.db_name = "test"
 	_, filename, _, _ := runtime.Caller(0)
-	storage_abi_sql := "20230308171023_storage_abi.sql"
-	storage_abi_path := filepath.Join(filepath.Dir(filename), "..", "_db", "migrations", storage_abi_sql)
+	storage_abi_sql := "20230308171023_static_abi.sql"
+	storage_abi_path := filepath.Join(filepath.Dir(filename), "_db", "migrations", storage_abi_sql)
 
 	ctx := context.TODO()
 	container, err := mysql.RunContainer(ctx,
@@ -94,7 +94,7 @@ func (suite *TestControllerSuite) TestInsert() {
 	arguments := []interface{}{"test_id", `[{}]`}
 	request := handler.DatabaseQueryRequest{
 		Fields:    []string{"abi_id", "body"},
-		Tables:    []string{"storage_abi"},
+		Tables:    []string{"abi"},
 		Arguments: arguments,
 	}
 	var reply handler.InsertReply
@@ -105,7 +105,7 @@ func (suite *TestControllerSuite) TestInsert() {
 	arguments = []interface{}{"test_id"}
 	request = handler.DatabaseQueryRequest{
 		Fields:    []string{"abi_id"},
-		Tables:    []string{"storage_abi"},
+		Tables:    []string{"abi"},
 		Where:     "abi_id = ?",
 		Arguments: arguments,
 	}
@@ -118,7 +118,7 @@ func (suite *TestControllerSuite) TestInsert() {
 	// query
 	request = handler.DatabaseQueryRequest{
 		Fields: []string{"abi_id", "body"},
-		Tables: []string{"storage_abi"},
+		Tables: []string{"abi"},
 	}
 	var reply_all handler.SelectAllReply
 	err = handler.SelectAll.Request(suite.client, request, &reply_all)
@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The aggregate functions of AGGREGATE command
+const (
+	CountFunction         = "COUNT"
+	CountDistinctFunction = "COUNT_DISTINCT"
+	SumFunction           = "SUM"
+	MinFunction           = "MIN"
+	MaxFunction           = "MAX"
+	AvgFunction           = "AVG"
+)
+
+// aliasPattern is the identifier of the aggregation alias, the joined table and its alias
+var aliasPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Aggregation is the aggregate function on the column.
+//
+// Example, the amount of the events per smartcontract:
+//
+//	DatabaseQueryRequest{
+//		Tables:       []string{"indexer_event"},
+//		GroupBy:      []string{"network_id", "address"},
+//		Aggregations: []Aggregation{{Function: CountFunction}},
+//	}
+type Aggregation struct {
+	Function string `json:"function"`         // COUNT, COUNT_DISTINCT, SUM, MIN, MAX or AVG
+	Column   string `json:"column,omitempty"` // optional for COUNT, that counts the rows
+	Alias    string `json:"alias,omitempty"`  // the name in the reply, by default function_column
+}
+
+// HavingCondition compares the aggregation or the GroupBy column of the group with the value.
+// The value is passed as the argument of the query.
+//
+// Example, the smartcontracts with more than 10 events:
+//
+//	HavingCondition{Column: "count", Operator: ">", Value: 10}
+type HavingCondition struct {
+	Column   string      `json:"column"`   // the alias of the aggregation or the GroupBy column
+	Operator string      `json:"operator"` // "=", "!=", "<", "<=", ">" or ">="
+	Value    interface{} `json:"value"`
+}
+
+// expression returns the sql of the aggregation and its name in the reply
+func (aggregation Aggregation) expression() (string, string, error) {
+	function := strings.ToUpper(aggregation.Function)
+	column := aggregation.Column
+
+	if len(column) == 0 || column == "*" {
+		if function != CountFunction {
+			return "", "", fmt.Errorf("missing column of %s", function)
+		}
+		column = "*"
+	} else if err := validateColumn(column); err != nil {
+		return "", "", err
+	}
+
+	alias := aggregation.Alias
+	if len(alias) == 0 {
+		alias = strings.ToLower(function)
+		if column != "*" {
+			alias += "_" + strings.ReplaceAll(column, ".", "_")
+		}
+	} else if !aliasPattern.MatchString(alias) {
+		return "", "", fmt.Errorf("invalid alias '%s'", alias)
+	}
+
+	switch function {
+	case CountFunction, SumFunction, MinFunction, MaxFunction, AvgFunction:
+		return function + "(" + column + ") AS " + alias, alias, nil
+	case CountDistinctFunction:
+		return "COUNT(DISTINCT " + column + ") AS " + alias, alias, nil
+	}
+	return "", "", fmt.Errorf("unsupported aggregate function '%s'", aggregation.Function)
+}
+
+// BuildAggregateQuery creates a SELECT SQL query with the aggregations,
+// grouped by the GroupBy columns.
+//
+// The arguments of the query are returned by AggregateArguments.
+func (request DatabaseQueryRequest) BuildAggregateQuery() (string, error) {
+	if len(request.Tables) == 0 {
+		return "", fmt.Errorf("missing Tables parameter")
+	}
+	if len(request.Aggregations) == 0 {
+		return "", fmt.Errorf("missing Aggregations parameter")
+	}
+	if len(request.Where) > 0 && len(request.Arguments) == 0 {
+		return "", fmt.Errorf("missing Arguments for Where clause")
+	}
+	if request.Lock != nil {
+		return "", fmt.Errorf("the row lock is supported only by SELECT, SELECT_ROW and EXIST")
+	}
+	if len(request.Having) > 0 && len(request.GroupBy) == 0 {
+		return "", fmt.Errorf("missing GroupBy for Having conditions")
+	}
+
+	selected := make([]string, 0, len(request.GroupBy)+len(request.Aggregations))
+	names := make(map[string]bool)
+	for _, column := range request.GroupBy {
+		if err := validateColumn(column); err != nil {
+			return "", fmt.Errorf("group by: %w", err)
+		}
+		selected = append(selected, column)
+		names[column] = true
+	}
+	for _, aggregation := range request.Aggregations {
+		expression, alias, err := aggregation.expression()
+		if err != nil {
+			return "", err
+		}
+		if names[alias] {
+			return "", fmt.Errorf("duplicate '%s' in the reply, set the alias", alias)
+		}
+		names[alias] = true
+		selected = append(selected, expression)
+	}
+
+	from, err := request.from()
+	if err != nil {
+		return "", err
+	}
+	str := `SELECT ` + strings.Join(selected, ", ") + ` FROM ` + from
+	if len(request.Where) > 0 {
+		str += ` WHERE ` + request.Where
+	}
+	if len(request.GroupBy) > 0 {
+		str += ` GROUP BY ` + strings.Join(request.GroupBy, ", ")
+	}
+	if len(request.Having) > 0 {
+		predicates := make([]string, 0, len(request.Having))
+		for _, condition := range request.Having {
+			if !names[condition.Column] {
+				return "", fmt.Errorf("having: '%s' is not the aggregation alias or the GroupBy column", condition.Column)
+			}
+			if !jsonComparisons[condition.Operator] {
+				return "", fmt.Errorf("having: unsupported operator '%s'", condition.Operator)
+			}
+			switch condition.Value.(type) {
+			case nil:
+				return "", fmt.Errorf("having: missing value of '%s'", condition.Column)
+			case []interface{}, map[string]interface{}:
+				// the lists are expanded only in the Where, the operators of HAVING compare one value
+				return "", fmt.Errorf("having: the value of '%s' should be a scalar, the lists are not supported", condition.Column)
+			}
+			predicates = append(predicates, condition.Column+" "+condition.Operator+" ?")
+		}
+		str += ` HAVING ` + strings.Join(predicates, " AND ")
+	}
+
+	return str, nil
+}
+
+// AggregateArguments returns the arguments of the where clause followed by the values of the having conditions
+func (request DatabaseQueryRequest) AggregateArguments() []interface{} {
+	arguments := make([]interface{}, 0, len(request.Arguments)+len(request.Having))
+	arguments = append(arguments, request.Arguments...)
+	for _, condition := range request.Having {
+		arguments = append(arguments, condition.Value)
+	}
+	return arguments
+}
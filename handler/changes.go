@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The operations of the change event
+const (
+	ChangeInsert = "insert"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+)
+
+// ChangeEvent is published after the insert, update or delete is committed.
+//
+// The event is published as two frames: the table name as the topic and the event as JSON.
+// The subscribers invalidate the cached rows by the Keys.
+// If the keys are unknown or there are too many of them, then Truncated is true,
+// and the subscribers should invalidate the whole table.
+//
+// The key values are encoded by the column type as EncodeValue does,
+// so the same row has the same keys in the events of any operation.
+// The extension has no upsert command, so there is no upsert operation.
+type ChangeEvent struct {
+	Table     string                   `json:"table"`
+	Operation string                   `json:"operation"`
+	Keys      []map[string]interface{} `json:"keys,omitempty"`   // the primary key values of the changed rows
+	Fields    []string                 `json:"fields,omitempty"` // the changed columns, empty for delete
+	Truncated bool                     `json:"truncated,omitempty"`
+	Rows      int64                    `json:"rows_affected"`
+}
+
+// ChangedFields returns the columns set by INSERT or UPDATE,
+// including the columns of the compiled Operations and JsonPatches.
+func (request DatabaseQueryRequest) ChangedFields() []string {
+	fields := make([]string, 0, len(request.Fields)+len(request.assignments))
+	fields = append(fields, request.Fields...)
+	for _, assignment := range request.assignments {
+		fields = append(fields, strings.SplitN(assignment, " = ", 2)[0])
+	}
+	return fields
+}
+
+// OrderByKeys adds the primary key columns to the end of the OrderBy,
+// so the rows with the same values of the OrderBy are always in the same order.
+// The columns that are already in the OrderBy are skipped.
+func (request *DatabaseQueryRequest) OrderByKeys(keys []string) {
+	orderBy := make([]string, 0, len(request.OrderBy)+len(keys))
+	orderBy = append(orderBy, request.OrderBy...)
+	for _, key := range keys {
+		ordered := false
+		for _, order := range request.OrderBy {
+			if parts := strings.Fields(order); len(parts) > 0 && parts[0] == key {
+				ordered = true
+				break
+			}
+		}
+		if !ordered {
+			orderBy = append(orderBy, key)
+		}
+	}
+	request.OrderBy = orderBy
+}
+
+// BuildChangedKeysQuery creates the SELECT query of the primary keys of the rows
+// that are changed by UPDATE or DELETE, with its arguments.
+// The rows are locked, so they are not changed until the statement is executed.
+//
+// At most limit keys are selected.
+// The delete with the Limit is ordered by the keys too, see OrderByKeys,
+// so the selected keys are the keys of the deleted rows, if the delete is ordered the same way.
+func (request DatabaseQueryRequest) BuildChangedKeysQuery(update bool, keys []string, limit uint64) (string, []interface{}, error) {
+	if len(request.Tables) != 1 {
+		return "", nil, fmt.Errorf("the keys are selected from one table")
+	}
+	if len(keys) == 0 {
+		return "", nil, fmt.Errorf("missing primary key")
+	}
+
+	arguments := request.Arguments
+	if update {
+		_, arguments = request.UpdateArguments()
+	}
+
+	str := `SELECT ` + strings.Join(keys, ", ") + ` FROM ` + request.Tables[0]
+	if len(request.Where) > 0 {
+		str += ` WHERE ` + request.Where
+	}
+	if !update {
+		if request.Limit > 0 {
+			request.OrderByKeys(keys)
+		}
+		if len(request.OrderBy) > 0 {
+			orderBy, err := orderByClause(request.OrderBy)
+			if err != nil {
+				return "", nil, err
+			}
+			str += ` ORDER BY ` + orderBy
+		}
+		if request.Limit > 0 && request.Limit < limit {
+			limit = request.Limit
+		}
+	}
+	str += ` LIMIT ` + strconv.FormatUint(limit, 10) + ` FOR UPDATE`
+
+	return str, arguments, nil
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// The commands executed by ChunkedStart
+const (
+	ChunkedDelete = "delete"
+	ChunkedUpdate = "update"
+)
+
+// The status of the chunked job
+const (
+	JobRunning   = "running"
+	JobDone      = "done"
+	JobCancelled = "cancelled"
+	JobFailed    = "failed"
+)
+
+// ChunkedRequest keeps the parameters of CHUNKED_START command.
+//
+// The rows matching the query are deleted or updated in batches of BatchSize rows,
+// ordered by the primary key. Each batch is a separate statement, so the table is never locked for long.
+type ChunkedRequest struct {
+	DatabaseQueryRequest
+	Command   string `json:"command"`              // "delete" or "update"
+	BatchSize uint64 `json:"batch_size,omitempty"` // rows per batch
+	Pause     uint64 `json:"pause,omitempty"`      // milliseconds between the batches
+}
+
+// UnmarshalJSON decodes the query by DatabaseQueryRequest.UnmarshalJSON,
+// since the promoted method would skip the rest of the parameters.
+func (request *ChunkedRequest) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &request.DatabaseQueryRequest); err != nil {
+		return err
+	}
+
+	var options struct {
+		Command   string `json:"command"`
+		BatchSize uint64 `json:"batch_size,omitempty"`
+		Pause     uint64 `json:"pause,omitempty"`
+	}
+	if err := json.Unmarshal(data, &options); err != nil {
+		return err
+	}
+	request.Command = options.Command
+	request.BatchSize = options.BatchSize
+	request.Pause = options.Pause
+
+	return nil
+}
+
+// Validate the chunked request
+func (request *ChunkedRequest) Validate() error {
+	if request.Command != ChunkedDelete && request.Command != ChunkedUpdate {
+		return fmt.Errorf("command is either '%s' or '%s', but given: '%s'", ChunkedDelete, ChunkedUpdate, request.Command)
+	}
+	if len(request.Tables) != 1 {
+		return fmt.Errorf("chunked %s requires exactly one table in Tables", request.Command)
+	}
+	if len(request.Joins) > 0 || len(request.OrderBy) > 0 || request.Limit > 0 {
+		return fmt.Errorf("the joins, order by and limit are not supported, the rows are ordered by the primary key")
+	}
+	if len(request.TransactionId) > 0 {
+		return fmt.Errorf("chunked %s can not run in the transaction", request.Command)
+	}
+	if request.Expect != nil {
+		return fmt.Errorf("the expectation is supported only by UPDATE command")
+	}
+	if request.Lock != nil {
+		return fmt.Errorf("the row lock is supported only by the select commands")
+	}
+	if len(request.Outbox) > 0 {
+		return fmt.Errorf("the outbox messages are not supported, since each batch is a separate statement")
+	}
+	if request.Command == ChunkedDelete && len(request.Where) == 0 && len(request.JsonFilters) == 0 && !request.AllRows {
+		return fmt.Errorf("missing Where parameter, deleting all rows requires AllRows")
+	}
+	if request.Command == ChunkedUpdate && len(request.Fields) == 0 && len(request.Operations) == 0 && len(request.JsonPatches) == 0 {
+		return fmt.Errorf("missing Fields parameter")
+	}
+	if request.Command == ChunkedUpdate && len(request.Fields) > len(request.Arguments) {
+		return fmt.Errorf("missing Arguments for Fields")
+	}
+	return nil
+}
+
+// UpdateArguments returns the arguments of the UPDATE fields, the operations and the json patches,
+// and the arguments of the where clause.
+// Call it after CompileOperations and CompileJson.
+func (request DatabaseQueryRequest) UpdateArguments() ([]interface{}, []interface{}) {
+	split := len(request.Fields) + request.assignmentArguments
+	if split > len(request.Arguments) {
+		split = len(request.Arguments)
+	}
+	return request.Arguments[:split], request.Arguments[split:]
+}
+
+// JobRequest keeps the parameters of CHUNKED_STATUS and CHUNKED_CANCEL commands
+type JobRequest struct {
+	JobId string `json:"job_id"`
+}
+
+// ChunkedStartReply keeps the parameters of CHUNKED_START command reply by controller
+type ChunkedStartReply struct {
+	JobId string `json:"job_id"`
+}
+
+// JobStatusReply keeps the progress of the chunked job.
+// It's the reply of CHUNKED_STATUS and CHUNKED_CANCEL commands.
+type JobStatusReply struct {
+	JobId      string `json:"job_id"`
+	Command    string `json:"command"`
+	Table      string `json:"table"`
+	Status     string `json:"status"` // running, done, cancelled or failed
+	Batches    uint64 `json:"batches"`
+	Rows       uint64 `json:"rows"` // the deleted or updated rows
+	Error      string `json:"error,omitempty"`
+	StartedAt  int64  `json:"started_at"`            // unix timestamp in seconds
+	FinishedAt int64  `json:"finished_at,omitempty"` // unix timestamp in seconds
+}
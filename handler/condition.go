@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// conditionKeywords are the words of the condition that are not the columns
+var conditionKeywords = map[string]bool{
+	"AND": true, "OR": true, "NOT": true, "XOR": true, "IN": true, "IS": true, "NULL": true,
+	"LIKE": true, "BETWEEN": true, "TRUE": true, "FALSE": true, "UNKNOWN": true,
+	"REGEXP": true, "RLIKE": true, "ESCAPE": true, "SOUNDS": true, "MEMBER": true, "OF": true,
+	"DIV": true, "MOD": true, "INTERVAL": true, "BINARY": true, "COLLATE": true, "DISTINCT": true,
+	"CASE": true, "WHEN": true, "THEN": true, "ELSE": true, "END": true, "AS": true,
+	"MICROSECOND": true, "SECOND": true, "MINUTE": true, "HOUR": true, "DAY": true,
+	"WEEK": true, "MONTH": true, "QUARTER": true, "YEAR": true,
+	"CURRENT_DATE": true, "CURRENT_TIME": true, "CURRENT_TIMESTAMP": true, "UTC_TIMESTAMP": true,
+	// the types of CAST and CONVERT
+	"CHAR": true, "NCHAR": true, "SIGNED": true, "UNSIGNED": true, "INTEGER": true, "DECIMAL": true,
+	"DOUBLE": true, "FLOAT": true, "DATE": true, "DATETIME": true, "TIME": true, "JSON": true,
+}
+
+// conditionQueries are the words that start the subquery.
+// The tables and the columns of the subquery can not be checked.
+var conditionQueries = map[string]bool{"SELECT": true, "TABLE": true, "VALUES": true, "WITH": true}
+
+// conditionFunctions are the functions allowed in the condition.
+// The rest of the functions could read the files, the variables or hold the connection,
+// for example LOAD_FILE, SLEEP or BENCHMARK.
+var conditionFunctions = map[string]bool{
+	"JSON_EXTRACT": true, "JSON_UNQUOTE": true, "JSON_CONTAINS": true, "JSON_CONTAINS_PATH": true,
+	"JSON_LENGTH": true, "JSON_TYPE": true, "JSON_OVERLAPS": true,
+	"COALESCE": true, "IFNULL": true, "NULLIF": true, "IF": true, "ISNULL": true, "GREATEST": true, "LEAST": true,
+	"LOWER": true, "UPPER": true, "LENGTH": true, "CHAR_LENGTH": true, "CONCAT": true, "SUBSTRING": true,
+	"SUBSTR": true, "TRIM": true, "LEFT": true, "RIGHT": true, "LOCATE": true, "HEX": true, "UNHEX": true,
+	"ABS": true, "ROUND": true, "FLOOR": true, "CEIL": true, "CEILING": true, "MOD": true,
+	"CAST": true, "CONVERT": true,
+	"NOW": true, "UTC_TIMESTAMP": true, "CURDATE": true, "CURTIME": true, "DATE": true, "DATE_ADD": true,
+	"DATE_SUB": true, "TIMESTAMPDIFF": true, "UNIX_TIMESTAMP": true, "FROM_UNIXTIME": true,
+	"CURRENT_TIMESTAMP": true, "YEAR": true, "MONTH": true, "DAY": true,
+}
+
+// IsColumn returns true if the field is the plain column with the optional table,
+// and not an expression.
+func IsColumn(field string) bool {
+	return columnPattern.MatchString(field)
+}
+
+// ConditionColumns returns the columns used in the raw condition, such as the Where.
+//
+// The quoted strings, the numbers, the keywords and the allowed function names are skipped.
+// The subqueries (SELECT, TABLE, VALUES), the functions that are not allowed,
+// the variables and the comments are rejected,
+// since the tables and the columns hidden in them can not be checked.
+func ConditionColumns(condition string) ([]string, error) {
+	columns := make([]string, 0)
+	for i := 0; i < len(condition); {
+		c := condition[i]
+		switch {
+		case c == '\'' || c == '"':
+			end := conditionQuote(condition, i)
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed quote in the condition")
+			}
+			i = end + 1
+		case c == '@':
+			return nil, fmt.Errorf("the variables are not allowed in the condition")
+		case c == '#' || strings.HasPrefix(condition[i:], "--") || strings.HasPrefix(condition[i:], "/*"):
+			return nil, fmt.Errorf("the comments are not allowed in the condition")
+		case c >= '0' && c <= '9':
+			for i < len(condition) && isWordCharacter(condition[i]) {
+				i++
+			}
+		case c == '`' || isWordStart(c):
+			word, end, err := conditionWord(condition, i)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+
+			upper := strings.ToUpper(word)
+			if conditionQueries[upper] {
+				return nil, fmt.Errorf("the subqueries are not allowed in the condition")
+			}
+			if conditionKeywords[upper] {
+				continue
+			}
+			if strings.HasPrefix(strings.TrimLeft(condition[i:], " \t\r\n"), "(") {
+				if !conditionFunctions[upper] {
+					return nil, fmt.Errorf("'%s' function is not allowed in the condition", word)
+				}
+				continue
+			}
+			columns = append(columns, word)
+		default:
+			i++
+		}
+	}
+	return columns, nil
+}
+
+// conditionWord returns the identifier starting at the position, with the optional table,
+// and the position after it. The backticks are removed.
+func conditionWord(condition string, start int) (string, int, error) {
+	word := ""
+	i := start
+	for {
+		if i < len(condition) && condition[i] == '`' {
+			end := strings.IndexByte(condition[i+1:], '`')
+			if end < 0 {
+				return "", 0, fmt.Errorf("unclosed quote in the condition")
+			}
+			word += condition[i+1 : i+1+end]
+			i += end + 2
+		} else {
+			for i < len(condition) && isWordCharacter(condition[i]) {
+				word += string(condition[i])
+				i++
+			}
+		}
+		if i+1 < len(condition) && condition[i] == '.' && (condition[i+1] == '`' || isWordStart(condition[i+1])) {
+			word += "."
+			i++
+			continue
+		}
+		return word, i, nil
+	}
+}
+
+// conditionQuote returns the position of the quote that closes the string starting at the position
+func conditionQuote(condition string, start int) int {
+	quote := condition[start]
+	for i := start + 1; i < len(condition); i++ {
+		switch condition[i] {
+		case '\\':
+			i++
+		case quote:
+			// the doubled quote is the escaped quote
+			if i+1 < len(condition) && condition[i+1] == quote {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+func isWordStart(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isWordCharacter(c byte) bool {
+	return isWordStart(c) || (c >= '0' && c <= '9')
+}
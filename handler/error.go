@@ -0,0 +1,37 @@
+package handler
+
+import "regexp"
+
+// ErrorCode is returned in the CodeParameter of the failed reply.
+// It lets the client distinguish the reason of the failure without parsing the message.
+//
+// The code also prefixes the message in the brackets, for example "[not_found] not found",
+// since the clients of the remote service receive only the message of the failure.
+type ErrorCode string
+
+// CodeParameter is the name of the failed reply parameter that keeps the ErrorCode
+const CodeParameter = "code"
+
+const (
+	AccessDenied ErrorCode = "access_denied" // the client service is not allowed to execute the command
+	ReadOnly     ErrorCode = "read_only"     // the write command is rejected, since the extension is in read-only mode
+	Maintenance  ErrorCode = "maintenance"   // the command is rejected, since the extension is in maintenance mode
+	NotFound     ErrorCode = "not_found"     // SELECT_ROW matched no rows
+)
+
+// codePattern is the error code that prefixes the message
+var codePattern = regexp.MustCompile(`\[([a-z_]+)] `)
+
+// Message returns the message prefixed by the error code
+func (code ErrorCode) Message(message string) string {
+	return "[" + string(code) + "] " + message
+}
+
+// ErrorCodeOf returns the error code of the failure message, or an empty code if there is none
+func ErrorCodeOf(message string) ErrorCode {
+	matches := codePattern.FindStringSubmatch(message)
+	if len(matches) < 2 {
+		return ""
+	}
+	return ErrorCode(matches[1])
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Expectation is the compare-and-swap condition of UPDATE.
+// The row is updated only if the column has the expected value,
+// otherwise the update replies UpdateReply with the Conflict flag and the current row.
+//
+// Example, update the configuration that wasn't changed by another service:
+//
+//	DatabaseQueryRequest{
+//		Tables:    []string{"configuration"},
+//		Fields:    []string{"value"},
+//		Where:     "name = ?",
+//		Arguments: []interface{}{"new value", "indexer"},
+//		Expect:    &Expectation{Column: "version", Value: 3, Increment: true},
+//	}
+type Expectation struct {
+	Column    string      `json:"column"`
+	Value     interface{} `json:"value"`               // the null expects the null column
+	Increment bool        `json:"increment,omitempty"` // the column is the version, that the update increments
+}
+
+// CompileExpectation adds the expected value of the column to the Where of UPDATE.
+// If the Increment is true, then the column is incremented by the update.
+// Call it after ExpandLists, and before CompileOperations and CompileJson.
+//
+// Returns the request that selects the expected column and the Fields of the current row,
+// if it doesn't have the expected value.
+// It's nil if the request has no expectation.
+//
+// The Expect is cleared, so calling it twice has no effect.
+func (request *DatabaseQueryRequest) CompileExpectation() (*DatabaseQueryRequest, error) {
+	if request.Expect == nil {
+		return nil, nil
+	}
+	expect := *request.Expect
+
+	if err := validateColumn(expect.Column); err != nil {
+		return nil, err
+	}
+	if len(request.Where) == 0 {
+		return nil, fmt.Errorf("missing Where, the expectation is the condition on the matched rows")
+	}
+	if len(request.Fields) > len(request.Arguments) {
+		return nil, fmt.Errorf("missing Arguments for Fields")
+	}
+	if expect.Increment {
+		for _, field := range request.Fields {
+			if field == expect.Column {
+				return nil, fmt.Errorf("the incremented '%s' column is in Fields", field)
+			}
+		}
+		for _, operation := range request.Operations {
+			if operation.Field == expect.Column {
+				return nil, fmt.Errorf("the incremented '%s' column is in Operations", operation.Field)
+			}
+		}
+	}
+
+	value := expect.Value
+	switch typed := value.(type) {
+	case json.Number:
+		value = numberArgument(typed)
+	case []interface{}, map[string]interface{}:
+		return nil, fmt.Errorf("the expected value of '%s' is not scalar", expect.Column)
+	}
+
+	// the current row has only the expected column and the updated fields,
+	// since the service could have no access to the rest of the columns
+	fields := []string{expect.Column}
+	for _, field := range request.Fields {
+		if field != expect.Column {
+			fields = append(fields, field)
+		}
+	}
+	whereArguments := request.Arguments[len(request.Fields):]
+	current := &DatabaseQueryRequest{
+		Tables:        request.Tables,
+		Fields:        fields,
+		Where:         "(" + request.Where + ") AND NOT (" + expect.Column + " <=> ?)",
+		Arguments:     append(append(make([]interface{}, 0, len(whereArguments)+1), whereArguments...), value),
+		JsonFilters:   request.JsonFilters,
+		TransactionId: request.TransactionId,
+		Typed:         request.Typed,
+	}
+
+	// <=> matches the null to the null
+	request.Where = "(" + request.Where + ") AND " + expect.Column + " <=> ?"
+	request.Arguments = append(request.Arguments, value)
+	if expect.Increment {
+		if err := request.addAssignments([]string{expect.Column + " = COALESCE(" + expect.Column + ", 0) + 1"}, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	request.Expect = nil
+	return current, nil
+}
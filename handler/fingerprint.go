@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// placeholderList matches the list of placeholders, for example in IN (?, ?, ?)
+var placeholderList = regexp.MustCompile(`\?(, \?)+`)
+
+// Fingerprint normalises the query for grouping the statistics.
+//
+// The string and number literals are replaced by '?',
+// the whitespaces are collapsed and the list of placeholders becomes a single '?'.
+// The comma is always followed by one space.
+// The identifiers are kept as they are.
+//
+// Example:
+//
+//	SELECT * FROM abi WHERE abi_id = 'abc' AND block_number IN (1, 2, ?)
+//	SELECT * FROM abi WHERE abi_id = ? AND block_number IN (?)
+func Fingerprint(query string) string {
+	runes := []rune(query)
+	var str strings.Builder
+	space := false
+
+	write := func(token string) {
+		if str.Len() > 0 {
+			written := str.String()
+			last := written[len(written)-1]
+			if last == ',' || (space && last != '(' && token != ")" && token != ",") {
+				str.WriteRune(' ')
+			}
+		}
+		space = false
+		str.WriteString(token)
+	}
+
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			space = true
+		case c == '\'' || c == '"':
+			i = closingQuote(runes, i)
+			write("?")
+		case c == '`':
+			end := closingQuote(runes, i)
+			if end >= len(runes) {
+				end = len(runes) - 1
+			}
+			write(string(runes[i : end+1]))
+			i = end
+		case unicode.IsDigit(c):
+			for i+1 < len(runes) && (isIdentifierRune(runes[i+1]) || runes[i+1] == '.') {
+				i++
+			}
+			write("?")
+		case isIdentifierRune(c):
+			start := i
+			for i+1 < len(runes) && isIdentifierRune(runes[i+1]) {
+				i++
+			}
+			write(string(runes[start : i+1]))
+		default:
+			write(string(c))
+		}
+	}
+
+	return placeholderList.ReplaceAllString(str.String(), "?")
+}
+
+// closingQuote returns the position of the quote that closes the quote at the start.
+// The escaped quotes by backslash or by doubling are skipped.
+func closingQuote(runes []rune, start int) int {
+	quote := runes[start]
+	for i := start + 1; i < len(runes); i++ {
+		if runes[i] == '\\' && quote != '`' {
+			i++
+			continue
+		}
+		if runes[i] != quote {
+			continue
+		}
+		if i+1 < len(runes) && runes[i+1] == quote {
+			i++
+			continue
+		}
+		return i
+	}
+
+	return len(runes)
+}
+
+func isIdentifierRune(c rune) bool {
+	return c == '_' || c == '$' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// Define the suite, and absorb the built-in basic suite
+// functionality from testify - including a T() method which
+// returns the current testing context
+type TestFingerprintSuite struct {
+	suite.Suite
+}
+
+func (suite *TestFingerprintSuite) TestLiterals() {
+	query := `SELECT abi_id FROM abi WHERE abi_id = 'it''s \'quoted\'' AND block_number > 100 AND address = "0x1F"`
+	expected := `SELECT abi_id FROM abi WHERE abi_id = ? AND block_number > ? AND address = ?`
+	suite.Require().Equal(expected, Fingerprint(query))
+
+	// the digits in the identifiers are kept
+	query = "SELECT `table1`.field2 FROM table1 WHERE field2=0x1f"
+	expected = "SELECT `table1`.field2 FROM table1 WHERE field2=?"
+	suite.Require().Equal(expected, Fingerprint(query))
+}
+
+func (suite *TestFingerprintSuite) TestWhitespaces() {
+	query := "INSERT INTO abi (abi_id, body) VALUES ( ?, ?) "
+	expected := "INSERT INTO abi (abi_id, body) VALUES (?)"
+	suite.Require().Equal(expected, Fingerprint(query))
+
+	// the placeholder lists of different lengths have the same fingerprint
+	first := Fingerprint("SELECT * FROM abi WHERE  abi_id IN (1, 2,3)")
+	second := Fingerprint("SELECT *\n FROM abi WHERE abi_id IN ( ? )")
+	suite.Require().Equal(first, second)
+	suite.Require().Equal("SELECT * FROM abi WHERE abi_id IN (?)", first)
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestFingerprint(t *testing.T) {
+	suite.Run(t, new(TestFingerprintSuite))
+}
@@ -2,8 +2,13 @@
 package handler
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"github.com/Seascape-Foundation/mysql-seascape-extension/schema"
 	"github.com/Seascape-Foundation/sds-common-lib/data_type"
+	"strconv"
+	"strings"
 
 	"github.com/Seascape-Foundation/sds-common-lib/data_type/key_value"
 	"github.com/Seascape-Foundation/sds-service-lib/communication/command"
@@ -19,8 +24,50 @@ const (
 	UPDATE         command.Name = "update"          // update the existing row
 	EXIST          command.Name = "exist"           // Returns true or false if select query has some rows
 	DELETE         command.Name = "delete"          // Delete some rows from database
+	QueryStats     command.Name = "query-stats"     // Returns the aggregated statistics of the executed queries
+	STATUS         command.Name = "status"          // Returns the state of the extension
+	SetMode        command.Name = "set-mode"        // Switches the extension to read-write, read-only or maintenance mode
+	MigrateStatus  command.Name = "migrate-status"  // Returns the list of the migrations and whether they are applied
+	MigrateUp      command.Name = "migrate-up"      // Applies the pending migrations
+	MigrateDown    command.Name = "migrate-down"    // Rolls back the latest migration
+	SchemaDiff     command.Name = "schema-diff"     // Returns the differences between the live schema and the migrations
+	ListTables     command.Name = "list-tables"     // Returns the tables of the database
+	DescribeTable  command.Name = "describe-table"  // Returns the columns, keys and indexes of the tables
+	COUNT          command.Name = "count"           // Returns the amount of rows that match to the query
+	TxBegin        command.Name = "tx-begin"        // Starts the transaction
+	TxCommit       command.Name = "tx-commit"       // Commits the transaction
+	TxRollback     command.Name = "tx-rollback"     // Rolls back the transaction
+	AGGREGATE      command.Name = "aggregate"       // Returns COUNT, SUM, MIN, MAX or AVG of the rows grouped by the columns
+	ChunkedStart   command.Name = "chunked-start"   // Starts the background delete or update in batches
+	ChunkedStatus  command.Name = "chunked-status"  // Returns the progress of the chunked delete or update
+	ChunkedCancel  command.Name = "chunked-cancel"  // Stops the chunked delete or update after the current batch
+	LockAcquire    command.Name = "lock-acquire"    // Acquires the named lock shared by the services
+	LockRelease    command.Name = "lock-release"    // Releases the named lock
+	LockStatus     command.Name = "lock-status"     // Returns whether the named lock is held and by which service
+	QueuePush      command.Name = "queue-push"      // Adds the job to the queue
+	QueueClaim     command.Name = "queue-claim"     // Claims the visible jobs of the queue for the visibility timeout
+	QueueAck       command.Name = "queue-ack"       // Removes the processed job from the queue
+	QueueNack      command.Name = "queue-nack"      // Returns the failed job to the queue, or dead-letters it after the last attempt
+	OutboxReplay   command.Name = "outbox-replay"   // Publishes the outbox messages again, starting from the id
 )
 
+// Mode of the extension, that defines which commands are accepted
+type Mode string
+
+const (
+	ReadWriteMode   Mode = "read-write"  // all commands are accepted
+	ReadOnlyMode    Mode = "read-only"   // the write commands are rejected
+	MaintenanceMode Mode = "maintenance" // all commands except status and set-mode are rejected
+)
+
+// Validate the mode
+func (mode Mode) Validate() error {
+	if mode != ReadWriteMode && mode != ReadOnlyMode && mode != MaintenanceMode {
+		return fmt.Errorf("mode is either '%s', '%s' or '%s', but given: '%s'", ReadWriteMode, ReadOnlyMode, MaintenanceMode, mode)
+	}
+	return nil
+}
+
 // DatabaseQueryRequest has the sql and it's parameters on part with commands.
 type DatabaseQueryRequest struct {
 	// Fields to manipulate,
@@ -31,16 +78,126 @@ type DatabaseQueryRequest struct {
 	Tables    []string      `json:"tables"`              // Tables that are used for query
 	Where     string        `json:"where,omitempty"`     // WHERE part of the SQL query
 	Arguments []interface{} `json:"arguments,omitempty"` // to pass in where clause
+	// W3C trace context of the caller, the database spans become its children
+	TraceParent string `json:"traceparent,omitempty"`
+	// The transaction started by TX_BEGIN. If it's empty, then the query is executed outside the transaction
+	TransactionId string `json:"transaction_id,omitempty"`
+	// If true, then SELECT and SELECT_ROW replies include the column metadata
+	// and the values are encoded by EncodeValue
+	Typed bool `json:"typed,omitempty"`
+	// Predicates on the JSON columns, compiled into the Where by CompileJson
+	JsonFilters []JsonFilter `json:"json_filters,omitempty"`
+	// Partial changes of the JSON columns in UPDATE, compiled by CompileJson
+	JsonPatches []JsonPatch `json:"json_patches,omitempty"`
+	// Atomic changes of the fields in UPDATE, compiled by CompileOperations
+	Operations []FieldOperation `json:"operations,omitempty"`
+	// The compare-and-swap condition of UPDATE, compiled by CompileExpectation
+	Expect *Expectation `json:"expect,omitempty"`
+	// The messages published by the outbox relay, if INSERT, UPDATE or DELETE changed any rows
+	Outbox []OutboxMessage `json:"outbox,omitempty"`
+
+	// DELETE command deletes all rows of the table, if it's true and Where is empty
+	AllRows bool `json:"all_rows,omitempty"`
+	// ORDER BY columns of SELECT and DELETE commands, with the optional ASC or DESC
+	OrderBy []string `json:"order_by,omitempty"`
+	// The maximum amount of rows selected by SELECT or deleted by DELETE command. If it's zero, then no limit
+	Limit uint64 `json:"limit,omitempty"`
+	// Locks the rows selected in the transaction
+	Lock *RowLock `json:"lock,omitempty"`
+	// The tables joined to the Tables, for SELECT, SELECT_ROW, EXIST, COUNT and AGGREGATE commands
+	Joins []Join `json:"joins,omitempty"`
+	// The aggregate functions of AGGREGATE command
+	Aggregations []Aggregation `json:"aggregations,omitempty"`
+	// GROUP BY columns of AGGREGATE command, returned along with the aggregations
+	GroupBy []string `json:"group_by,omitempty"`
+	// HAVING conditions of AGGREGATE command, joined by AND
+	Having []HavingCondition `json:"having,omitempty"`
+
+	assignments         []string // the compiled Operations and JsonPatches of UPDATE
+	assignmentArguments int      // the amount of the arguments of the assignments
 }
 
+// UnmarshalJSON decodes the request keeping the precision of the numeric arguments.
+//
+// The integers are decoded as int64 or uint64 instead of float64.
+// The integers that don't fit into uint64 are kept as the strings.
+func (request *DatabaseQueryRequest) UnmarshalJSON(data []byte) error {
+	type plain DatabaseQueryRequest
+	var decoded plain
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&decoded); err != nil {
+		return err
+	}
+	for i, argument := range decoded.Arguments {
+		if number, ok := argument.(json.Number); ok {
+			decoded.Arguments[i] = numberArgument(number)
+		}
+	}
+	for i, condition := range decoded.Having {
+		if number, ok := condition.Value.(json.Number); ok {
+			decoded.Having[i].Value = numberArgument(number)
+		}
+	}
+
+	*request = DatabaseQueryRequest(decoded)
+	return nil
+}
+
+// numberArgument converts the json number into the go number that the mysql driver accepts
+func numberArgument(number json.Number) interface{} {
+	if value, err := number.Int64(); err == nil {
+		return value
+	}
+	if value, err := strconv.ParseUint(number.String(), 10, 64); err == nil {
+		return value
+	}
+	if strings.ContainsAny(number.String(), ".eE") {
+		if value, err := number.Float64(); err == nil {
+			return value
+		}
+	}
+
+	return number.String()
+}
+
+// CountReply keeps the parameters of COUNT command reply by controller
+type CountReply struct {
+	Count uint64 `json:"count"`
+}
+
+// AggregateReply keeps the parameters of AGGREGATE command reply by controller.
+// The values are encoded by EncodeValue.
+type AggregateReply struct {
+	Rows    []key_value.KeyValue `json:"rows"` // the group by columns and the aggregations
+	Columns []ColumnMetadata     `json:"columns"`
+}
+
+// TxBeginReply keeps the parameters of TX_BEGIN command reply by controller.
+// The TransactionId is passed in the DatabaseQueryRequest to execute the query in the transaction.
+type TxBeginReply struct {
+	TransactionId string `json:"transaction_id"`
+}
+
+// TxRequest keeps the parameters of TX_COMMIT and TX_ROLLBACK commands.
+type TxRequest struct {
+	TransactionId string `json:"transaction_id"`
+}
+
+// TxReply keeps the parameters of TX_COMMIT and TX_ROLLBACK commands reply by controller
+type TxReply struct{}
+
 // SelectRowReply keeps the parameters of READ_ROW command reply by controller
 type SelectRowReply struct {
-	Outputs key_value.KeyValue `json:"outputs"` // all column parameters returned back to user
+	Outputs key_value.KeyValue `json:"outputs"`           // all column parameters returned back to user
+	Columns []ColumnMetadata   `json:"columns,omitempty"` // in the typed mode only
 }
 
 // SelectAllReply keeps the parameters of READ_ALL command reply by controller
 type SelectAllReply struct {
-	Rows []key_value.KeyValue `json:"rows"` // list of rows returned back to user
+	Rows    []key_value.KeyValue `json:"rows"`              // list of rows returned back to user
+	Columns []ColumnMetadata     `json:"columns,omitempty"` // in the typed mode only
 }
 
 // InsertReply keeps the parameters of WRITE command reply by controller
@@ -55,7 +212,103 @@ type ExistReply struct {
 type DeleteReply struct{}
 
 // UpdateReply keeps the parameters of UPDATE command reply by controller
-type UpdateReply struct{}
+type UpdateReply struct {
+	// The row doesn't have the expected value of Expectation, so it's not updated
+	Conflict bool `json:"conflict,omitempty"`
+	// The current row of the conflict, with the expected column and the updated fields
+	Row key_value.KeyValue `json:"row,omitempty"`
+}
+
+// StatusReply keeps the parameters of STATUS command reply by controller
+type StatusReply struct {
+	Mode      Mode `json:"mode"`      // current mode of the extension
+	Connected bool `json:"connected"` // true if the database connection is established
+}
+
+// SetModeRequest keeps the parameters of SET_MODE command
+type SetModeRequest struct {
+	Mode Mode `json:"mode"`
+}
+
+// SetModeReply keeps the parameters of SET_MODE command reply by controller
+type SetModeReply struct {
+	Previous Mode `json:"previous"` // the mode before switching
+	Mode     Mode `json:"mode"`     // the current mode
+}
+
+// MigrateRequest keeps the parameters of MIGRATE_UP and MIGRATE_DOWN commands.
+//
+// For MIGRATE_UP, if the Version is zero, then all pending migrations are applied.
+// For MIGRATE_DOWN, if the Version is zero, then only the latest migration is rolled back.
+// Otherwise, the database is migrated up or down to the Version.
+type MigrateRequest struct {
+	Version int64 `json:"version,omitempty"`
+}
+
+// MigrateReply keeps the parameters of MIGRATE_UP and MIGRATE_DOWN commands reply by controller
+type MigrateReply struct {
+	Previous int64 `json:"previous"` // schema version before migration
+	Version  int64 `json:"version"`  // schema version after migration
+}
+
+// MigrationStatus is the state of the single migration
+type MigrationStatus struct {
+	Version   int64  `json:"version"`
+	Source    string `json:"source"` // file name of the migration
+	Applied   bool   `json:"applied"`
+	AppliedAt string `json:"applied_at,omitempty"`
+}
+
+// MigrateStatusReply keeps the parameters of MIGRATE_STATUS command reply by controller
+type MigrateStatusReply struct {
+	Version    int64             `json:"version"` // current schema version
+	Migrations []MigrationStatus `json:"migrations"`
+}
+
+// SchemaDiffReply keeps the parameters of SCHEMA_DIFF command reply by controller.
+// The Differences are empty if the live schema matches the migrations.
+type SchemaDiffReply struct {
+	Drift       bool                `json:"drift"`
+	Differences []schema.Difference `json:"differences"`
+}
+
+// ListTablesReply keeps the parameters of LIST_TABLES command reply by controller
+type ListTablesReply struct {
+	Tables []schema.Summary `json:"tables"`
+}
+
+// DescribeTableRequest keeps the parameters of DESCRIBE_TABLE command.
+type DescribeTableRequest struct {
+	Tables []string `json:"tables"` // the tables to describe
+}
+
+// DescribeTableReply keeps the parameters of DESCRIBE_TABLE command reply by controller
+type DescribeTableReply struct {
+	Tables []schema.Table `json:"tables"`
+}
+
+// QueryStatsRequest keeps the parameters of QUERY_STATS command.
+type QueryStatsRequest struct {
+	Reset bool `json:"reset,omitempty"` // if true, then clears the statistics after returning them
+}
+
+// QueryStat is the aggregated statistics of the queries with the same fingerprint.
+// The time is in milliseconds.
+type QueryStat struct {
+	Fingerprint string   `json:"fingerprint"`  // query without literals
+	Tables      []string `json:"tables"`       // tables that are used in query
+	Calls       uint64   `json:"calls"`        // amount of executions
+	Rows        uint64   `json:"rows"`         // total rows returned or affected
+	TotalTime   float64  `json:"total_time"`   // total execution time
+	AverageTime float64  `json:"average_time"` // average execution time
+	MaxTime     float64  `json:"max_time"`     // the slowest execution time
+}
+
+// QueryStatsReply keeps the parameters of QUERY_STATS command reply by controller.
+// The statistics are sorted by the total time, the most expensive queries are first.
+type QueryStatsReply struct {
+	Stats []QueryStat `json:"stats"`
+}
 
 // PullerEndpoint returns the inproc pull controller to
 // database.
@@ -85,6 +338,9 @@ func PushSocket() (*zmq.Socket, error) {
 // DeserializeBytes the bytes array are accepted as base64 string with "==" tail.
 // deserialize it into the sequence of the bytes.
 //
+// The bytes are accepted with the "sds_json:" prefix as they are,
+// or with Base64Prefix as the base64 string, that keeps any binary value.
+//
 // If no arguments were given, or no need to serialize, then return nil
 func (request DatabaseQueryRequest) DeserializeBytes() error {
 	for i, rawArg := range request.Arguments {
@@ -92,6 +348,14 @@ func (request DatabaseQueryRequest) DeserializeBytes() error {
 		if !ok {
 			continue
 		}
+		value, ok, err := DecodeBase64Prefixed(baseStr)
+		if err != nil {
+			return fmt.Errorf("argument %d: %w", i, err)
+		}
+		if ok {
+			request.Arguments[i] = value
+			continue
+		}
 		str := data_type.DecodeJsonPrefixed(baseStr)
 		if len(str) > 0 {
 			request.Arguments[i] = []byte(str)
@@ -127,20 +391,61 @@ func (request DatabaseQueryRequest) BuildSelectQuery() (string, error) {
 		str += ` FROM `
 	}
 
-	lastTableIndex := len(request.Tables) - 1
-	for i, table := range request.Tables {
-		str += table
-		if i < lastTableIndex {
-			str += `, `
-		}
+	from, err := request.from()
+	if err != nil {
+		return "", err
 	}
+	str += from
 
 	str += ` WHERE `
 	if len(request.Where) == 0 {
-		return str + ` 1 `, nil
+		str += ` 1 `
 	} else {
-		return str + request.Where, nil
+		str += request.Where
+	}
+
+	if len(request.OrderBy) > 0 {
+		orderBy, err := orderByClause(request.OrderBy)
+		if err != nil {
+			return "", err
+		}
+		str += ` ORDER BY ` + orderBy
+	}
+	if request.Limit > 0 {
+		str += ` LIMIT ` + strconv.FormatUint(request.Limit, 10)
 	}
+	lock, err := request.lockClause()
+	if err != nil {
+		return "", err
+	}
+
+	return str + lock, nil
+}
+
+// BuildCountQuery creates a SELECT COUNT(*) SQL query
+func (request DatabaseQueryRequest) BuildCountQuery() (string, error) {
+	if len(request.Tables) == 0 {
+		return "", fmt.Errorf("missing Tables parameter")
+	}
+	if len(request.Where) > 0 && len(request.Arguments) == 0 {
+		return "", fmt.Errorf("missing Arguments for Where clause")
+	}
+
+	if request.Lock != nil {
+		return "", fmt.Errorf("the row lock is supported only by SELECT, SELECT_ROW and EXIST")
+	}
+
+	str := `SELECT COUNT(*) FROM `
+	from, err := request.from()
+	if err != nil {
+		return "", err
+	}
+	str += from
+
+	if len(request.Where) == 0 {
+		return str, nil
+	}
+	return str + ` WHERE ` + request.Where, nil
 }
 
 func (request DatabaseQueryRequest) BuildExistQuery() (string, error) {
@@ -155,31 +460,38 @@ func (request DatabaseQueryRequest) BuildExistQuery() (string, error) {
 	}
 
 	str := `SELECT 1 FROM `
-	lastTableIndex := len(request.Tables) - 1
-	for i, table := range request.Tables {
-		str += table
-		if i < lastTableIndex {
-			str += `, `
-		}
+	from, err := request.from()
+	if err != nil {
+		return "", err
 	}
+	str += from
 
-	str += ` WHERE ` + request.Where
+	lock, err := request.lockClause()
+	if err != nil {
+		return "", err
+	}
+	str += ` WHERE ` + request.Where + lock
 	return str, nil
 }
 
 // BuildSelectRowQuery creates a SELECT SQL query for fetching one row
 func (request DatabaseQueryRequest) BuildSelectRowQuery() (string, error) {
+	// the limit precedes the lock clause
+	request.Limit = 1
 	query, err := request.BuildSelectQuery()
 	if err != nil {
 		return "", fmt.Errorf("BuildSelectQuery: %w", err)
 	}
 
-	return query + " LIMIT 1 ", nil
+	return query, nil
 }
 
 // BuildUpdateQuery creates an UPDATE SQL query
 func (request DatabaseQueryRequest) BuildUpdateQuery() (string, error) {
-	if len(request.Fields) == 0 {
+	if len(request.Joins) > 0 {
+		return "", fmt.Errorf("the joins are supported only by the select queries")
+	}
+	if len(request.Fields) == 0 && len(request.assignments) == 0 {
 		return "", fmt.Errorf("missing Fields parameter")
 	}
 	if len(request.Tables) == 0 {
@@ -203,14 +515,13 @@ func (request DatabaseQueryRequest) BuildUpdateQuery() (string, error) {
 	}
 
 	str += ` SET `
-	// the fields
-	lastFieldIndex := len(request.Fields) - 1
-	for i, field := range request.Fields {
-		str += field + " = ?"
-		if i < lastFieldIndex {
-			str += `, `
-		}
+	// the fields, the operations and the json patches
+	assignments := make([]string, 0, len(request.Fields)+len(request.assignments))
+	for _, field := range request.Fields {
+		assignments = append(assignments, field+" = ?")
 	}
+	assignments = append(assignments, request.assignments...)
+	str += strings.Join(assignments, ", ")
 	str += " WHERE " + request.Where
 
 	return str, nil
@@ -218,6 +529,9 @@ func (request DatabaseQueryRequest) BuildUpdateQuery() (string, error) {
 
 // BuildInsertRowQuery creates an INSERT INTO SQL query
 func (request DatabaseQueryRequest) BuildInsertRowQuery() (string, error) {
+	if len(request.Joins) > 0 {
+		return "", fmt.Errorf("the joins are supported only by the select queries")
+	}
 	if len(request.Fields) == 0 {
 		return "", fmt.Errorf("missing Fields parameter")
 	}
@@ -260,38 +574,67 @@ func (request DatabaseQueryRequest) BuildInsertRowQuery() (string, error) {
 	return str, nil
 }
 
-// BuildDeleteQuery creates DELETE FROM SQL query
+// BuildDeleteQuery creates DELETE FROM SQL query.
+//
+// The rows are filtered by Where, deleting all rows requires AllRows.
+// The OrderBy and Limit bound the amount of the deleted rows.
 func (request DatabaseQueryRequest) BuildDeleteQuery() (string, error) {
-	if len(request.Fields) == 0 {
-		return "", fmt.Errorf("missing Fields parameter")
+	if len(request.Joins) > 0 {
+		return "", fmt.Errorf("the joins are supported only by the select queries")
 	}
-	if len(request.Tables) == 0 {
-		return "", fmt.Errorf("missing Tables parameter")
+	if len(request.Tables) != 1 {
+		return "", fmt.Errorf("delete requires exactly one table in Tables")
 	}
-
-	str := `DELETE FROM `
-	// tables
-	lastTableIndex := len(request.Tables) - 1
-	for i, table := range request.Tables {
-		str += table
-		if i < lastTableIndex {
-			str += `, `
+	if len(request.Where) == 0 {
+		if len(request.Fields) > 0 {
+			return "", fmt.Errorf("the delete conditions are set in Where, not in Fields")
 		}
+		if !request.AllRows {
+			return "", fmt.Errorf("missing Where parameter, deleting all rows requires AllRows")
+		}
+	} else if len(request.Arguments) == 0 {
+		return "", fmt.Errorf("missing Arguments for Where clause")
 	}
 
-	if len(request.Where) == 0 {
-		return str, nil
+	str := `DELETE FROM ` + request.Tables[0]
+	if len(request.Where) > 0 {
+		str += ` WHERE ` + request.Where
 	}
 
-	str += ` WHERE `
-	// the fields
-	lastFieldIndex := len(request.Fields) - 1
-	for i, field := range request.Fields {
-		str += field
-		if i < lastFieldIndex {
-			str += ` AND `
+	if len(request.OrderBy) > 0 {
+		orderBy, err := orderByClause(request.OrderBy)
+		if err != nil {
+			return "", err
 		}
+		str += ` ORDER BY ` + orderBy
+	}
+	if request.Limit > 0 {
+		str += ` LIMIT ` + strconv.FormatUint(request.Limit, 10)
 	}
 
 	return str, nil
 }
+
+// orderByClause returns the validated columns of ORDER BY clause.
+// Each column has the optional ASC or DESC direction.
+func orderByClause(orderBy []string) (string, error) {
+	columns := make([]string, len(orderBy))
+	for i, order := range orderBy {
+		parts := strings.Fields(order)
+		if len(parts) == 0 || len(parts) > 2 {
+			return "", fmt.Errorf("invalid order by '%s'", order)
+		}
+		if err := validateColumn(parts[0]); err != nil {
+			return "", fmt.Errorf("order by: %w", err)
+		}
+		if len(parts) == 2 {
+			direction := strings.ToUpper(parts[1])
+			if direction != "ASC" && direction != "DESC" {
+				return "", fmt.Errorf("invalid order by direction '%s'", parts[1])
+			}
+			parts[1] = direction
+		}
+		columns[i] = strings.Join(parts, " ")
+	}
+	return strings.Join(columns, ", "), nil
+}
@@ -0,0 +1,670 @@
+package handler
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Seascape-Foundation/sds-common-lib/data_type/key_value"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/command"
+	"github.com/stretchr/testify/suite"
+)
+
+// Define the suite, and absorb the built-in basic suite
+// functionality from testify - including a T() method which
+// returns the current testing context
+type TestHandlerSuite struct {
+	suite.Suite
+}
+
+func (suite *TestHandlerSuite) TestArgumentPrecision() {
+	raw := `{"tables":["indexer_event"],"where":"block_number = ? AND log_index = ? AND amount = ? AND price = ? AND network_id = ?",
+"arguments":[18446744073709551615, -5, 115792089237316195423570985008687907853269984665640564039457584007913129639935, 1.5, "56"]}`
+	parameters, err := key_value.NewFromString(raw)
+	suite.Require().NoError(err)
+
+	var request DatabaseQueryRequest
+	suite.Require().NoError(parameters.Interface(&request))
+	suite.Require().Equal([]interface{}{
+		uint64(18446744073709551615),
+		int64(-5),
+		"115792089237316195423570985008687907853269984665640564039457584007913129639935",
+		1.5,
+		"56",
+	}, request.Arguments)
+	suite.Require().Equal([]string{"indexer_event"}, request.Tables)
+}
+
+func (suite *TestHandlerSuite) TestCountQuery() {
+	request := DatabaseQueryRequest{Tables: []string{"abi"}}
+	query, err := request.BuildCountQuery()
+	suite.Require().NoError(err)
+	suite.Require().Equal("SELECT COUNT(*) FROM abi", query)
+
+	request.Where = "abi_id = ?"
+	_, err = request.BuildCountQuery()
+	suite.Require().Error(err)
+
+	request.Arguments = []interface{}{"1"}
+	query, err = request.BuildCountQuery()
+	suite.Require().NoError(err)
+	suite.Require().Equal("SELECT COUNT(*) FROM abi WHERE abi_id = ?", query)
+}
+
+func (suite *TestHandlerSuite) TestEncodeValue() {
+	cases := []struct {
+		databaseType string
+		raw          interface{}
+		expected     interface{}
+	}{
+		{"UNSIGNED BIGINT", []byte("18446744073709551615"), "18446744073709551615"},
+		{"BIGINT", int64(-5), "-5"},
+		{"DECIMAL", []byte("12345678901234567890.123"), "12345678901234567890.123"},
+		{"UNSIGNED SMALLINT", []byte("65535"), uint64(65535)},
+		{"INT", int64(-1), int64(-1)},
+		{"DOUBLE", []byte("1.5"), 1.5},
+		{"JSON", []byte(`{"a":1}`), map[string]interface{}{"a": json.Number("1")}},
+		{"VARBINARY", []byte{0, 1, 2}, "sds_base64:AAEC"},
+		{"BLOB", []byte("a"), "sds_base64:YQ=="},
+		{"VARCHAR", []byte("text"), "text"},
+		{"DATETIME", []byte("2023-03-08 17:10:23"), "2023-03-08 17:10:23"},
+		{"BIGINT", nil, nil},
+	}
+
+	for _, c := range cases {
+		value, err := EncodeValue(c.databaseType, c.raw)
+		suite.Require().NoError(err, c.databaseType)
+		suite.Require().Equal(c.expected, value, c.databaseType)
+	}
+
+	_, err := EncodeValue("JSON", []byte("{"))
+	suite.Require().Error(err)
+	_, err = EncodeValue("INT", []byte("a"))
+	suite.Require().Error(err)
+
+	// the NULL column is omitted, so the reply passes the validation
+	row := key_value.Empty()
+	suite.Require().NoError(SetEncodedValue(row, "log_index", "INT", nil))
+	suite.Require().NoError(SetEncodedValue(row, "raw", "VARBINARY", []byte{0, 1, 2}))
+	_, err = row.GetString("log_index")
+	suite.Require().Error(err)
+	_, err = command.Reply(&SelectRowReply{Outputs: row})
+	suite.Require().NoError(err)
+
+	// the native JSON column is the decoded value, the JSON null is omitted
+	suite.Require().NoError(SetEncodedValue(row, "event_parameters", "JSON", []byte(`{"value":12345678901234567890}`)))
+	suite.Require().NoError(SetEncodedValue(row, "body", "JSON", []byte(`null`)))
+	suite.Require().Error(SetEncodedValue(row, "body", "JSON", []byte(`{`)))
+	reply, err := Reply(&SelectRowReply{Outputs: row})
+	suite.Require().NoError(err)
+	outputs, err := reply.Parameters.GetKeyValue("outputs")
+	suite.Require().NoError(err)
+	eventParameters, err := outputs.GetKeyValue("event_parameters")
+	suite.Require().NoError(err)
+	suite.Require().Equal(json.Number("12345678901234567890"), eventParameters["value"])
+	suite.Require().NotContains(outputs, "body")
+
+	// the typed JSON column keeps the precision in the reply
+	parameters, err := EncodeValue("JSON", []byte(`{"value":12345678901234567890,"list":[1.5,null]}`))
+	suite.Require().NoError(err)
+	typedRow := key_value.Empty().Set("event_parameters", parameters)
+	typedReply, err := Reply(&SelectRowReply{Outputs: typedRow})
+	suite.Require().NoError(err)
+	encoded, err := typedReply.Parameters.String()
+	suite.Require().NoError(err)
+	suite.Require().Contains(encoded, `"value":12345678901234567890`)
+	_, err = EncodeValue("JSON", []byte(`{} {}`))
+	suite.Require().Error(err)
+
+	value, ok, err := DecodeBase64Prefixed("sds_base64:AAEC")
+	suite.Require().NoError(err)
+	suite.Require().True(ok)
+	suite.Require().Equal([]byte{0, 1, 2}, value)
+}
+
+func (suite *TestHandlerSuite) TestCompileJson() {
+	request := DatabaseQueryRequest{
+		Tables:    []string{"indexer_event"},
+		Where:     "network_id = ?",
+		Arguments: []interface{}{"56"},
+		JsonFilters: []JsonFilter{
+			{Column: "event_parameters", Path: "$.to", Operator: "=", Value: "0xdead"},
+			{Column: "event_parameters", Path: "$.value", Operator: ">=", Value: json.Number("12345678901234567890")},
+			{Column: "event_parameters", Path: "$.ids", Operator: "contains", Value: 5},
+		},
+	}
+	suite.Require().NoError(request.CompileJson())
+	suite.Require().Equal("(network_id = ?) AND JSON_UNQUOTE(JSON_EXTRACT(event_parameters, ?)) = ? AND "+
+		"JSON_EXTRACT(event_parameters, ?) >= CAST(? AS JSON) AND JSON_CONTAINS(event_parameters, ?, ?)", request.Where)
+	suite.Require().Equal([]interface{}{"56", "$.to", "0xdead", "$.value", "12345678901234567890", "5", "$.ids"}, request.Arguments)
+	suite.Require().Nil(request.JsonFilters)
+
+	// compiled only once
+	suite.Require().NoError(request.CompileJson())
+	suite.Require().Len(request.Arguments, 7)
+
+	update := DatabaseQueryRequest{
+		Tables:    []string{"abi"},
+		Fields:    []string{"abi_id"},
+		Where:     "abi_id = ?",
+		Arguments: []interface{}{"abi_2", "abi_1"},
+		JsonPatches: []JsonPatch{
+			{Column: "body", Set: []JsonPathValue{{Path: "$.name", Value: "Transfer"}}, Remove: []string{"$.inputs[0]"}},
+		},
+	}
+	suite.Require().NoError(update.CompileJson())
+	query, err := update.BuildUpdateQuery()
+	suite.Require().NoError(err)
+	suite.Require().Equal("UPDATE abi SET abi_id = ?, body = JSON_REMOVE(JSON_SET(COALESCE(body, JSON_OBJECT()), ?, CAST(? AS JSON)), ?) WHERE abi_id = ?", query)
+	suite.Require().Equal([]interface{}{"abi_2", "$.name", `"Transfer"`, "$.inputs[0]", "abi_1"}, update.Arguments)
+
+	// the patch without fields
+	update = DatabaseQueryRequest{
+		Tables:      []string{"abi"},
+		Where:       "abi_id = ?",
+		Arguments:   []interface{}{"abi_1"},
+		JsonPatches: []JsonPatch{{Column: "body", Remove: []string{"$.name"}}},
+	}
+	suite.Require().NoError(update.CompileJson())
+	query, err = update.BuildUpdateQuery()
+	suite.Require().NoError(err)
+	suite.Require().Equal("UPDATE abi SET body = JSON_REMOVE(COALESCE(body, JSON_OBJECT()), ?) WHERE abi_id = ?", query)
+
+	invalid := []DatabaseQueryRequest{
+		{JsonFilters: []JsonFilter{{Column: "body", Path: "$.a') OR 1=1 --", Operator: "="}}},
+		{JsonFilters: []JsonFilter{{Column: "body; DROP TABLE abi", Path: "$.a", Operator: "="}}},
+		{JsonFilters: []JsonFilter{{Column: "body", Path: "$.a", Operator: "LIKE"}}},
+		{JsonPatches: []JsonPatch{{Column: "body", Remove: []string{"$.*"}}}},
+		{JsonPatches: []JsonPatch{{Column: "body"}}},
+	}
+	for _, request := range invalid {
+		suite.Require().Error(request.CompileJson())
+	}
+	suite.Require().NoError(ValidateJsonPath("$.items[0].id", false))
+	suite.Require().NoError(ValidateJsonPath("$[*].id", true))
+}
+
+func (suite *TestHandlerSuite) TestAggregateQuery() {
+	request := DatabaseQueryRequest{
+		Tables:    []string{"indexer_event"},
+		Where:     "network_id = ?",
+		Arguments: []interface{}{"56"},
+		GroupBy:   []string{"address"},
+		Aggregations: []Aggregation{
+			{Function: CountFunction},
+			{Function: CountDistinctFunction, Column: "transaction_id"},
+			{Function: MaxFunction, Column: "block_number", Alias: "latest"},
+		},
+		Having: []HavingCondition{
+			{Column: "count", Operator: ">", Value: int64(10)},
+			{Column: "address", Operator: "!=", Value: "0xdead"},
+		},
+	}
+	query, err := request.BuildAggregateQuery()
+	suite.Require().NoError(err)
+	suite.Require().Equal("SELECT address, COUNT(*) AS count, COUNT(DISTINCT transaction_id) AS count_distinct_transaction_id, "+
+		"MAX(block_number) AS latest FROM indexer_event WHERE network_id = ? GROUP BY address HAVING count > ? AND address != ?", query)
+	suite.Require().Equal([]interface{}{"56", int64(10), "0xdead"}, request.AggregateArguments())
+
+	invalid := []DatabaseQueryRequest{
+		{Tables: []string{"abi"}},
+		{Tables: []string{"abi"}, Aggregations: []Aggregation{{Function: SumFunction}}},
+		{Tables: []string{"abi"}, Aggregations: []Aggregation{{Function: "STDDEV", Column: "abi_id"}}},
+		{Tables: []string{"abi"}, Aggregations: []Aggregation{{Function: CountFunction, Column: "abi_id) FROM abi; --"}}},
+		{Tables: []string{"abi"}, Aggregations: []Aggregation{{Function: CountFunction, Alias: "a b"}}},
+		{Tables: []string{"abi"}, Aggregations: []Aggregation{{Function: CountFunction}, {Function: CountFunction}}},
+		{Tables: []string{"abi"}, Aggregations: []Aggregation{{Function: CountFunction}}, GroupBy: []string{"abi_id, body"}},
+		{Tables: []string{"abi"}, Aggregations: []Aggregation{{Function: CountFunction}}, Having: []HavingCondition{{Column: "count", Operator: ">", Value: 1}}},
+		{Tables: []string{"abi"}, Aggregations: []Aggregation{{Function: CountFunction}}, GroupBy: []string{"abi_id"},
+			Having: []HavingCondition{{Column: "body", Operator: ">", Value: 1}}},
+		{Tables: []string{"abi"}, Aggregations: []Aggregation{{Function: CountFunction}}, GroupBy: []string{"abi_id"},
+			Having: []HavingCondition{{Column: "count", Operator: "> 1 OR 1 =", Value: 1}}},
+		{Tables: []string{"abi"}, Aggregations: []Aggregation{{Function: CountFunction}}, GroupBy: []string{"abi_id"},
+			Having: []HavingCondition{{Column: "(SELECT 1)", Operator: "=", Value: 1}}},
+		{Tables: []string{"abi"}, Aggregations: []Aggregation{{Function: CountFunction}}, GroupBy: []string{"abi_id"},
+			Having: []HavingCondition{{Column: "count", Operator: "=", Value: []interface{}{1, 2}}}},
+	}
+	for _, request := range invalid {
+		_, err := request.BuildAggregateQuery()
+		suite.Require().Error(err)
+	}
+}
+
+func (suite *TestHandlerSuite) TestJoinQuery() {
+	request := DatabaseQueryRequest{
+		Fields: []string{"smartcontract.address", "a.body", "c.group_name"},
+		Tables: []string{"smartcontract"},
+		Joins: []Join{
+			{Table: "abi", Alias: "a", On: []JoinOn{{Left: "smartcontract.abi_id", Right: "a.abi_id"}}},
+			{Type: LeftJoin, Table: "configuration", Alias: "c", On: []JoinOn{
+				{Left: "smartcontract.network_id", Right: "c.network_id"},
+				{Left: "smartcontract.address", Right: "c.address"},
+			}},
+		},
+		Where:     "smartcontract.network_id = ?",
+		Arguments: []interface{}{"56"},
+	}
+	query, err := request.BuildSelectQuery()
+	suite.Require().NoError(err)
+	suite.Require().Equal("SELECT smartcontract.address, a.body, c.group_name FROM smartcontract "+
+		"INNER JOIN abi AS a ON smartcontract.abi_id = a.abi_id "+
+		"LEFT JOIN configuration AS c ON smartcontract.network_id = c.network_id AND smartcontract.address = c.address "+
+		"WHERE smartcontract.network_id = ?", query)
+
+	query, err = request.BuildCountQuery()
+	suite.Require().NoError(err)
+	suite.Require().Contains(query, "FROM smartcontract INNER JOIN abi AS a ON")
+
+	invalid := []Join{
+		{Type: "cross", Table: "abi", On: []JoinOn{{Left: "smartcontract.abi_id", Right: "abi.abi_id"}}},
+		{Table: "abi"},
+		{Table: "abi; DROP TABLE abi", On: []JoinOn{{Left: "smartcontract.abi_id", Right: "abi.abi_id"}}},
+		{Table: "abi", Alias: "a b", On: []JoinOn{{Left: "smartcontract.abi_id", Right: "abi.abi_id"}}},
+		{Table: "abi", On: []JoinOn{{Left: "smartcontract.abi_id OR 1", Right: "abi.abi_id"}}},
+	}
+	for _, join := range invalid {
+		request := DatabaseQueryRequest{Tables: []string{"smartcontract"}, Joins: []Join{join}}
+		_, err := request.BuildSelectQuery()
+		suite.Require().Error(err)
+	}
+
+	request.Tables = []string{"smartcontract", "abi"}
+	_, err = request.BuildSelectQuery()
+	suite.Require().Error(err)
+
+	update := DatabaseQueryRequest{Tables: []string{"smartcontract"}, Fields: []string{"abi_id"}, Where: "1", Arguments: []interface{}{"a"}, Joins: request.Joins}
+	_, err = update.BuildUpdateQuery()
+	suite.Require().Error(err)
+}
+
+func (suite *TestHandlerSuite) TestDeleteQuery() {
+	request := DatabaseQueryRequest{
+		Tables:    []string{"indexer_event"},
+		Where:     "network_id = ? AND block_number < ?",
+		Arguments: []interface{}{"56", uint64(100)},
+		OrderBy:   []string{"block_number", "log_index desc"},
+		Limit:     1000,
+	}
+	query, err := request.BuildDeleteQuery()
+	suite.Require().NoError(err)
+	suite.Require().Equal("DELETE FROM indexer_event WHERE network_id = ? AND block_number < ? ORDER BY block_number, log_index DESC LIMIT 1000", query)
+
+	// the json filters are compiled into the where clause
+	request = DatabaseQueryRequest{
+		Tables:      []string{"indexer_event"},
+		JsonFilters: []JsonFilter{{Column: "event_parameters", Path: "$.to", Operator: "=", Value: "0xdead"}},
+	}
+	suite.Require().NoError(request.CompileJson())
+	query, err = request.BuildDeleteQuery()
+	suite.Require().NoError(err)
+	suite.Require().Equal("DELETE FROM indexer_event WHERE JSON_UNQUOTE(JSON_EXTRACT(event_parameters, ?)) = ?", query)
+
+	request = DatabaseQueryRequest{Tables: []string{"abi"}, AllRows: true}
+	query, err = request.BuildDeleteQuery()
+	suite.Require().NoError(err)
+	suite.Require().Equal("DELETE FROM abi", query)
+
+	invalid := []DatabaseQueryRequest{
+		{Tables: []string{"abi"}},
+		{Tables: []string{"abi"}, Fields: []string{"abi_id = 'a'"}},
+		{Tables: []string{"abi"}, Where: "abi_id = ?"},
+		{Tables: []string{"abi", "smartcontract"}, AllRows: true},
+		{Tables: []string{"abi"}, AllRows: true, OrderBy: []string{"abi_id; DROP TABLE abi"}},
+		{Tables: []string{"abi"}, AllRows: true, OrderBy: []string{"abi_id sideways"}},
+	}
+	for _, request := range invalid {
+		_, err := request.BuildDeleteQuery()
+		suite.Require().Error(err)
+	}
+}
+
+func (suite *TestHandlerSuite) TestChunkedRequest() {
+	raw := `{"command":"update","tables":["indexer_event"],"fields":["event_name"],"where":"block_number < ?",
+"arguments":["Pruned", 18446744073709551615],"json_patches":[{"column":"event_parameters","remove":["$.data"]}],"batch_size":500,"pause":50}`
+	parameters, err := key_value.NewFromString(raw)
+	suite.Require().NoError(err)
+
+	var request ChunkedRequest
+	suite.Require().NoError(parameters.Interface(&request))
+	suite.Require().NoError(request.Validate())
+	suite.Require().Equal(ChunkedUpdate, request.Command)
+	suite.Require().Equal(uint64(500), request.BatchSize)
+	suite.Require().Equal(uint64(50), request.Pause)
+	suite.Require().Equal([]string{"indexer_event"}, request.Tables)
+	suite.Require().Equal(uint64(18446744073709551615), request.Arguments[1])
+
+	suite.Require().NoError(request.CompileJson())
+	set, where := request.UpdateArguments()
+	suite.Require().Equal([]interface{}{"Pruned", "$.data"}, set)
+	suite.Require().Equal([]interface{}{uint64(18446744073709551615)}, where)
+
+	invalid := []ChunkedRequest{
+		{Command: "insert", DatabaseQueryRequest: DatabaseQueryRequest{Tables: []string{"abi"}, AllRows: true}},
+		{Command: ChunkedDelete, DatabaseQueryRequest: DatabaseQueryRequest{Tables: []string{"abi"}}},
+		{Command: ChunkedDelete, DatabaseQueryRequest: DatabaseQueryRequest{Tables: []string{"abi", "smartcontract"}, AllRows: true}},
+		{Command: ChunkedDelete, DatabaseQueryRequest: DatabaseQueryRequest{Tables: []string{"abi"}, AllRows: true, Limit: 10}},
+		{Command: ChunkedDelete, DatabaseQueryRequest: DatabaseQueryRequest{Tables: []string{"abi"}, AllRows: true, TransactionId: "1"}},
+		{Command: ChunkedUpdate, DatabaseQueryRequest: DatabaseQueryRequest{Tables: []string{"abi"}, Where: "1", Arguments: []interface{}{1}}},
+	}
+	for _, request := range invalid {
+		suite.Require().Error(request.Validate())
+	}
+}
+
+func (suite *TestHandlerSuite) TestExpandLists() {
+	raw := `{"tables":["smartcontract"],"where":"network_id = ? AND address IN (?) AND abi_id IN ? AND deployer != ? AND transaction_id != 'a?'",
+"arguments":["56", ["0x1", "0x2", "0x3"], [1, 18446744073709551615], "0x0"]}`
+	parameters, err := key_value.NewFromString(raw)
+	suite.Require().NoError(err)
+
+	var request DatabaseQueryRequest
+	suite.Require().NoError(parameters.Interface(&request))
+	suite.Require().NoError(request.ExpandLists(false, 3))
+	suite.Require().Equal("network_id = ? AND address IN (?, ?, ?) AND abi_id IN (?, ?) AND deployer != ? AND transaction_id != 'a?'", request.Where)
+	suite.Require().Equal([]interface{}{"56", "0x1", "0x2", "0x3", int64(1), uint64(18446744073709551615), "0x0"}, request.Arguments)
+
+	// the arguments of the update fields are not expanded
+	update := DatabaseQueryRequest{
+		Fields:    []string{"abi_id"},
+		Where:     "address IN (?)",
+		Arguments: []interface{}{"abi_1", []interface{}{"0x1", "0x2"}},
+	}
+	suite.Require().NoError(update.ExpandLists(true, 10))
+	suite.Require().Equal("address IN (?, ?)", update.Where)
+	suite.Require().Equal([]interface{}{"abi_1", "0x1", "0x2"}, update.Arguments)
+
+	// without the lists, the request is not changed
+	plain := DatabaseQueryRequest{Where: "a = ? AND b = ?", Arguments: []interface{}{1}}
+	suite.Require().NoError(plain.ExpandLists(false, 10))
+	suite.Require().Equal("a = ? AND b = ?", plain.Where)
+
+	invalid := []DatabaseQueryRequest{
+		{Where: "address IN (?)", Arguments: []interface{}{[]interface{}{}}},
+		{Where: "address IN (?)", Arguments: []interface{}{[]interface{}{"1", "2", "3", "4"}}},
+		{Where: "address IN (?)", Arguments: []interface{}{[]interface{}{[]interface{}{"1"}}}},
+		{Where: "address IN (?) AND network_id = ?", Arguments: []interface{}{[]interface{}{"1"}}},
+	}
+	for _, request := range invalid {
+		suite.Require().Error(request.ExpandLists(false, 3))
+	}
+}
+
+func (suite *TestHandlerSuite) TestOperations() {
+	update := DatabaseQueryRequest{
+		Tables:    []string{"indexer_smartcontract"},
+		Fields:    []string{"status"},
+		Where:     "network_id = ? AND address = ?",
+		Arguments: []interface{}{"active", "56", "0xdead"},
+		Operations: []FieldOperation{
+			{Field: "block_number", Operation: GreatestOperation, Value: json.Number("100")},
+			{Field: "retries", Operation: IncrementOperation, Value: 1},
+			{Field: "error", Operation: SetNullOperation},
+			{Field: "updated_at", Operation: SetNowOperation},
+		},
+		JsonPatches: []JsonPatch{{Column: "meta", Remove: []string{"$.error"}}},
+	}
+	suite.Require().NoError(update.CompileOperations())
+	suite.Require().NoError(update.CompileJson())
+	query, err := update.BuildUpdateQuery()
+	suite.Require().NoError(err)
+	suite.Require().Equal("UPDATE indexer_smartcontract SET status = ?, "+
+		"block_number = GREATEST(COALESCE(block_number, ?), ?), retries = COALESCE(retries, 0) + ?, "+
+		"error = NULL, updated_at = CURRENT_TIMESTAMP(6), meta = JSON_REMOVE(COALESCE(meta, JSON_OBJECT()), ?) "+
+		"WHERE network_id = ? AND address = ?", query)
+	suite.Require().Equal([]interface{}{"active", int64(100), int64(100), 1, "$.error", "56", "0xdead"}, update.Arguments)
+	suite.Require().Nil(update.Operations)
+
+	// the chunked update splits the arguments after the assignments
+	assignments, where := update.UpdateArguments()
+	suite.Require().Len(assignments, 5)
+	suite.Require().Equal([]interface{}{"56", "0xdead"}, where)
+
+	invalid := []DatabaseQueryRequest{
+		{Operations: []FieldOperation{{Field: "block_number", Operation: "multiply", Value: 2}}},
+		{Operations: []FieldOperation{{Field: "block_number", Operation: IncrementOperation}}},
+		{Operations: []FieldOperation{{Field: "block_number = 0, status", Operation: SetNullOperation}}},
+		{Operations: []FieldOperation{{Field: "retries", Operation: IncrementOperation, Value: []interface{}{1}}}},
+		{Fields: []string{"retries"}, Arguments: []interface{}{1}, Operations: []FieldOperation{{Field: "retries", Operation: SetNullOperation}}},
+	}
+	for _, request := range invalid {
+		suite.Require().Error(request.CompileOperations())
+	}
+}
+
+func (suite *TestHandlerSuite) TestExpectation() {
+	update := DatabaseQueryRequest{
+		Tables:     []string{"configuration"},
+		Fields:     []string{"value"},
+		Where:      "name = ?",
+		Arguments:  []interface{}{"new", "indexer"},
+		Operations: []FieldOperation{{Field: "updated_at", Operation: SetNowOperation}},
+		Expect:     &Expectation{Column: "version", Value: json.Number("3"), Increment: true},
+	}
+	current, err := update.CompileExpectation()
+	suite.Require().NoError(err)
+	suite.Require().NoError(update.CompileOperations())
+	query, err := update.BuildUpdateQuery()
+	suite.Require().NoError(err)
+	suite.Require().Equal("UPDATE configuration SET value = ?, version = COALESCE(version, 0) + 1, updated_at = CURRENT_TIMESTAMP(6) "+
+		"WHERE (name = ?) AND version <=> ?", query)
+	suite.Require().Equal([]interface{}{"new", "indexer", int64(3)}, update.Arguments)
+	suite.Require().Nil(update.Expect)
+
+	// the current row that has another version
+	suite.Require().NotNil(current)
+	query, err = current.BuildSelectRowQuery()
+	suite.Require().NoError(err)
+	suite.Require().Equal("SELECT version, value FROM configuration WHERE (name = ?) AND NOT (version <=> ?) LIMIT 1", query)
+	suite.Require().Equal([]interface{}{"indexer", int64(3)}, current.Arguments)
+
+	// no expectation
+	current, err = update.CompileExpectation()
+	suite.Require().NoError(err)
+	suite.Require().Nil(current)
+
+	invalid := []DatabaseQueryRequest{
+		{Fields: []string{"value"}, Arguments: []interface{}{"new"}, Expect: &Expectation{Column: "version", Value: 1}},
+		{Where: "name = ?", Arguments: []interface{}{"indexer"}, Expect: &Expectation{Column: "version = version", Value: 1}},
+		{Fields: []string{"version"}, Where: "name = ?", Arguments: []interface{}{4, "indexer"}, Expect: &Expectation{Column: "version", Value: 3, Increment: true}},
+		{Where: "name = ?", Arguments: []interface{}{"indexer"}, Expect: &Expectation{Column: "version", Value: []interface{}{3}}},
+	}
+	for _, request := range invalid {
+		_, err := request.CompileExpectation()
+		suite.Require().Error(err)
+	}
+}
+
+func (suite *TestHandlerSuite) TestRowLock() {
+	request := DatabaseQueryRequest{
+		Tables:        []string{"task"},
+		Where:         "status = ?",
+		Arguments:     []interface{}{"pending"},
+		OrderBy:       []string{"task_id"},
+		Limit:         10,
+		Lock:          &RowLock{Mode: LockForUpdate, SkipLocked: true},
+		TransactionId: "tx_1",
+	}
+	query, err := request.BuildSelectQuery()
+	suite.Require().NoError(err)
+	suite.Require().Equal("SELECT  * FROM task WHERE status = ? ORDER BY task_id LIMIT 10 FOR UPDATE SKIP LOCKED", query)
+
+	request.Lock = &RowLock{Mode: LockForShare, NoWait: true}
+	query, err = request.BuildSelectRowQuery()
+	suite.Require().NoError(err)
+	suite.Require().Equal("SELECT  * FROM task WHERE status = ? ORDER BY task_id LIMIT 1 FOR SHARE NOWAIT", query)
+
+	query, err = request.BuildExistQuery()
+	suite.Require().NoError(err)
+	suite.Require().Equal("SELECT 1 FROM task WHERE status = ? FOR SHARE NOWAIT", query)
+
+	_, err = request.BuildCountQuery()
+	suite.Require().Error(err)
+
+	// outside the transaction
+	request.TransactionId = ""
+	_, err = request.BuildSelectQuery()
+	suite.Require().Error(err)
+
+	request.TransactionId = "tx_1"
+	request.Lock = &RowLock{Mode: "exclusive"}
+	_, err = request.BuildSelectQuery()
+	suite.Require().Error(err)
+	request.Lock = &RowLock{Mode: LockForUpdate, NoWait: true, SkipLocked: true}
+	_, err = request.BuildSelectQuery()
+	suite.Require().Error(err)
+}
+
+func (suite *TestHandlerSuite) TestLockRequest() {
+	suite.Require().NoError(LockRequest{Name: "indexer:56"}.Validate())
+	suite.Require().Error(LockRequest{}.Validate())
+	suite.Require().Error(LockRequest{Name: strings.Repeat("a", LockNameLimit+1)}.Validate())
+}
+
+func (suite *TestHandlerSuite) TestQueueRequest() {
+	push := QueuePushRequest{Queue: "categorizer", Payload: json.RawMessage(`{"address":"0xdead"}`)}
+	suite.Require().NoError(push.Validate())
+	push.Payload = json.RawMessage(`{"address":`)
+	suite.Require().Error(push.Validate())
+	push.Payload = nil
+	suite.Require().Error(push.Validate())
+
+	// the payload is kept as it is
+	var decoded QueuePushRequest
+	suite.Require().NoError(json.Unmarshal([]byte(`{"queue":"categorizer","payload":{"block_number":12345678901234567890}}`), &decoded))
+	suite.Require().Equal(`{"block_number":12345678901234567890}`, string(decoded.Payload))
+
+	// the claimed payload keeps the precision in the reply
+	reply, err := command.Reply(&QueueClaimReply{Jobs: []QueueJob{{JobId: 1, Payload: string(decoded.Payload), Attempts: 1, ClaimToken: "token"}}})
+	suite.Require().NoError(err)
+	var claimed QueueClaimReply
+	suite.Require().NoError(reply.Parameters.Interface(&claimed))
+	suite.Require().Equal(`{"block_number":12345678901234567890}`, claimed.Jobs[0].Payload)
+	var payload struct {
+		BlockNumber uint64 `json:"block_number"`
+	}
+	suite.Require().NoError(claimed.Jobs[0].Decode(&payload))
+	suite.Require().Equal(uint64(12345678901234567890), payload.BlockNumber)
+
+	suite.Require().Error(QueueClaimRequest{}.Validate())
+	suite.Require().Error(QueueClaimRequest{Queue: strings.Repeat("q", QueueNameLimit+1)}.Validate())
+	suite.Require().NoError(QueueAckRequest{JobId: 1, ClaimToken: "token"}.Validate())
+	suite.Require().Error(QueueAckRequest{JobId: 1}.Validate())
+	suite.Require().Error(QueueAckRequest{ClaimToken: "token"}.Validate())
+}
+
+func (suite *TestHandlerSuite) TestOutbox() {
+	var request DatabaseQueryRequest
+	data := `{"tables":["abi"],"fields":["abi_id","body"],"arguments":["abi_1","{}"],` +
+		`"outbox":[{"topic":"abi.created","payload":{"abi_id":"abi_1","block_number":12345678901234567890}}]}`
+	suite.Require().NoError(json.Unmarshal([]byte(data), &request))
+	suite.Require().NoError(request.ValidateOutbox())
+	suite.Require().Equal(`{"abi_id":"abi_1","block_number":12345678901234567890}`, string(request.Outbox[0].Payload))
+
+	invalid := [][]OutboxMessage{
+		{{Payload: json.RawMessage(`{}`)}},
+		{{Topic: strings.Repeat("t", TopicLimit+1), Payload: json.RawMessage(`{}`)}},
+		{{Topic: "abi.created"}},
+		{{Topic: "abi.created", Payload: json.RawMessage(`{"abi_id":`)}},
+	}
+	for _, outbox := range invalid {
+		suite.Require().Error(DatabaseQueryRequest{Outbox: outbox}.ValidateOutbox())
+	}
+
+	chunked := ChunkedRequest{DatabaseQueryRequest: request, Command: ChunkedDelete}
+	chunked.Where = "abi_id = ?"
+	suite.Require().Error(chunked.Validate())
+}
+
+func (suite *TestHandlerSuite) TestChangedKeys() {
+	update := DatabaseQueryRequest{
+		Fields:     []string{"title"},
+		Tables:     []string{"abi"},
+		Where:      "abi_id = ?",
+		Arguments:  []interface{}{"name", "id"},
+		Operations: []FieldOperation{{Field: "version", Operation: IncrementOperation, Value: 1}},
+	}
+	suite.Require().NoError(update.CompileOperations())
+	suite.Require().Equal([]string{"title", "version"}, update.ChangedFields())
+
+	// the keys are selected by the where arguments only
+	query, arguments, err := update.BuildChangedKeysQuery(true, []string{"abi_id"}, 11)
+	suite.Require().NoError(err)
+	suite.Require().Equal("SELECT abi_id FROM abi WHERE abi_id = ? LIMIT 11 FOR UPDATE", query)
+	suite.Require().Equal([]interface{}{"id"}, arguments)
+
+	// the delete keeps its order and the smaller limit
+	remove := DatabaseQueryRequest{
+		Tables:    []string{"abi"},
+		Where:     "created_at < ?",
+		Arguments: []interface{}{1},
+		OrderBy:   []string{"created_at"},
+		Limit:     5,
+	}
+	query, arguments, err = remove.BuildChangedKeysQuery(false, []string{"abi_id", "version"}, 11)
+	suite.Require().NoError(err)
+	suite.Require().Equal("SELECT abi_id, version FROM abi WHERE created_at < ? ORDER BY created_at, abi_id, version LIMIT 5 FOR UPDATE", query)
+	suite.Require().Equal([]interface{}{1}, arguments)
+
+	// the delete is ordered the same way, so it deletes the selected rows
+	remove.OrderBy = []string{"version DESC"}
+	remove.OrderByKeys([]string{"abi_id", "version"})
+	suite.Require().Equal([]string{"version DESC", "abi_id"}, remove.OrderBy)
+	remove.OrderBy = []string{"created_at"}
+
+	remove.Tables = []string{"abi", "abi_log"}
+	_, _, err = remove.BuildChangedKeysQuery(false, []string{"abi_id"}, 11)
+	suite.Require().Error(err)
+}
+
+func (suite *TestHandlerSuite) TestConditionColumns() {
+	columns, err := ConditionColumns("abi.abi_id = ? AND JSON_EXTRACT(`body`, '$.secret') IS NOT NULL AND title LIKE 'a ''b'' c'")
+	suite.Require().NoError(err)
+	suite.Require().Equal([]string{"abi.abi_id", "body", "title"}, columns)
+
+	columns, err = ConditionColumns("created_at > NOW() - INTERVAL 1 DAY AND amount >= 1.5")
+	suite.Require().NoError(err)
+	suite.Require().Equal([]string{"created_at", "amount"}, columns)
+
+	// the compiled json filters
+	columns, err = ConditionColumns("JSON_UNQUOTE(JSON_EXTRACT(event_parameters, ?)) = ? AND JSON_EXTRACT(event_parameters, ?) >= CAST(? AS JSON)")
+	suite.Require().NoError(err)
+	suite.Require().Equal([]string{"event_parameters", "event_parameters"}, columns)
+
+	// the subqueries, the variables and the comments hide the columns
+	invalid := []string{
+		"abi_id IN (SELECT secret FROM other)",
+		"abi_id = (select 1)",
+		"abi_id IN (TABLE secret_table)",
+		"EXISTS (TABLE secret_table)",
+		"(abi_id, title) IN (VALUES ROW(1, 2))",
+		"abi_id = LOAD_FILE('/etc/passwd')",
+		"SLEEP(10) = 0",
+		"BENCHMARK(1000000, SHA1('a')) = 0",
+		"abi_id = mysql.sleep(1)",
+		"abi_id = @@version",
+		"abi_id = 1 /*! OR secret = 1 */",
+		"abi_id = 1 -- secret",
+		"title = 'unclosed",
+	}
+	for _, where := range invalid {
+		_, err := ConditionColumns(where)
+		suite.Require().Error(err, where)
+	}
+
+	suite.Require().True(IsColumn("abi.body"))
+	suite.Require().False(IsColumn("(SELECT secret FROM other)"))
+	suite.Require().False(IsColumn("JSON_EXTRACT(secret, '$.a')"))
+}
+
+func (suite *TestHandlerSuite) TestErrorCode() {
+	message := NotFound.Message("not found")
+	suite.Require().Equal("[not_found] not found", message)
+	suite.Require().Equal(NotFound, ErrorCodeOf("the command 'select-row' replied with a failure: "+message))
+	suite.Require().Equal(ErrorCode(""), ErrorCodeOf("not found"))
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestHandler(t *testing.T) {
+	suite.Run(t, new(TestHandlerSuite))
+}
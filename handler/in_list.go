@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// placeholders returns the positions of the '?' placeholders in the sql.
+// The question marks in the quoted strings and the identifiers are skipped.
+func placeholders(sql string) []int {
+	positions := make([]int, 0)
+	var quote byte
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case quote != 0 && c == '\\' && quote != '`':
+			i++ // the escaped character
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '?':
+			positions = append(positions, i)
+		}
+	}
+	return positions
+}
+
+// ExpandLists expands the list arguments of the Where clause into the placeholders of each element.
+//
+// For example, the Where "address IN (?)" with the list of three addresses
+// becomes "address IN (?, ?, ?)" with the addresses as the arguments.
+// If the placeholder is not in the parentheses, then they are added.
+//
+// The update is true for UPDATE, which arguments of the Fields precede the arguments of the Where.
+// The limit is the maximum amount of the elements in the list.
+func (request *DatabaseQueryRequest) ExpandLists(update bool, limit int) error {
+	offset := 0
+	if update {
+		offset = len(request.Fields)
+	}
+	if offset > len(request.Arguments) {
+		return nil
+	}
+
+	hasList := false
+	for _, argument := range request.Arguments[offset:] {
+		if _, ok := argument.([]interface{}); ok {
+			hasList = true
+			break
+		}
+	}
+	if !hasList {
+		return nil
+	}
+
+	positions := placeholders(request.Where)
+	whereArguments := request.Arguments[offset:]
+	if len(positions) != len(whereArguments) {
+		return fmt.Errorf("the Where has %d placeholders, but %d arguments", len(positions), len(whereArguments))
+	}
+
+	var where strings.Builder
+	arguments := make([]interface{}, 0, len(request.Arguments))
+	arguments = append(arguments, request.Arguments[:offset]...)
+	previous := 0
+	for i, position := range positions {
+		where.WriteString(request.Where[previous:position])
+		previous = position + 1
+
+		list, ok := whereArguments[i].([]interface{})
+		if !ok {
+			where.WriteString("?")
+			arguments = append(arguments, whereArguments[i])
+			continue
+		}
+		if len(list) == 0 {
+			return fmt.Errorf("the list of the argument %d is empty", i)
+		}
+		if len(list) > limit {
+			return fmt.Errorf("the list of the argument %d has %d elements, the limit is %d", i, len(list), limit)
+		}
+		for _, element := range list {
+			switch value := element.(type) {
+			case json.Number:
+				element = numberArgument(value)
+			case []interface{}, map[string]interface{}:
+				return fmt.Errorf("the list of the argument %d has the nested list or object", i)
+			}
+			arguments = append(arguments, element)
+		}
+
+		expanded := strings.TrimSuffix(strings.Repeat("?, ", len(list)), ", ")
+		if !inParentheses(request.Where, position) {
+			expanded = "(" + expanded + ")"
+		}
+		where.WriteString(expanded)
+	}
+	where.WriteString(request.Where[previous:])
+
+	request.Where = where.String()
+	request.Arguments = arguments
+	return nil
+}
+
+// inParentheses returns true if the placeholder at the position is the only one in the parentheses
+func inParentheses(sql string, position int) bool {
+	before := strings.TrimRight(sql[:position], " \t\n")
+	after := strings.TrimLeft(sql[position+1:], " \t\n")
+	return strings.HasSuffix(before, "(") && strings.HasPrefix(after, ")")
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The types of Join
+const (
+	InnerJoin = "inner"
+	LeftJoin  = "left"
+)
+
+// JoinOn is the pair of the columns that are equal in the joined rows
+type JoinOn struct {
+	Left  string `json:"left"`  // column of the tables joined before, for example "smartcontract.abi_id"
+	Right string `json:"right"` // column of the joined table, for example "abi.abi_id"
+}
+
+// Join is the table joined to the Tables of the query.
+//
+// Example, the smartcontracts with their abi:
+//
+//	DatabaseQueryRequest{
+//		Fields: []string{"smartcontract.address", "abi.body"},
+//		Tables: []string{"smartcontract"},
+//		Joins:  []Join{{Table: "abi", On: []JoinOn{{Left: "smartcontract.abi_id", Right: "abi.abi_id"}}}},
+//	}
+type Join struct {
+	Type  string   `json:"type,omitempty"` // "inner" or "left", by default "inner"
+	Table string   `json:"table"`
+	Alias string   `json:"alias,omitempty"`
+	On    []JoinOn `json:"on"`
+}
+
+// Name returns the name that qualifies the columns of the joined table
+func (join Join) Name() string {
+	if len(join.Alias) > 0 {
+		return join.Alias
+	}
+	return join.Table
+}
+
+// clause returns the JOIN clause
+func (join Join) clause() (string, error) {
+	var str string
+	switch strings.ToLower(join.Type) {
+	case "", InnerJoin:
+		str = "INNER JOIN "
+	case LeftJoin:
+		str = "LEFT JOIN "
+	default:
+		return "", fmt.Errorf("unsupported join type '%s'", join.Type)
+	}
+
+	if !aliasPattern.MatchString(join.Table) {
+		return "", fmt.Errorf("invalid join table '%s'", join.Table)
+	}
+	str += join.Table
+	if len(join.Alias) > 0 {
+		if !aliasPattern.MatchString(join.Alias) {
+			return "", fmt.Errorf("invalid alias '%s' of '%s' join", join.Alias, join.Table)
+		}
+		str += " AS " + join.Alias
+	}
+
+	if len(join.On) == 0 {
+		return "", fmt.Errorf("missing On columns of '%s' join", join.Table)
+	}
+	conditions := make([]string, len(join.On))
+	for i, on := range join.On {
+		if err := validateColumn(on.Left); err != nil {
+			return "", fmt.Errorf("join '%s': %w", join.Table, err)
+		}
+		if err := validateColumn(on.Right); err != nil {
+			return "", fmt.Errorf("join '%s': %w", join.Table, err)
+		}
+		conditions[i] = on.Left + " = " + on.Right
+	}
+
+	return str + " ON " + strings.Join(conditions, " AND "), nil
+}
+
+// from returns the tables of the FROM clause with the joins
+func (request DatabaseQueryRequest) from() (string, error) {
+	if len(request.Joins) == 0 {
+		return strings.Join(request.Tables, ", "), nil
+	}
+	// the comma has the lower precedence than JOIN, the ON columns of the first tables would be unknown
+	if len(request.Tables) != 1 {
+		return "", fmt.Errorf("the joins require exactly one table in Tables")
+	}
+
+	clauses := make([]string, 0, len(request.Joins)+1)
+	clauses = append(clauses, request.Tables[0])
+	for _, join := range request.Joins {
+		clause, err := join.clause()
+		if err != nil {
+			return "", err
+		}
+		clauses = append(clauses, clause)
+	}
+	return strings.Join(clauses, " "), nil
+}
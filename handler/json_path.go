@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// JsonFilter is the predicate on the value at the path of the JSON column.
+//
+// Example, find the events transferred to the address:
+//
+//	JsonFilter{Column: "event_parameters", Path: "$.to", Operator: "=", Value: "0x..."}
+type JsonFilter struct {
+	Column   string      `json:"column"`
+	Path     string      `json:"path"`     // for example "$.to" or "$.items[0].id"
+	Operator string      `json:"operator"` // "=", "!=", "<", "<=", ">", ">=" or "contains"
+	Value    interface{} `json:"value"`
+}
+
+// JsonPathValue is the value set at the path
+type JsonPathValue struct {
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// JsonPatch changes the keys of the JSON column in UPDATE, keeping the rest of the document.
+// The values are set before the paths are removed.
+type JsonPatch struct {
+	Column string          `json:"column"`
+	Set    []JsonPathValue `json:"set,omitempty"`
+	Remove []string        `json:"remove,omitempty"`
+}
+
+var (
+	// columnPattern is the column with the optional table
+	columnPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+	// jsonPathPattern is the subset of mysql path syntax: the keys, the array indexes and the wildcards
+	jsonPathPattern = regexp.MustCompile(`^\$(\.[A-Za-z_][A-Za-z0-9_]*|\[[0-9]+]|\.\*|\[\*])*$`)
+)
+
+// jsonComparisons are the operators of JsonFilter compiled into the comparison
+var jsonComparisons = map[string]bool{"=": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+// ValidateJsonPath returns an error if the path is not the mysql path supported by the extension.
+// The wildcards are allowed only for filtering.
+func ValidateJsonPath(path string, wildcards bool) error {
+	if !jsonPathPattern.MatchString(path) {
+		return fmt.Errorf("invalid json path '%s'", path)
+	}
+	if !wildcards && strings.Contains(path, "*") {
+		return fmt.Errorf("json path '%s' has wildcards", path)
+	}
+	return nil
+}
+
+// validateColumn returns an error if the column is not the plain identifier with the optional table
+func validateColumn(column string) error {
+	if !columnPattern.MatchString(column) {
+		return fmt.Errorf("invalid column '%s'", column)
+	}
+	return nil
+}
+
+// CompileJson compiles JsonFilters into Where and JsonPatches into the UPDATE assignments.
+// The patches follow the assignments compiled before.
+// The paths and the values are passed as the arguments.
+//
+// The JsonFilters and JsonPatches are cleared, so calling it twice has no effect.
+func (request *DatabaseQueryRequest) CompileJson() error {
+	if len(request.JsonFilters) == 0 && len(request.JsonPatches) == 0 {
+		return nil
+	}
+
+	predicates := make([]string, 0, len(request.JsonFilters))
+	filterArguments := make([]interface{}, 0, len(request.JsonFilters)*2)
+	for _, filter := range request.JsonFilters {
+		if err := validateColumn(filter.Column); err != nil {
+			return err
+		}
+		if err := ValidateJsonPath(filter.Path, true); err != nil {
+			return err
+		}
+
+		value, err := json.Marshal(filter.Value)
+		if err != nil {
+			return fmt.Errorf("json.Marshal of '%s' value: %w", filter.Path, err)
+		}
+
+		switch {
+		case filter.Operator == "contains":
+			predicates = append(predicates, "JSON_CONTAINS("+filter.Column+", ?, ?)")
+			filterArguments = append(filterArguments, string(value), filter.Path)
+		case !jsonComparisons[filter.Operator]:
+			return fmt.Errorf("unsupported json operator '%s'", filter.Operator)
+		case isString(filter.Value):
+			// compare the strings without the JSON quotes
+			predicates = append(predicates, "JSON_UNQUOTE(JSON_EXTRACT("+filter.Column+", ?)) "+filter.Operator+" ?")
+			filterArguments = append(filterArguments, filter.Path, filter.Value)
+		default:
+			predicates = append(predicates, "JSON_EXTRACT("+filter.Column+", ?) "+filter.Operator+" CAST(? AS JSON)")
+			filterArguments = append(filterArguments, filter.Path, string(value))
+		}
+	}
+
+	assignments := make([]string, 0, len(request.JsonPatches))
+	patchArguments := make([]interface{}, 0)
+	for _, patch := range request.JsonPatches {
+		if err := validateColumn(patch.Column); err != nil {
+			return err
+		}
+		if len(patch.Set) == 0 && len(patch.Remove) == 0 {
+			return fmt.Errorf("json patch of '%s' has nothing to set or remove", patch.Column)
+		}
+
+		expression := "COALESCE(" + patch.Column + ", JSON_OBJECT())"
+		if len(patch.Set) > 0 {
+			expression = "JSON_SET(" + expression
+			for _, set := range patch.Set {
+				if err := ValidateJsonPath(set.Path, false); err != nil {
+					return err
+				}
+				value, err := json.Marshal(set.Value)
+				if err != nil {
+					return fmt.Errorf("json.Marshal of '%s' value: %w", set.Path, err)
+				}
+				expression += ", ?, CAST(? AS JSON)"
+				patchArguments = append(patchArguments, set.Path, string(value))
+			}
+			expression += ")"
+		}
+		if len(patch.Remove) > 0 {
+			expression = "JSON_REMOVE(" + expression
+			for _, path := range patch.Remove {
+				if err := ValidateJsonPath(path, false); err != nil {
+					return err
+				}
+				expression += ", ?"
+				patchArguments = append(patchArguments, path)
+			}
+			expression += ")"
+		}
+		assignments = append(assignments, patch.Column+" = "+expression)
+	}
+
+	if err := request.addAssignments(assignments, patchArguments); err != nil {
+		return err
+	}
+	request.Arguments = append(request.Arguments, filterArguments...)
+
+	if len(predicates) > 0 {
+		if len(request.Where) > 0 {
+			predicates = append([]string{"(" + request.Where + ")"}, predicates...)
+		}
+		request.Where = strings.Join(predicates, " AND ")
+	}
+
+	request.JsonFilters = nil
+	request.JsonPatches = nil
+	return nil
+}
+
+func isString(value interface{}) bool {
+	_, ok := value.(string)
+	return ok
+}
@@ -0,0 +1,60 @@
+package handler
+
+import "fmt"
+
+// The modes of RowLock
+const (
+	LockForUpdate = "update"
+	LockForShare  = "share"
+)
+
+// RowLock locks the selected rows until the end of the transaction.
+// It's supported by SELECT, SELECT_ROW and EXIST commands executed in the transaction.
+//
+// Example, the worker claims the pending task, that other workers didn't claim:
+//
+//	DatabaseQueryRequest{
+//		Tables:        []string{"task"},
+//		Where:         "status = ?",
+//		Arguments:     []interface{}{"pending"},
+//		OrderBy:       []string{"task_id"},
+//		Lock:          &RowLock{Mode: LockForUpdate, SkipLocked: true},
+//		TransactionId: id,
+//	}
+type RowLock struct {
+	Mode       string `json:"mode"`                  // "update" or "share"
+	NoWait     bool   `json:"no_wait,omitempty"`     // fail instead of waiting for the rows locked by another transaction
+	SkipLocked bool   `json:"skip_locked,omitempty"` // skip the rows locked by another transaction
+}
+
+// lockClause returns the locking clause of the select query.
+// It's empty if the request has no Lock.
+func (request DatabaseQueryRequest) lockClause() (string, error) {
+	if request.Lock == nil {
+		return "", nil
+	}
+	// outside the transaction, the lock is released as soon as the query returns
+	if len(request.TransactionId) == 0 {
+		return "", fmt.Errorf("the row lock requires the transaction")
+	}
+
+	var str string
+	switch request.Lock.Mode {
+	case LockForUpdate:
+		str = " FOR UPDATE"
+	case LockForShare:
+		str = " FOR SHARE"
+	default:
+		return "", fmt.Errorf("unsupported lock mode '%s'", request.Lock.Mode)
+	}
+
+	switch {
+	case request.Lock.NoWait && request.Lock.SkipLocked:
+		return "", fmt.Errorf("the lock is either NoWait or SkipLocked")
+	case request.Lock.NoWait:
+		str += " NOWAIT"
+	case request.Lock.SkipLocked:
+		str += " SKIP LOCKED"
+	}
+	return str, nil
+}
@@ -0,0 +1,51 @@
+package handler
+
+import "fmt"
+
+// LockNameLimit is the maximum length of the lock name in mysql
+const LockNameLimit = 64
+
+// LockRequest keeps the parameters of LOCK_ACQUIRE, LOCK_RELEASE and LOCK_STATUS commands.
+//
+// The named lock is shared by all services connected to the database server.
+// It's held until it's released by the holder or its lease expires.
+//
+// Example, only one indexer per network:
+//
+//	LockRequest{Name: "indexer:56", Timeout: 5, Lease: 60}
+type LockRequest struct {
+	Name    string `json:"name"`
+	Timeout uint64 `json:"timeout,omitempty"` // seconds to wait for the lock held by another service, zero means no waiting
+	Lease   uint64 `json:"lease,omitempty"`   // seconds the lock is held, if zero, then the default lease
+}
+
+// Validate the lock request
+func (request LockRequest) Validate() error {
+	if len(request.Name) == 0 {
+		return fmt.Errorf("missing lock name")
+	}
+	if len(request.Name) > LockNameLimit {
+		return fmt.Errorf("the lock name is longer than %d characters", LockNameLimit)
+	}
+	return nil
+}
+
+// LockAcquireReply keeps the parameters of LOCK_ACQUIRE command reply by controller.
+// If the lock is already held by the service, then its lease is extended.
+type LockAcquireReply struct {
+	Acquired  bool  `json:"acquired"`             // false if the lock is held by another service after the timeout
+	ExpiresAt int64 `json:"expires_at,omitempty"` // unix timestamp in seconds, when the lease expires
+}
+
+// LockReleaseReply keeps the parameters of LOCK_RELEASE command reply by controller
+type LockReleaseReply struct {
+	Released bool `json:"released"` // false if the lock wasn't held by the service
+}
+
+// LockStatusReply keeps the parameters of LOCK_STATUS command reply by controller
+type LockStatusReply struct {
+	Name      string `json:"name"`
+	Locked    bool   `json:"locked"`               // the lock is held by any connection to the database server
+	Holder    string `json:"holder,omitempty"`     // the service that holds the lock through this extension
+	ExpiresAt int64  `json:"expires_at,omitempty"` // unix timestamp in seconds, when the lease of the holder expires
+}
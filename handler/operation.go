@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// The operations of FieldOperation
+const (
+	IncrementOperation = "increment"
+	DecrementOperation = "decrement"
+	GreatestOperation  = "greatest"
+	LeastOperation     = "least"
+	SetNullOperation   = "set-null"
+	SetNowOperation    = "set-now"
+)
+
+// FieldOperation is the atomic change of the field in UPDATE,
+// calculated by the database from the current value.
+//
+// Example, advance the checkpoint of the smartcontract monotonically:
+//
+//	DatabaseQueryRequest{
+//		Tables:     []string{"indexer_smartcontract"},
+//		Operations: []FieldOperation{{Field: "block_number", Operation: GreatestOperation, Value: 100}},
+//		Where:      "network_id = ? AND address = ?",
+//		Arguments:  []interface{}{"1", "0x..."},
+//	}
+type FieldOperation struct {
+	Field     string      `json:"field"`
+	Operation string      `json:"operation"`       // increment, decrement, greatest, least, set-null or set-now
+	Value     interface{} `json:"value,omitempty"` // not used by set-null and set-now
+}
+
+// assignment returns the sql of the operation and its arguments
+func (operation FieldOperation) assignment() (string, []interface{}, error) {
+	field := operation.Field
+	if err := validateColumn(field); err != nil {
+		return "", nil, err
+	}
+
+	value := operation.Value
+	if number, ok := value.(json.Number); ok {
+		value = numberArgument(number)
+	}
+
+	switch operation.Operation {
+	case SetNullOperation:
+		return field + " = NULL", nil, nil
+	case SetNowOperation:
+		return field + " = CURRENT_TIMESTAMP(6)", nil, nil
+	case IncrementOperation, DecrementOperation, GreatestOperation, LeastOperation:
+	default:
+		return "", nil, fmt.Errorf("unsupported operation '%s' of '%s'", operation.Operation, field)
+	}
+
+	if value == nil {
+		return "", nil, fmt.Errorf("missing value of '%s' operation of '%s'", operation.Operation, field)
+	}
+	switch value.(type) {
+	case []interface{}, map[string]interface{}:
+		return "", nil, fmt.Errorf("the value of '%s' operation of '%s' is not scalar", operation.Operation, field)
+	}
+
+	switch operation.Operation {
+	case IncrementOperation:
+		return field + " = COALESCE(" + field + ", 0) + ?", []interface{}{value}, nil
+	case DecrementOperation:
+		return field + " = COALESCE(" + field + ", 0) - ?", []interface{}{value}, nil
+	case GreatestOperation:
+		// the null field is replaced by the value, since GREATEST of null is null
+		return field + " = GREATEST(COALESCE(" + field + ", ?), ?)", []interface{}{value, value}, nil
+	default:
+		return field + " = LEAST(COALESCE(" + field + ", ?), ?)", []interface{}{value, value}, nil
+	}
+}
+
+// CompileOperations compiles the Operations into the UPDATE assignments.
+// The values are passed as the arguments after the arguments of the Fields.
+//
+// The Operations are cleared, so calling it twice has no effect.
+func (request *DatabaseQueryRequest) CompileOperations() error {
+	if len(request.Operations) == 0 {
+		return nil
+	}
+
+	assignments := make([]string, 0, len(request.Operations))
+	operationArguments := make([]interface{}, 0, len(request.Operations))
+	for _, operation := range request.Operations {
+		for _, field := range request.Fields {
+			if field == operation.Field {
+				return fmt.Errorf("the '%s' field is both in Fields and Operations", field)
+			}
+		}
+		assignment, arguments, err := operation.assignment()
+		if err != nil {
+			return err
+		}
+		assignments = append(assignments, assignment)
+		operationArguments = append(operationArguments, arguments...)
+	}
+
+	if err := request.addAssignments(assignments, operationArguments); err != nil {
+		return err
+	}
+
+	request.Operations = nil
+	return nil
+}
+
+// addAssignments adds the compiled UPDATE assignments.
+// The UPDATE arguments are the fields, then the assignments in the order they were added,
+// then the where clause.
+func (request *DatabaseQueryRequest) addAssignments(assignments []string, arguments []interface{}) error {
+	if len(arguments) > 0 {
+		split := len(request.Fields) + request.assignmentArguments
+		if split > len(request.Arguments) {
+			return fmt.Errorf("missing Arguments for Fields")
+		}
+		all := make([]interface{}, 0, len(request.Arguments)+len(arguments))
+		all = append(all, request.Arguments[:split]...)
+		all = append(all, arguments...)
+		request.Arguments = append(all, request.Arguments[split:]...)
+	}
+
+	request.assignments = append(request.assignments, assignments...)
+	request.assignmentArguments += len(arguments)
+	return nil
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// TopicLimit is the maximum length of the outbox topic
+const TopicLimit = 255
+
+// OutboxMessage is written to the outbox table along with the write statement, in the same transaction.
+// The outbox relay publishes it after the transaction is committed.
+//
+// The relay publishes the message as three frames: the topic, the outbox id and the payload.
+// The subscribers filter the messages by the topic prefix.
+// The message could be published more than once, the subscribers deduplicate them by the outbox id.
+//
+// The at-least-once delivery ends at the PUB socket, that drops the message
+// if there is no subscriber or the subscriber's queue is full (the high water mark is reached).
+// The subscriber that missed the messages requests them by OUTBOX_REPLAY.
+// The messages are published in the order of the ids. The ids are assigned when the message is written,
+// so the relay waits for the message of the open transaction, before publishing the messages with the greater ids.
+type OutboxMessage struct {
+	Topic   string          `json:"topic"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// ValidateOutbox validates the outbox messages of the write request
+func (request DatabaseQueryRequest) ValidateOutbox() error {
+	for _, outboxMessage := range request.Outbox {
+		if len(outboxMessage.Topic) == 0 {
+			return fmt.Errorf("missing outbox topic")
+		}
+		if len(outboxMessage.Topic) > TopicLimit {
+			return fmt.Errorf("the outbox topic is longer than %d characters", TopicLimit)
+		}
+		if len(outboxMessage.Payload) == 0 || !json.Valid(outboxMessage.Payload) {
+			return fmt.Errorf("the payload of '%s' outbox message is not a valid json", outboxMessage.Topic)
+		}
+	}
+	return nil
+}
+
+// OutboxReplayRequest keeps the parameters of OUTBOX_REPLAY command.
+// The relay publishes all outbox messages starting from the From id, including the delivered ones.
+type OutboxReplayRequest struct {
+	From uint64 `json:"from"`
+}
+
+// OutboxReplayReply keeps the parameters of OUTBOX_REPLAY command reply by controller
+type OutboxReplayReply struct{}
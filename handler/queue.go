@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// QueueNameLimit is the maximum length of the queue name
+const QueueNameLimit = 127
+
+// The status of the queued job
+const (
+	QueueReady   = "ready"   // waits to be claimed
+	QueueClaimed = "claimed" // processed by the worker until the visibility timeout
+	QueueDead    = "dead"    // dead-lettered after the last attempt, never claimed again
+)
+
+// validateQueue validates the name of the queue
+func validateQueue(queue string) error {
+	if len(queue) == 0 {
+		return fmt.Errorf("missing queue")
+	}
+	if len(queue) > QueueNameLimit {
+		return fmt.Errorf("the queue name is longer than %d characters", QueueNameLimit)
+	}
+	return nil
+}
+
+// QueuePushRequest keeps the parameters of QUEUE_PUSH command
+type QueuePushRequest struct {
+	Queue       string          `json:"queue"`
+	Payload     json.RawMessage `json:"payload"`
+	Delay       uint64          `json:"delay,omitempty"`        // seconds before the job is visible
+	MaxAttempts uint64          `json:"max_attempts,omitempty"` // if zero, then the default of the extension
+}
+
+// Validate the push request
+func (request QueuePushRequest) Validate() error {
+	if err := validateQueue(request.Queue); err != nil {
+		return err
+	}
+	if len(request.Payload) == 0 || !json.Valid(request.Payload) {
+		return fmt.Errorf("the payload is not a valid json")
+	}
+	return nil
+}
+
+// QueuePushReply keeps the parameters of QUEUE_PUSH command reply by controller
+type QueuePushReply struct {
+	JobId uint64 `json:"job_id"`
+}
+
+// QueueClaimRequest keeps the parameters of QUEUE_CLAIM command.
+//
+// The claimed jobs are invisible to the other workers until the visibility timeout.
+// If the job is not acked or nacked within the timeout, it's claimed again,
+// or dead-lettered if it was the last attempt.
+type QueueClaimRequest struct {
+	Queue      string `json:"queue"`
+	Limit      uint64 `json:"limit,omitempty"`      // the maximum amount of the claimed jobs, by default 1
+	Visibility uint64 `json:"visibility,omitempty"` // seconds, if zero, then the default of the extension
+}
+
+// Validate the claim request
+func (request QueueClaimRequest) Validate() error {
+	return validateQueue(request.Queue)
+}
+
+// QueueJob is the claimed job.
+// The ClaimToken is passed to QUEUE_ACK and QUEUE_NACK.
+//
+// The Payload is the JSON text of the pushed payload.
+// It's the string, since the reply decodes the JSON numbers as float64, losing the precision of the big numbers.
+type QueueJob struct {
+	JobId      uint64 `json:"job_id"`
+	Payload    string `json:"payload"`
+	Attempts   uint64 `json:"attempts"` // including the current attempt
+	ClaimToken string `json:"claim_token"`
+}
+
+// Decode unmarshalls the payload into the dest
+func (job QueueJob) Decode(dest interface{}) error {
+	decoder := json.NewDecoder(strings.NewReader(job.Payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(dest); err != nil {
+		return fmt.Errorf("json.Decode: %w", err)
+	}
+	return nil
+}
+
+// QueueClaimReply keeps the parameters of QUEUE_CLAIM command reply by controller.
+// The jobs are empty if no job is visible.
+type QueueClaimReply struct {
+	Jobs []QueueJob `json:"jobs"`
+}
+
+// QueueAckRequest keeps the parameters of QUEUE_ACK and QUEUE_NACK commands
+type QueueAckRequest struct {
+	JobId      uint64 `json:"job_id"`
+	ClaimToken string `json:"claim_token"`
+	Delay      uint64 `json:"delay,omitempty"` // QUEUE_NACK only, seconds before the job is visible again
+	Error      string `json:"error,omitempty"` // QUEUE_NACK only, the reason of the failure
+}
+
+// Validate the ack request
+func (request QueueAckRequest) Validate() error {
+	if request.JobId == 0 {
+		return fmt.Errorf("missing job_id")
+	}
+	if len(request.ClaimToken) == 0 {
+		return fmt.Errorf("missing claim_token")
+	}
+	return nil
+}
+
+// QueueAckReply keeps the parameters of QUEUE_ACK and QUEUE_NACK commands reply by controller
+type QueueAckReply struct {
+	Status string `json:"status"` // the status of the job after QUEUE_NACK, empty after QUEUE_ACK
+}
@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Seascape-Foundation/sds-common-lib/data_type/key_value"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/message"
+)
+
+// ColumnMetadata describes the column of the SELECT and SELECT_ROW replies in the typed mode.
+type ColumnMetadata struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"` // mysql type, for example "UNSIGNED BIGINT" or "DECIMAL"
+	Nullable  bool   `json:"nullable"`
+	Precision *int64 `json:"precision,omitempty"` // DECIMAL precision
+	Scale     *int64 `json:"scale,omitempty"`     // DECIMAL scale
+	Length    *int64 `json:"length,omitempty"`    // length of the variable length types
+}
+
+// NewColumnMetadata returns the metadata of the columns returned by the query
+func NewColumnMetadata(columnTypes []*sql.ColumnType) []ColumnMetadata {
+	columns := make([]ColumnMetadata, len(columnTypes))
+	for i, columnType := range columnTypes {
+		columns[i] = ColumnMetadata{
+			Name: columnType.Name(),
+			Type: columnType.DatabaseTypeName(),
+		}
+		if nullable, ok := columnType.Nullable(); ok {
+			columns[i].Nullable = nullable
+		}
+		if precision, scale, ok := columnType.DecimalSize(); ok {
+			columns[i].Precision = &precision
+			columns[i].Scale = &scale
+		}
+		if length, ok := columnType.Length(); ok {
+			columns[i].Length = &length
+		}
+	}
+	return columns
+}
+
+// Base64Prefix prefixes the base64 encoded binary values.
+// The binary arguments are accepted with this prefix too, see DatabaseQueryRequest.DeserializeBytes.
+const Base64Prefix = "sds_base64:"
+
+// EncodeValue converts the value scanned from the column into the value
+// that passes through JSON without losses.
+//
+//   - NULL is nil, the row omits it, see SetEncodedValue.
+//   - BIGINT and DECIMAL are strings, since JSON numbers lose the precision above 2^53.
+//   - The smaller integers and the floating numbers are numbers.
+//   - JSON is the decoded object, array or scalar, see DecodeJson. The JSON null is omitted as NULL.
+//   - BINARY, VARBINARY, BLOB and BIT are base64 strings with the padding and Base64Prefix.
+//   - The rest, including the dates, are strings.
+func EncodeValue(databaseType string, raw interface{}) (interface{}, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	switch strings.TrimPrefix(databaseType, "UNSIGNED ") {
+	case "BIGINT", "DECIMAL":
+		return valueString(raw), nil
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "YEAR":
+		if strings.HasPrefix(databaseType, "UNSIGNED ") {
+			value, err := strconv.ParseUint(valueString(raw), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("strconv.ParseUint: %w", err)
+			}
+			return value, nil
+		}
+		value, err := strconv.ParseInt(valueString(raw), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("strconv.ParseInt: %w", err)
+		}
+		return value, nil
+	case "FLOAT", "DOUBLE":
+		value, err := strconv.ParseFloat(valueString(raw), 64)
+		if err != nil {
+			return nil, fmt.Errorf("strconv.ParseFloat: %w", err)
+		}
+		return value, nil
+	case "JSON":
+		return DecodeJson([]byte(valueString(raw)))
+	case "BINARY", "VARBINARY", "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB", "BIT", "GEOMETRY":
+		value, ok := raw.([]byte)
+		if !ok {
+			value = []byte(valueString(raw))
+		}
+		return Base64Prefix + base64.StdEncoding.EncodeToString(value), nil
+	}
+
+	return valueString(raw), nil
+}
+
+// DecodeJson decodes the value of the JSON column.
+// The numbers are json.Number, so the big numbers keep the precision in the reply, see Reply.
+func DecodeJson(raw []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("json.Decode: %w", err)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("the value is not a valid JSON")
+	}
+	return value, nil
+}
+
+// Reply returns the successful reply with the parameters.
+// Unlike command.Reply, the numbers are decoded as json.Number,
+// so the numbers of the JSON columns keep the precision.
+func Reply(reply interface{}) (message.Reply, error) {
+	encoded, err := json.Marshal(reply)
+	if err != nil {
+		return message.Reply{}, fmt.Errorf("json.Marshal: %w", err)
+	}
+	parameters, err := key_value.NewFromString(string(encoded))
+	if err != nil {
+		return message.Reply{}, fmt.Errorf("key_value.NewFromString: %w", err)
+	}
+
+	return message.Reply{
+		Status:     message.OK,
+		Parameters: parameters,
+	}, nil
+}
+
+// SetEncodedValue sets the value encoded by EncodeValue into the row.
+// The NULL is omitted, since the replies can not have the nil values.
+// The column metadata still lists the omitted column.
+func SetEncodedValue(row key_value.KeyValue, name string, databaseType string, raw interface{}) error {
+	value, err := EncodeValue(databaseType, raw)
+	if err != nil {
+		return err
+	}
+	if value != nil {
+		row.Set(name, value)
+	}
+	return nil
+}
+
+// DecodeBase64Prefixed returns the bytes of the base64 string with Base64Prefix.
+// Returns false if the string doesn't have the prefix.
+func DecodeBase64Prefixed(str string) ([]byte, bool, error) {
+	if !strings.HasPrefix(str, Base64Prefix) {
+		return nil, false, nil
+	}
+	value, err := base64.StdEncoding.DecodeString(str[len(Base64Prefix):])
+	if err != nil {
+		return nil, true, fmt.Errorf("base64.DecodeString: %w", err)
+	}
+	return value, true, nil
+}
+
+// valueString returns the text of the value scanned by the mysql driver
+func valueString(raw interface{}) string {
+	switch value := raw.(type) {
+	case []byte:
+		return string(value)
+	case string:
+		return value
+	case time.Time:
+		return value.Format("2006-01-02 15:04:05.999999")
+	}
+	return fmt.Sprint(raw)
+}
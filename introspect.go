@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Seascape-Foundation/mysql-seascape-extension/handler"
+	"github.com/Seascape-Foundation/mysql-seascape-extension/schema"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/command"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/message"
+	"github.com/Seascape-Foundation/sds-service-lib/log"
+	"github.com/Seascape-Foundation/sds-service-lib/remote"
+)
+
+// returns the tables of the database.
+//
+// If the access control is enabled, then only the tables
+// that the service can list are returned.
+var onListTables = func(request message.Request, _ log.Logger, _ remote.Clients) message.Reply {
+	if db == nil || db.Connection == nil {
+		return message.Fail("database.Connection is nil, please open the connection first")
+	}
+
+	summaries, err := schema.List(db.Connection, db.parameters.name)
+	if err != nil {
+		return message.Fail("schema.List: " + err.Error())
+	}
+
+	service := identity(request)
+	reply := handler.ListTablesReply{
+		Tables: make([]schema.Summary, 0, len(summaries)),
+	}
+	for _, summary := range summaries {
+		if db.access.tableVisible(service, handler.ListTables, summary.Name) {
+			reply.Tables = append(reply.Tables, summary)
+		}
+	}
+
+	replyMessage, err := command.Reply(&reply)
+	if err != nil {
+		return message.Fail("command.Reply: " + err.Error())
+	}
+
+	return replyMessage
+}
+
+// returns the columns, the keys and the indexes of the tables
+var onDescribeTable = func(request message.Request, _ log.Logger, _ remote.Clients) message.Reply {
+	if db == nil || db.Connection == nil {
+		return message.Fail("database.Connection is nil, please open the connection first")
+	}
+
+	var parameters handler.DescribeTableRequest
+	err := request.Parameters.Interface(&parameters)
+	if err != nil {
+		return message.Fail("parameter validation:" + err.Error())
+	}
+	if len(parameters.Tables) == 0 {
+		return message.Fail("parameter validation: missing tables")
+	}
+
+	tables, err := schema.Load(db.Connection, db.parameters.name, parameters.Tables...)
+	if err != nil {
+		return message.Fail("schema.Load: " + err.Error())
+	}
+	if len(tables) != len(parameters.Tables) {
+		return message.Fail(fmt.Sprintf("not found: %d of %d tables exist", len(tables), len(parameters.Tables)))
+	}
+
+	reply := handler.DescribeTableReply{
+		Tables: tables,
+	}
+	replyMessage, err := command.Reply(&reply)
+	if err != nil {
+		return message.Fail("command.Reply: " + err.Error())
+	}
+
+	return replyMessage
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Seascape-Foundation/mysql-seascape-extension/handler"
+	"github.com/Seascape-Foundation/mysql-seascape-extension/schema"
+)
+
+// jsonColumns caches the JSON columns of the tables.
+// The cache is reset after the migrations.
+type jsonColumns struct {
+	mutex  sync.RWMutex
+	tables map[string]map[string]bool
+}
+
+func newJsonColumns() *jsonColumns {
+	return &jsonColumns{tables: make(map[string]map[string]bool)}
+}
+
+// columns returns the JSON columns of the table.
+// The columns are loaded from the schema on the first call.
+func (cache *jsonColumns) columns(q schema.Querier, databaseName string, table string) (map[string]bool, error) {
+	cache.mutex.RLock()
+	columns, ok := cache.tables[table]
+	cache.mutex.RUnlock()
+	if ok {
+		return columns, nil
+	}
+
+	tables, err := schema.Load(q, databaseName, table)
+	if err != nil {
+		return nil, fmt.Errorf("schema.Load: %w", err)
+	}
+	columns = make(map[string]bool)
+	for _, loaded := range tables {
+		for _, column := range loaded.Columns {
+			if column.DataType == "json" {
+				columns[column.Name] = true
+			}
+		}
+	}
+
+	cache.mutex.Lock()
+	cache.tables[table] = columns
+	cache.mutex.Unlock()
+
+	return columns, nil
+}
+
+// reset removes the cached columns, so they are loaded from the changed schema
+func (cache *jsonColumns) reset() {
+	cache.mutex.Lock()
+	cache.tables = make(map[string]map[string]bool)
+	cache.mutex.Unlock()
+}
+
+// encodeJsonArguments converts the structured values of the JSON columns
+// in INSERT and UPDATE fields into the JSON text.
+//
+// The strings and the bytes are passed as they are, since they are already the JSON text.
+// The nil is passed as NULL.
+func (database *Database) encodeJsonArguments(request *handler.DatabaseQueryRequest) error {
+	if len(request.Fields) > len(request.Arguments) {
+		return nil
+	}
+
+	columns := make(map[string]bool)
+	for _, table := range request.Tables {
+		fields := strings.Fields(table)
+		if len(fields) == 0 {
+			continue
+		}
+		tableColumns, err := database.jsonColumns.columns(database.Connection, database.parameters.name, strings.Trim(fields[0], "`"))
+		if err != nil {
+			return err
+		}
+		for column := range tableColumns {
+			columns[column] = true
+		}
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+
+	for i, field := range request.Fields {
+		if !columns[columnName(field)] {
+			continue
+		}
+		switch request.Arguments[i].(type) {
+		case nil, string, []byte:
+			continue
+		}
+		encoded, err := json.Marshal(request.Arguments[i])
+		if err != nil {
+			return fmt.Errorf("json.Marshal of '%s' field: %w", field, err)
+		}
+		request.Arguments[i] = string(encoded)
+	}
+
+	return nil
+}
+
+// columnName returns the column of the field without the table and the quotes
+func columnName(field string) string {
+	if i := strings.LastIndex(field, "."); i >= 0 {
+		field = field[i+1:]
+	}
+	return strings.Trim(strings.TrimSpace(field), "`")
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Seascape-Foundation/mysql-seascape-extension/handler"
+	"github.com/Seascape-Foundation/sds-common-lib/data_type/key_value"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/command"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/message"
+	"github.com/Seascape-Foundation/sds-service-lib/configuration"
+	"github.com/Seascape-Foundation/sds-service-lib/log"
+	"github.com/Seascape-Foundation/sds-service-lib/remote"
+)
+
+// LockConfigurations The configuration parameters of the named locks acquired by the clients.
+//
+// SDS_LOCK_LEASE is the default lease of the lock in seconds.
+// SDS_LOCK_MAX_WAIT is the maximum seconds the client waits for the lock held by another service.
+// SDS_LOCK_LIMIT is the maximum amount of the held locks, each lock keeps its own connection.
+var LockConfigurations = configuration.DefaultConfig{
+	Title: "Lock",
+	Parameters: key_value.New(map[string]interface{}{
+		"SDS_LOCK_LEASE":    uint64(30),
+		"SDS_LOCK_MAX_WAIT": uint64(10),
+		"SDS_LOCK_LIMIT":    uint64(64),
+	}),
+}
+
+// namedLock is held by mysql GET_LOCK on the pinned connection.
+// Mysql releases the lock if the connection is closed,
+// so the connection is not returned to the pool until the lock is released.
+type namedLock struct {
+	conn         *sql.Conn
+	connectionId int64 // CONNECTION_ID() of the conn, to detect the lost session
+	holder       string
+	expiresAt    time.Time
+	timer        *time.Timer
+}
+
+// locks keeps the named locks held by the services
+type locks struct {
+	mutex   sync.Mutex
+	list    map[string]*namedLock
+	pending int // the connections that wait for GET_LOCK
+	lease   time.Duration
+	maxWait time.Duration
+	limit   int
+	logger  log.Logger
+}
+
+func newLocks(lease time.Duration, maxWait time.Duration, limit int, logger log.Logger) *locks {
+	return &locks{
+		list:    make(map[string]*namedLock),
+		lease:   lease,
+		maxWait: maxWait,
+		limit:   limit,
+		logger:  logger,
+	}
+}
+
+// newLocksFromConfig returns the locks with the limits set in the configuration
+func newLocksFromConfig(appConfig *configuration.Config, logger log.Logger) (*locks, error) {
+	lease := appConfig.GetUint64("SDS_LOCK_LEASE")
+	if lease > TimeoutCap {
+		return nil, fmt.Errorf("'SDS_LOCK_LEASE' can not be greater than %d (seconds)", TimeoutCap)
+	} else if lease == 0 {
+		return nil, errors.New("the 'SDS_LOCK_LEASE' can not be zero")
+	}
+	maxWait := appConfig.GetUint64("SDS_LOCK_MAX_WAIT")
+	if maxWait > TimeoutCap {
+		return nil, fmt.Errorf("'SDS_LOCK_MAX_WAIT' can not be greater than %d (seconds)", TimeoutCap)
+	}
+	limit := appConfig.GetUint64("SDS_LOCK_LIMIT")
+	if limit == 0 {
+		return nil, errors.New("the 'SDS_LOCK_LIMIT' can not be zero")
+	}
+
+	return newLocks(time.Duration(lease)*time.Second, time.Duration(maxWait)*time.Second, int(limit), logger), nil
+}
+
+// acquire the lock for the holder, waiting for the lock held by another connection.
+// If the holder already has the lock, then its lease is extended.
+//
+// The connection is pinned from the pool given at the moment.
+// After the credential rotation, the locks keep the connections opened with the previous credentials,
+// while the new locks are acquired through the new pool.
+func (l *locks) acquire(pool *sql.DB, name string, holder string, wait time.Duration, lease time.Duration) (time.Time, bool, error) {
+	l.mutex.Lock()
+	held, ok := l.list[name]
+	l.mutex.Unlock()
+	if ok && held.holder == holder {
+		if l.alive(held, name) {
+			return l.extend(name, held, lease)
+		}
+		l.drop(name, held)
+	}
+
+	l.mutex.Lock()
+	if len(l.list)+l.pending >= l.limit {
+		l.mutex.Unlock()
+		return time.Time{}, false, fmt.Errorf("too many locks, the limit is %d", l.limit)
+	}
+	l.pending++
+	l.mutex.Unlock()
+
+	acquired, err := l.getLock(pool, name, holder, wait, lease)
+
+	l.mutex.Lock()
+	l.pending--
+	if err != nil || acquired == nil {
+		l.mutex.Unlock()
+		return time.Time{}, false, err
+	}
+	// mysql gave the lock to the new connection, so the previous holder lost its session
+	previous, ok := l.list[name]
+	l.list[name] = acquired
+	l.mutex.Unlock()
+
+	if ok {
+		l.logger.Warn("the lock was lost by the previous holder", "name", name, "holder", previous.holder)
+		previous.timer.Stop()
+		discard(previous.conn)
+	}
+	return acquired.expiresAt, true, nil
+}
+
+// getLock pins the connection and calls GET_LOCK on it.
+// Returns nil if the lock is held by another connection after the wait.
+func (l *locks) getLock(pool *sql.DB, name string, holder string, wait time.Duration, lease time.Duration) (*namedLock, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), wait+l.maxWait+time.Second)
+	defer cancel()
+
+	conn, err := pool.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("pool.Conn: %w", err)
+	}
+
+	var result sql.NullInt64
+	var connectionId int64
+	row := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?), CONNECTION_ID()", name, int64(wait/time.Second))
+	if err := row.Scan(&result, &connectionId); err != nil {
+		discard(conn)
+		return nil, fmt.Errorf("GET_LOCK: %w", err)
+	}
+	if !result.Valid {
+		_ = conn.Close()
+		return nil, fmt.Errorf("GET_LOCK of '%s' failed", name)
+	}
+	if result.Int64 != 1 {
+		_ = conn.Close()
+		return nil, nil
+	}
+
+	acquired := &namedLock{
+		conn:         conn,
+		connectionId: connectionId,
+		holder:       holder,
+		expiresAt:    time.Now().Add(lease),
+	}
+	acquired.timer = time.AfterFunc(lease, func() {
+		l.expire(name, acquired)
+	})
+	return acquired, nil
+}
+
+// extend the lease of the lock held by the holder
+func (l *locks) extend(name string, held *namedLock, lease time.Duration) (time.Time, bool, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.list[name] != held {
+		return time.Time{}, false, fmt.Errorf("the lock '%s' was released while extending", name)
+	}
+	held.timer.Reset(lease)
+	held.expiresAt = time.Now().Add(lease)
+	return held.expiresAt, true, nil
+}
+
+// alive returns true if the pinned connection still holds the lock
+func (l *locks) alive(held *namedLock, name string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second+l.maxWait)
+	defer cancel()
+
+	var owner sql.NullInt64
+	if err := held.conn.QueryRowContext(ctx, "SELECT IS_USED_LOCK(?)", name).Scan(&owner); err != nil {
+		return false
+	}
+	return owner.Valid && owner.Int64 == held.connectionId
+}
+
+// release the lock of the holder. Returns false if the holder doesn't have the lock.
+func (l *locks) release(name string, holder string) (bool, error) {
+	l.mutex.Lock()
+	held, ok := l.list[name]
+	if !ok || held.holder != holder {
+		l.mutex.Unlock()
+		return false, nil
+	}
+	delete(l.list, name)
+	l.mutex.Unlock()
+
+	held.timer.Stop()
+	return true, l.releaseLock(name, held)
+}
+
+// expire releases the lock which lease is over
+func (l *locks) expire(name string, held *namedLock) {
+	l.mutex.Lock()
+	if l.list[name] != held {
+		l.mutex.Unlock()
+		return
+	}
+	delete(l.list, name)
+	l.mutex.Unlock()
+
+	l.logger.Warn("lock lease expired, releasing", "name", name, "holder", held.holder)
+	if err := l.releaseLock(name, held); err != nil {
+		l.logger.Warn("failed to release the expired lock", "name", name, "error", err)
+	}
+}
+
+// drop forgets the lock which connection lost the session
+func (l *locks) drop(name string, held *namedLock) {
+	l.mutex.Lock()
+	if l.list[name] == held {
+		delete(l.list, name)
+	}
+	l.mutex.Unlock()
+
+	l.logger.Warn("the lock connection was lost", "name", name, "holder", held.holder)
+	held.timer.Stop()
+	discard(held.conn)
+}
+
+// releaseLock calls RELEASE_LOCK and returns the connection to the pool.
+// If RELEASE_LOCK fails, then the connection is discarded, which releases the lock too.
+func (l *locks) releaseLock(name string, held *namedLock) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second+l.maxWait)
+	defer cancel()
+
+	var released sql.NullInt64
+	if err := held.conn.QueryRowContext(ctx, "SELECT RELEASE_LOCK(?)", name).Scan(&released); err != nil {
+		discard(held.conn)
+		return fmt.Errorf("RELEASE_LOCK: %w", err)
+	}
+	_ = held.conn.Close()
+	return nil
+}
+
+// discard closes the connection that may still hold the lock, instead of returning it to the pool
+func discard(conn *sql.Conn) {
+	_ = conn.Raw(func(interface{}) error {
+		return driver.ErrBadConn
+	})
+	_ = conn.Close()
+}
+
+// status returns the holder of the lock and whether the lock is held by any connection
+func (l *locks) status(pool *sql.DB, name string) (handler.LockStatusReply, error) {
+	reply := handler.LockStatusReply{Name: name}
+
+	var owner sql.NullInt64
+	if err := pool.QueryRow("SELECT IS_USED_LOCK(?)", name).Scan(&owner); err != nil {
+		return reply, fmt.Errorf("IS_USED_LOCK: %w", err)
+	}
+	reply.Locked = owner.Valid
+
+	l.mutex.Lock()
+	held, ok := l.list[name]
+	l.mutex.Unlock()
+	if !ok {
+		return reply, nil
+	}
+	if !owner.Valid || owner.Int64 != held.connectionId {
+		l.drop(name, held)
+		return reply, nil
+	}
+	reply.Holder = held.holder
+	reply.ExpiresAt = held.expiresAt.Unix()
+	return reply, nil
+}
+
+// parseLockRequest returns the validated lock request
+func parseLockRequest(request message.Request) (handler.LockRequest, error) {
+	var parameters handler.LockRequest
+	if err := request.Parameters.Interface(&parameters); err != nil {
+		return parameters, err
+	}
+	return parameters, parameters.Validate()
+}
+
+// acquires the named lock for the service
+var onLockAcquire = func(request message.Request, _ log.Logger, _ remote.Clients) message.Reply {
+	if db == nil || db.Connection == nil {
+		return message.Fail("database.Connection is nil, please open the connection first")
+	}
+
+	parameters, err := parseLockRequest(request)
+	if err != nil {
+		return message.Fail("parameter validation:" + err.Error())
+	}
+	wait := time.Duration(parameters.Timeout) * time.Second
+	if wait > db.locks.maxWait {
+		return message.Fail(fmt.Sprintf("parameter validation: the timeout can not be greater than %d (seconds)", db.locks.maxWait/time.Second))
+	}
+	lease := db.locks.lease
+	if parameters.Lease > TimeoutCap {
+		return message.Fail(fmt.Sprintf("parameter validation: the lease can not be greater than %d (seconds)", TimeoutCap))
+	} else if parameters.Lease > 0 {
+		lease = time.Duration(parameters.Lease) * time.Second
+	}
+
+	expiresAt, acquired, err := db.locks.acquire(db.Connection, parameters.Name, identity(request), wait, lease)
+	if err != nil {
+		return message.Fail("locks.acquire: " + err.Error())
+	}
+
+	reply := handler.LockAcquireReply{Acquired: acquired}
+	if acquired {
+		reply.ExpiresAt = expiresAt.Unix()
+	}
+	replyMessage, err := command.Reply(&reply)
+	if err != nil {
+		return message.Fail("command.Reply: " + err.Error())
+	}
+
+	return replyMessage
+}
+
+// releases the named lock of the service
+var onLockRelease = func(request message.Request, _ log.Logger, _ remote.Clients) message.Reply {
+	if db == nil {
+		return message.Fail("database is nil, please open the connection first")
+	}
+
+	parameters, err := parseLockRequest(request)
+	if err != nil {
+		return message.Fail("parameter validation:" + err.Error())
+	}
+
+	released, err := db.locks.release(parameters.Name, identity(request))
+	if err != nil {
+		return message.Fail("locks.release: " + err.Error())
+	}
+
+	reply := handler.LockReleaseReply{Released: released}
+	replyMessage, err := command.Reply(&reply)
+	if err != nil {
+		return message.Fail("command.Reply: " + err.Error())
+	}
+
+	return replyMessage
+}
+
+// returns the holder of the named lock
+var onLockStatus = func(request message.Request, _ log.Logger, _ remote.Clients) message.Reply {
+	if db == nil || db.Connection == nil {
+		return message.Fail("database.Connection is nil, please open the connection first")
+	}
+
+	parameters, err := parseLockRequest(request)
+	if err != nil {
+		return message.Fail("parameter validation:" + err.Error())
+	}
+
+	reply, err := db.locks.status(db.Connection, parameters.Name)
+	if err != nil {
+		return message.Fail("locks.status: " + err.Error())
+	}
+	replyMessage, err := command.Reply(&reply)
+	if err != nil {
+		return message.Fail("command.Reply: " + err.Error())
+	}
+
+	return replyMessage
+}
@@ -5,7 +5,6 @@ import (
 	"github.com/Seascape-Foundation/sds-service-lib/configuration"
 	"github.com/Seascape-Foundation/sds-service-lib/extension"
 	"github.com/Seascape-Foundation/sds-service-lib/log"
-	"sync"
 )
 
 func main() {
@@ -39,24 +38,83 @@ func main() {
 		logger.Fatal("GetParameters", "error", err)
 	}
 
+	db = newDatabase(logger, databaseParameters)
+
+	if err := setupMigrations(logger); err != nil {
+		logger.Fatal("setupMigrations", "error", err)
+	}
+
+	appConfig.SetDefaults(TraceConfigurations)
+	db.tracer, err = newTracer(appConfig, logger)
+	if err != nil {
+		logger.Fatal("newTracer", "error", err)
+	}
+
+	db.access, err = newAccessList(appConfig, logger)
+	if err != nil {
+		logger.Fatal("newAccessList", "error", err)
+	}
+
+	appConfig.SetDefaults(AuditConfigurations)
+	db.audit, err = newAuditor(appConfig)
+	if err != nil {
+		logger.Fatal("newAuditor", "error", err)
+	}
+
+	appConfig.SetDefaults(TransactionConfigurations)
+	db.transactions, err = newTransactionsFromConfig(appConfig, logger)
+	if err != nil {
+		logger.Fatal("newTransactionsFromConfig", "error", err)
+	}
+
+	appConfig.SetDefaults(LockConfigurations)
+	db.locks, err = newLocksFromConfig(appConfig, logger)
+	if err != nil {
+		logger.Fatal("newLocksFromConfig", "error", err)
+	}
+
+	appConfig.SetDefaults(QueueConfigurations)
+	db.queue, err = newQueueFromConfig(appConfig)
+	if err != nil {
+		logger.Fatal("newQueueFromConfig", "error", err)
+	}
+
+	appConfig.SetDefaults(OutboxConfigurations)
+	db.outbox, err = newOutboxFromConfig(appConfig, logger)
+	if err != nil {
+		logger.Fatal("newOutboxFromConfig", "error", err)
+	}
+
+	appConfig.SetDefaults(ChangesConfigurations)
+	db.changes, err = newChangesFromConfig(appConfig, logger)
+	if err != nil {
+		logger.Fatal("newChangesFromConfig", "error", err)
+	}
+
+	appConfig.SetDefaults(SchemaConfigurations)
+	db.schemaCheck = appConfig.GetString("SDS_SCHEMA_CHECK")
+	db.schemaScratch = appConfig.GetString("SDS_SCHEMA_SCRATCH_DSN")
+
 	if appConfig.Secure {
 		logger.Info("Security enabled, therefore start pull controller that waits credentials from vault service")
-		db = &Database{
-			Connection:      nil,
-			connectionMutex: sync.Mutex{},
-			parameters:      *databaseParameters,
-			logger:          logger,
-		}
 		// vault will push the credentials here
 		db.runPuller()
 	} else {
 		logger.Info("Database is connected in an unsafe way. Connecting with default credentials")
 
-		db, err = connectWithDefault(appConfig, logger, databaseParameters)
+		err = connectWithDefault(appConfig, db)
 		if err != nil {
 			logger.Fatal("database error", "message", err)
 		}
 		logger.Info("Database connected successfully!")
+
+		exit, err := db.prepare()
+		if err != nil {
+			logger.Fatal("prepare", "error", err)
+		}
+		if exit {
+			return
+		}
 	}
 
 	logger.Info("Run database controller")
@@ -73,12 +131,44 @@ func main() {
 	}
 
 	dbController := service.GetFirstController()
-	dbController.RegisterCommand(handler.EXIST, onExist)
-	dbController.RegisterCommand(handler.SelectRow, onSelectRow)
-	dbController.RegisterCommand(handler.SelectAll, onSelectAll)
-	dbController.RegisterCommand(handler.DELETE, onDelete)
-	dbController.RegisterCommand(handler.INSERT, onInsert)
-	dbController.RegisterCommand(handler.UPDATE, onUpdate)
+	db.registerCommand(dbController, handler.EXIST, onExist)
+	db.registerCommand(dbController, handler.SelectRow, onSelectRow)
+	db.registerCommand(dbController, handler.SelectAll, onSelectAll)
+	db.registerCommand(dbController, handler.DELETE, onDelete)
+	db.registerCommand(dbController, handler.INSERT, onInsert)
+	db.registerCommand(dbController, handler.UPDATE, onUpdate)
+	db.registerCommand(dbController, handler.COUNT, onCount)
+	db.registerCommand(dbController, handler.AGGREGATE, onAggregate)
+	db.registerCommand(dbController, handler.ChunkedStart, onChunkedStart)
+	db.registerCommand(dbController, handler.ChunkedStatus, onChunkedStatus)
+	db.registerCommand(dbController, handler.ChunkedCancel, onChunkedCancel)
+	db.registerCommand(dbController, handler.TxBegin, onTxBegin)
+	db.registerCommand(dbController, handler.TxCommit, onTxCommit)
+	db.registerCommand(dbController, handler.TxRollback, onTxRollback)
+	db.registerCommand(dbController, handler.LockAcquire, onLockAcquire)
+	db.registerCommand(dbController, handler.LockRelease, onLockRelease)
+	db.registerCommand(dbController, handler.LockStatus, onLockStatus)
+	db.registerCommand(dbController, handler.QueuePush, onQueuePush)
+	db.registerCommand(dbController, handler.QueueClaim, onQueueClaim)
+	db.registerCommand(dbController, handler.QueueAck, onQueueAck)
+	db.registerCommand(dbController, handler.QueueNack, onQueueNack)
+	db.registerCommand(dbController, handler.OutboxReplay, onOutboxReplay)
+	db.registerCommand(dbController, handler.QueryStats, onQueryStats)
+	db.registerCommand(dbController, handler.STATUS, onStatus)
+	db.registerCommand(dbController, handler.SetMode, onSetMode)
+	db.registerCommand(dbController, handler.MigrateStatus, onMigrateStatus)
+	db.registerCommand(dbController, handler.MigrateUp, onMigrateUp)
+	db.registerCommand(dbController, handler.MigrateDown, onMigrateDown)
+	db.registerCommand(dbController, handler.SchemaDiff, onSchemaDiff)
+	db.registerCommand(dbController, handler.ListTables, onListTables)
+	db.registerCommand(dbController, handler.DescribeTable, onDescribeTable)
+
+	if err := db.startOutbox(); err != nil {
+		logger.Fatal("startOutbox", "error", err)
+	}
+	if err := db.startChanges(); err != nil {
+		logger.Fatal("startChanges", "error", err)
+	}
 
 	service.Run()
 }
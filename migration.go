@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Seascape-Foundation/mysql-seascape-extension/handler"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/command"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/message"
+	"github.com/Seascape-Foundation/sds-service-lib/configuration/argument"
+	"github.com/Seascape-Foundation/sds-service-lib/log"
+	"github.com/Seascape-Foundation/sds-service-lib/remote"
+	"github.com/pressly/goose/v3"
+)
+
+// MigrateArgument is the command line argument to migrate the database and exit.
+// The value is one of "status", "up" or "down".
+//
+// Example:
+//
+//	./bin/sds --migrate=up ./.env
+const MigrateArgument = "migrate"
+
+// migrationDir is the path of the migrations within the embedded file system
+const migrationDir = "_db/migrations"
+
+//go:embed _db/migrations/*.sql
+var migrations embed.FS
+
+// createTablePattern finds the names of the tables created by the migrations
+var createTablePattern = regexp.MustCompile("(?i)CREATE\\s+TABLE\\s+(?:IF\\s+NOT\\s+EXISTS\\s+)?`?([A-Za-z0-9_]+)`?")
+
+// migrationTables returns the tables created by the embedded migrations, including the migration version table
+func migrationTables() (map[string]bool, error) {
+	files, err := migrations.ReadDir(migrationDir)
+	if err != nil {
+		return nil, fmt.Errorf("migrations.ReadDir: %w", err)
+	}
+
+	tables := map[string]bool{goose.TableName(): true}
+	for _, file := range files {
+		content, err := migrations.ReadFile(migrationDir + "/" + file.Name())
+		if err != nil {
+			return nil, fmt.Errorf("migrations.ReadFile: %w", err)
+		}
+		for _, match := range createTablePattern.FindAllStringSubmatch(string(content), -1) {
+			tables[match[1]] = true
+		}
+	}
+	return tables, nil
+}
+
+// gooseLogger prints the goose messages with the extension's logger
+type gooseLogger struct {
+	logger log.Logger
+}
+
+func (l gooseLogger) Fatal(v ...interface{}) { l.logger.Fatal(strings.TrimSpace(fmt.Sprint(v...))) }
+func (l gooseLogger) Fatalf(format string, v ...interface{}) {
+	l.logger.Fatal(strings.TrimSpace(fmt.Sprintf(format, v...)))
+}
+func (l gooseLogger) Print(v ...interface{})   { l.logger.Info(strings.TrimSpace(fmt.Sprint(v...))) }
+func (l gooseLogger) Println(v ...interface{}) { l.logger.Info(strings.TrimSpace(fmt.Sprintln(v...))) }
+func (l gooseLogger) Printf(format string, v ...interface{}) {
+	l.logger.Info(strings.TrimSpace(fmt.Sprintf(format, v...)))
+}
+
+// setupMigrations makes goose to use the embedded migrations
+func setupMigrations(logger log.Logger) error {
+	goose.SetBaseFS(migrations)
+	goose.SetLogger(gooseLogger{logger: logger})
+	if err := goose.SetDialect("mysql"); err != nil {
+		return fmt.Errorf("goose.SetDialect: %w", err)
+	}
+
+	return nil
+}
+
+// migrationLockName is the advisory lock name.
+// The lock is acquired by the instance that migrates the database.
+func (database *Database) migrationLockName() string {
+	return "sds_migration_" + database.parameters.name
+}
+
+// withMigrationLock calls the migrate function while holding the advisory lock,
+// so two extension instances never migrate the database concurrently.
+//
+// The lock is acquired on a dedicated connection, since the mysql locks belong to the session.
+func (database *Database) withMigrationLock(migrate func() error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), database.parameters.timeout)
+	defer cancel()
+
+	conn, err := database.Connection.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("db.Connection.Conn: %w", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	var acquired sql.NullInt64
+	timeout := int64(database.parameters.timeout.Seconds())
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", database.migrationLockName(), timeout).Scan(&acquired)
+	if err != nil {
+		return fmt.Errorf("GET_LOCK: %w", err)
+	}
+	if !acquired.Valid || acquired.Int64 != 1 {
+		return fmt.Errorf("another instance is migrating the database, try again later")
+	}
+	defer func() {
+		_, err := conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", database.migrationLockName())
+		if err != nil {
+			database.logger.Warn("failed to release the migration lock", "error", err)
+		}
+	}()
+	// the migrations may add or change the JSON columns
+	defer database.jsonColumns.reset()
+	defer database.changes.reset()
+
+	return migrate()
+}
+
+// migrateUp applies the migrations up to the version.
+// If the version is zero, then applies all pending migrations.
+func (database *Database) migrateUp(version int64) (handler.MigrateReply, error) {
+	var reply handler.MigrateReply
+
+	err := database.withMigrationLock(func() error {
+		previous, err := goose.GetDBVersion(database.Connection)
+		if err != nil {
+			return fmt.Errorf("goose.GetDBVersion: %w", err)
+		}
+		reply.Previous = previous
+
+		if version == 0 {
+			err = goose.Up(database.Connection, migrationDir)
+		} else {
+			err = goose.UpTo(database.Connection, migrationDir, version)
+		}
+		if err != nil {
+			return fmt.Errorf("goose.Up: %w", err)
+		}
+
+		reply.Version, err = goose.GetDBVersion(database.Connection)
+		if err != nil {
+			return fmt.Errorf("goose.GetDBVersion: %w", err)
+		}
+		return nil
+	})
+
+	return reply, err
+}
+
+// migrateDown rolls back the migrations down to the version.
+// If the version is zero, then rolls back only the latest migration.
+func (database *Database) migrateDown(version int64) (handler.MigrateReply, error) {
+	var reply handler.MigrateReply
+
+	err := database.withMigrationLock(func() error {
+		previous, err := goose.GetDBVersion(database.Connection)
+		if err != nil {
+			return fmt.Errorf("goose.GetDBVersion: %w", err)
+		}
+		reply.Previous = previous
+
+		if version == 0 {
+			err = goose.Down(database.Connection, migrationDir)
+		} else {
+			err = goose.DownTo(database.Connection, migrationDir, version)
+		}
+		if err != nil {
+			return fmt.Errorf("goose.Down: %w", err)
+		}
+
+		reply.Version, err = goose.GetDBVersion(database.Connection)
+		if err != nil {
+			return fmt.Errorf("goose.GetDBVersion: %w", err)
+		}
+		return nil
+	})
+
+	return reply, err
+}
+
+// migrationStatus returns the embedded migrations and whether they are applied
+func (database *Database) migrationStatus() (handler.MigrateStatusReply, error) {
+	collected, err := goose.CollectMigrations(migrationDir, 0, goose.MaxVersion)
+	if err != nil {
+		return handler.MigrateStatusReply{}, fmt.Errorf("goose.CollectMigrations: %w", err)
+	}
+
+	version, err := goose.GetDBVersion(database.Connection)
+	if err != nil {
+		return handler.MigrateStatusReply{}, fmt.Errorf("goose.GetDBVersion: %w", err)
+	}
+
+	// the latest record of the version defines whether it's applied or rolled back
+	rows, err := database.Connection.Query("SELECT version_id, is_applied, tstamp FROM " + goose.TableName() + " ORDER BY id DESC")
+	if err != nil {
+		return handler.MigrateStatusReply{}, fmt.Errorf("db.Connection.Query: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	applied := make(map[int64]handler.MigrationStatus)
+	for rows.Next() {
+		var status handler.MigrationStatus
+		var appliedAt sql.NullString
+		if err := rows.Scan(&status.Version, &status.Applied, &appliedAt); err != nil {
+			return handler.MigrateStatusReply{}, fmt.Errorf("rows.Scan: %w", err)
+		}
+		if _, ok := applied[status.Version]; ok {
+			continue
+		}
+		status.AppliedAt = appliedAt.String
+		applied[status.Version] = status
+	}
+	if err := rows.Err(); err != nil {
+		return handler.MigrateStatusReply{}, fmt.Errorf("rows.Err: %w", err)
+	}
+
+	reply := handler.MigrateStatusReply{
+		Version:    version,
+		Migrations: make([]handler.MigrationStatus, len(collected)),
+	}
+	for i, migration := range collected {
+		status := applied[migration.Version]
+		reply.Migrations[i] = handler.MigrationStatus{
+			Version: migration.Version,
+			Source:  filepath.Base(migration.Source),
+			Applied: status.Applied,
+		}
+		if status.Applied {
+			reply.Migrations[i].AppliedAt = status.AppliedAt
+		}
+	}
+
+	return reply, nil
+}
+
+// prepare migrates the database and checks the schema after the first connection.
+// It's called after connecting with the default credentials,
+// or after receiving the first credentials from the vault.
+//
+// If the migrate argument is given, then it's executed, and the returned exit is true.
+// Otherwise, the pending migrations are applied if SDS_DATABASE_MIGRATE is true.
+func (database *Database) prepare() (bool, error) {
+	if argument.Exist(MigrateArgument) {
+		action, err := argument.Value(MigrateArgument)
+		if err != nil {
+			return false, fmt.Errorf("argument.Value(%s): %w", MigrateArgument, err)
+		}
+		if err := database.runMigrateArgument(action); err != nil {
+			return false, fmt.Errorf("runMigrateArgument: %w", err)
+		}
+		return true, nil
+	}
+
+	if database.parameters.migrate {
+		reply, err := database.migrateUp(0)
+		if err != nil {
+			return false, fmt.Errorf("migrateUp: %w", err)
+		}
+		database.logger.Info("Database migrated", "previous", reply.Previous, "version", reply.Version)
+	}
+
+	if err := database.checkSchema(database.schemaCheck); err != nil {
+		return false, fmt.Errorf("checkSchema: %w", err)
+	}
+
+	return false, nil
+}
+
+// runMigrateArgument executes the migration passed as the command line argument
+func (database *Database) runMigrateArgument(action string) error {
+	switch action {
+	case "status":
+		status, err := database.migrationStatus()
+		if err != nil {
+			return fmt.Errorf("migrationStatus: %w", err)
+		}
+		for _, migration := range status.Migrations {
+			appliedAt := "Pending"
+			if migration.Applied {
+				appliedAt = migration.AppliedAt
+			}
+			database.logger.Info(migration.Source, "applied at", appliedAt)
+		}
+		database.logger.Info("migration status", "version", status.Version)
+		return nil
+	case "up":
+		reply, err := database.migrateUp(0)
+		if err != nil {
+			return fmt.Errorf("migrateUp: %w", err)
+		}
+		database.logger.Info("migrated up", "previous", reply.Previous, "version", reply.Version)
+		return nil
+	case "down":
+		reply, err := database.migrateDown(0)
+		if err != nil {
+			return fmt.Errorf("migrateDown: %w", err)
+		}
+		database.logger.Info("migrated down", "previous", reply.Previous, "version", reply.Version)
+		return nil
+	}
+
+	return errors.New("the --" + MigrateArgument + " value should be 'status', 'up' or 'down', but given: " + action)
+}
+
+// returns the list of the migrations and whether they are applied
+var onMigrateStatus = func(_ message.Request, _ log.Logger, _ remote.Clients) message.Reply {
+	if db == nil || db.Connection == nil {
+		return message.Fail("database.Connection is nil, please open the connection first")
+	}
+
+	reply, err := db.migrationStatus()
+	if err != nil {
+		return message.Fail("migrationStatus: " + err.Error())
+	}
+	replyMessage, err := command.Reply(&reply)
+	if err != nil {
+		return message.Fail("command.Reply: " + err.Error())
+	}
+
+	return replyMessage
+}
+
+// applies the pending migrations
+var onMigrateUp = func(request message.Request, logger log.Logger, _ remote.Clients) message.Reply {
+	if db == nil || db.Connection == nil {
+		return message.Fail("database.Connection is nil, please open the connection first")
+	}
+
+	var parameters handler.MigrateRequest
+	err := request.Parameters.Interface(&parameters)
+	if err != nil {
+		return message.Fail("parameter validation:" + err.Error())
+	}
+
+	reply, err := db.migrateUp(parameters.Version)
+	if err != nil {
+		return message.Fail("migrateUp: " + err.Error())
+	}
+	logger.Info("migrated up", "previous", reply.Previous, "version", reply.Version, "service", identity(request))
+
+	replyMessage, err := command.Reply(&reply)
+	if err != nil {
+		return message.Fail("command.Reply: " + err.Error())
+	}
+
+	return replyMessage
+}
+
+// rolls back the migrations
+var onMigrateDown = func(request message.Request, logger log.Logger, _ remote.Clients) message.Reply {
+	if db == nil || db.Connection == nil {
+		return message.Fail("database.Connection is nil, please open the connection first")
+	}
+
+	var parameters handler.MigrateRequest
+	err := request.Parameters.Interface(&parameters)
+	if err != nil {
+		return message.Fail("parameter validation:" + err.Error())
+	}
+
+	reply, err := db.migrateDown(parameters.Version)
+	if err != nil {
+		return message.Fail("migrateDown: " + err.Error())
+	}
+	logger.Info("migrated down", "previous", reply.Previous, "version", reply.Version, "service", identity(request))
+
+	replyMessage, err := command.Reply(&reply)
+	if err != nil {
+		return message.Fail("command.Reply: " + err.Error())
+	}
+
+	return replyMessage
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/Seascape-Foundation/mysql-seascape-extension/handler"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/command"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/message"
+	"github.com/Seascape-Foundation/sds-service-lib/log"
+	"github.com/Seascape-Foundation/sds-service-lib/remote"
+)
+
+// writeCommands are rejected in the read-only mode
+var writeCommands = map[command.Name]bool{
+	handler.INSERT:       true,
+	handler.UPDATE:       true,
+	handler.DELETE:       true,
+	handler.MigrateUp:    true,
+	handler.MigrateDown:  true,
+	handler.ChunkedStart: true,
+	handler.QueuePush:    true,
+	handler.QueueClaim:   true,
+	handler.QueueAck:     true,
+	handler.QueueNack:    true,
+	handler.LockAcquire:  true,
+	handler.OutboxReplay: true,
+}
+
+// maintenanceCommands are the only commands accepted in the maintenance mode
+var maintenanceCommands = map[command.Name]bool{
+	handler.STATUS:        true,
+	handler.SetMode:       true,
+	handler.MigrateStatus: true,
+	handler.MigrateUp:     true,
+	handler.MigrateDown:   true,
+	handler.SchemaDiff:    true,
+	handler.ChunkedStatus: true,
+	handler.ChunkedCancel: true,
+	handler.LockRelease:   true,
+	handler.LockStatus:    true,
+}
+
+// modeSwitch keeps the current mode of the extension.
+// The mode is switched at runtime by the SetMode command.
+type modeSwitch struct {
+	mutex sync.RWMutex
+	mode  handler.Mode
+}
+
+func newModeSwitch(mode handler.Mode) *modeSwitch {
+	return &modeSwitch{mode: mode}
+}
+
+// get the current mode
+func (m *modeSwitch) get() handler.Mode {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.mode
+}
+
+// set the mode, returns the previous mode
+func (m *modeSwitch) set(mode handler.Mode) handler.Mode {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	previous := m.mode
+	m.mode = mode
+	return previous
+}
+
+// check returns an error with the code if the command is not accepted in the current mode
+func (m *modeSwitch) check(name command.Name) (handler.ErrorCode, error) {
+	mode := m.get()
+
+	if mode == handler.MaintenanceMode && !maintenanceCommands[name] {
+		return handler.Maintenance, fmt.Errorf("the database extension is in maintenance mode, '%s' command is rejected", name)
+	}
+	if mode == handler.ReadOnlyMode && writeCommands[name] {
+		return handler.ReadOnly, fmt.Errorf("the database extension is in read-only mode, '%s' command is rejected", name)
+	}
+
+	return "", nil
+}
+
+// writable returns true if the background writes of the extension are allowed.
+// They are paused, unless the mode is read-write, and while any instance runs the migrations.
+func (database *Database) writable() (bool, error) {
+	if database.mode.get() != handler.ReadWriteMode {
+		return false, nil
+	}
+	connection := database.connection()
+	if connection == nil {
+		return false, nil
+	}
+
+	// the migrating instance holds the migration lock
+	var free sql.NullInt64
+	if err := connection.QueryRow("SELECT IS_FREE_LOCK(?)", database.migrationLockName()).Scan(&free); err != nil {
+		return false, fmt.Errorf("IS_FREE_LOCK: %w", err)
+	}
+	return free.Valid && free.Int64 == 1, nil
+}
+
+// returns the state of the extension
+var onStatus = func(_ message.Request, _ log.Logger, _ remote.Clients) message.Reply {
+	if db == nil {
+		return message.Fail("database is nil, please open the connection first")
+	}
+
+	reply := handler.StatusReply{
+		Mode:      db.mode.get(),
+		Connected: db.Connection != nil,
+	}
+	replyMessage, err := command.Reply(&reply)
+	if err != nil {
+		return message.Fail("command.Reply: " + err.Error())
+	}
+
+	return replyMessage
+}
+
+// switches the mode of the extension.
+// If the access rules are omitted, then only the admin services switch the mode.
+var onSetMode = func(request message.Request, logger log.Logger, _ remote.Clients) message.Reply {
+	if db == nil {
+		return message.Fail("database is nil, please open the connection first")
+	}
+
+	// without the access rules, any service could stop the writes
+	service := identity(request)
+	if !db.access.enabled && !db.parameters.admins[service] {
+		return failWithCode(handler.AccessDenied, "access denied: only the 'SDS_DATABASE_ADMINS' services switch the mode")
+	}
+
+	var parameters handler.SetModeRequest
+	err := request.Parameters.Interface(&parameters)
+	if err != nil {
+		return message.Fail("parameter validation:" + err.Error())
+	}
+	if err := parameters.Mode.Validate(); err != nil {
+		return message.Fail("parameter validation:" + err.Error())
+	}
+
+	previous := db.mode.set(parameters.Mode)
+	logger.Info("database extension mode switched", "previous", previous, "mode", parameters.Mode, "service", service)
+
+	reply := handler.SetModeReply{
+		Previous: previous,
+		Mode:     parameters.Mode,
+	}
+	replyMessage, err := command.Reply(&reply)
+	if err != nil {
+		return message.Fail("command.Reply: " + err.Error())
+	}
+
+	return replyMessage
+}
@@ -5,8 +5,11 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/Seascape-Foundation/mysql-seascape-extension/handler"
+	"github.com/Seascape-Foundation/mysql-seascape-extension/trace"
 	"github.com/Seascape-Foundation/sds-service-lib/configuration"
 	"github.com/Seascape-Foundation/sds-service-lib/log"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,10 +21,16 @@ import (
 const TimeoutCap = 3600
 
 type DatabaseParameters struct {
-	hostname string
-	port     string
-	name     string
-	timeout  time.Duration
+	hostname   string
+	port       string
+	name       string
+	timeout    time.Duration
+	slowQuery  time.Duration   // zero means the slow queries are not logged
+	mode       handler.Mode    // the mode on startup
+	migrate    bool            // apply the pending migrations on startup
+	jsonNative bool            // return JSON columns as the JSON values, instead of the prefixed strings
+	maxInList  int             // the maximum amount of the elements in the list argument
+	admins     map[string]bool // the services that switch the mode, if the access rules are omitted
 }
 
 // DatabaseCredentials is a set of dynamic credentials retrieved from Vault
@@ -36,7 +45,22 @@ type Database struct {
 	Connection      *sql.DB
 	connectionMutex sync.Mutex
 	parameters      DatabaseParameters
+	credentials     DatabaseCredentials // credentials of the current connection
 	logger          log.Logger
+	stats           *queryStats
+	tracer          *trace.Tracer
+	audit           *auditor
+	access          *accessList
+	mode            *modeSwitch
+	transactions    *transactions
+	jsonColumns     *jsonColumns
+	jobs            *jobs
+	locks           *locks
+	queue           *queue
+	outbox          *outbox
+	changes         *changes
+	schemaCheck     string // the schema check mode after the first connection
+	schemaScratch   string // the dsn of the scratch database for the schema check
 }
 
 // DatabaseConfigurations The configuration parameters
@@ -45,12 +69,18 @@ type Database struct {
 var DatabaseConfigurations = configuration.DefaultConfig{
 	Title: "Database",
 	Parameters: key_value.New(map[string]interface{}{
-		"SDS_DATABASE_HOST":     "localhost",
-		"SDS_DATABASE_PORT":     "3306",
-		"SDS_DATABASE_NAME":     "seascape_sds",
-		"SDS_DATABASE_TIMEOUT":  uint64(10),
-		"SDS_DATABASE_USERNAME": "root",
-		"SDS_DATABASE_PASSWORD": "tiger",
+		"SDS_DATABASE_HOST":        "localhost",
+		"SDS_DATABASE_PORT":        "3306",
+		"SDS_DATABASE_NAME":        "seascape_sds",
+		"SDS_DATABASE_TIMEOUT":     uint64(10),
+		"SDS_DATABASE_USERNAME":    "root",
+		"SDS_DATABASE_PASSWORD":    "tiger",
+		"SDS_DATABASE_SLOW_QUERY":  uint64(1000), // milliseconds
+		"SDS_DATABASE_MODE":        string(handler.ReadWriteMode),
+		"SDS_DATABASE_MIGRATE":     false,
+		"SDS_DATABASE_JSON_NATIVE": true,
+		"SDS_DATABASE_MAX_IN_LIST": uint64(1000),
+		"SDS_DATABASE_ADMINS":      "",
 	}),
 }
 
@@ -64,12 +94,38 @@ func GetParameters(appConfig *configuration.Config) (*DatabaseParameters, error)
 	} else if timeout == 0 {
 		return nil, errors.New("the 'SDS_DATABASE_TIMEOUT' can not be zero")
 	}
+	slowQuery := appConfig.GetUint64("SDS_DATABASE_SLOW_QUERY")
+	if slowQuery > TimeoutCap*1000 {
+		return nil, fmt.Errorf("'SDS_DATABASE_SLOW_QUERY' can not be greater than %d (milliseconds)", TimeoutCap*1000)
+	}
+	maxInList := appConfig.GetUint64("SDS_DATABASE_MAX_IN_LIST")
+	if maxInList == 0 {
+		return nil, errors.New("the 'SDS_DATABASE_MAX_IN_LIST' can not be zero")
+	}
+	mode := handler.Mode(appConfig.GetString("SDS_DATABASE_MODE"))
+	if err := mode.Validate(); err != nil {
+		return nil, fmt.Errorf("'SDS_DATABASE_MODE': %w", err)
+	}
+
+	admins := make(map[string]bool)
+	for _, service := range strings.Split(appConfig.GetString("SDS_DATABASE_ADMINS"), ",") {
+		service = strings.TrimSpace(service)
+		if len(service) > 0 {
+			admins[service] = true
+		}
+	}
 
 	return &DatabaseParameters{
-		hostname: appConfig.GetString("SDS_DATABASE_HOST"),
-		port:     appConfig.GetString("SDS_DATABASE_PORT"),
-		name:     appConfig.GetString("SDS_DATABASE_NAME"),
-		timeout:  time.Duration(timeout) * time.Second,
+		hostname:   appConfig.GetString("SDS_DATABASE_HOST"),
+		port:       appConfig.GetString("SDS_DATABASE_PORT"),
+		name:       appConfig.GetString("SDS_DATABASE_NAME"),
+		timeout:    time.Duration(timeout) * time.Second,
+		slowQuery:  time.Duration(slowQuery) * time.Millisecond,
+		mode:       mode,
+		migrate:    appConfig.GetBool("SDS_DATABASE_MIGRATE"),
+		jsonNative: appConfig.GetBool("SDS_DATABASE_JSON_NATIVE"),
+		maxInList:  int(maxInList),
+		admins:     admins,
 	}, nil
 }
 
@@ -81,21 +137,40 @@ func GetDefaultCredentials(appConfig *configuration.Config) DatabaseCredentials
 	}
 }
 
-// Open establishes a database connection
-func connectWithDefault(appConfig *configuration.Config, logger log.Logger, parameters *DatabaseParameters) (*Database, error) {
-	database := &Database{
+// newDatabase returns the database without the connection.
+// The connection is established by Database.Reconnect.
+//
+// The tracing, the auditing and the access control are disabled,
+// until they are set from the configuration.
+func newDatabase(logger log.Logger, parameters *DatabaseParameters) *Database {
+	return &Database{
 		Connection:      nil,
 		connectionMutex: sync.Mutex{},
 		parameters:      *parameters,
 		logger:          logger,
+		stats:           newQueryStats(),
+		tracer:          trace.New(nil, nil),
+		audit:           &auditor{sink: AuditNone},
+		access:          &accessList{},
+		mode:            newModeSwitch(parameters.mode),
+		transactions:    newTransactions(30*time.Second, 64, logger),
+		jsonColumns:     newJsonColumns(),
+		jobs:            newJobs(),
+		locks:           newLocks(30*time.Second, 10*time.Second, 64, logger),
+		queue:           &queue{visibility: 30 * time.Second, maxAttempts: 5, claimLimit: 100},
+		outbox:          &outbox{interval: 500 * time.Millisecond, batch: 100, logger: logger},
+		changes:         newChanges("", 1000, logger),
 	}
+}
 
+// connectWithDefault establishes a database connection with the default credentials
+func connectWithDefault(appConfig *configuration.Config, database *Database) error {
 	// establish the first connection
 	if err := database.Reconnect(GetDefaultCredentials(appConfig)); err != nil {
-		return nil, fmt.Errorf("database.reconnect: %w", err)
+		return fmt.Errorf("database.reconnect: %w", err)
 	}
 
-	return database, nil
+	return nil
 }
 
 func (database *Database) Timeout() time.Duration {
@@ -121,17 +196,7 @@ func (database *Database) Reconnect(credentials DatabaseCredentials) error {
 		"timeout", database.parameters.timeout,
 	)
 
-	dsn := fmt.Sprintf(
-		"%s:%s@tcp(%s:%s)/%s?timeout=%s",
-		credentials.Username,
-		credentials.Password,
-		database.parameters.hostname,
-		database.parameters.port,
-		database.parameters.name,
-		database.parameters.timeout.String(),
-	)
-
-	connection, err := sql.Open("mysql", dsn)
+	connection, err := sql.Open("mysql", database.dsn(credentials, database.parameters.name))
 	if err != nil {
 		return fmt.Errorf("sql.open: %w", err)
 	}
@@ -150,14 +215,30 @@ func (database *Database) Reconnect(credentials DatabaseCredentials) error {
 		}
 	}
 
-	database.closeReplaceConnection(connection)
+	database.closeReplaceConnection(connection, credentials)
 
 	database.logger.Info("connection success!", "database", database.parameters.name)
 
 	return nil
 }
 
-func (database *Database) closeReplaceConnection(new *sql.DB) {
+// dsn returns the connection string to the database with the given name.
+//
+// The affected rows are the matched rows (clientFoundRows),
+// so the update that sets the same values is not reported as the conflict or as no update.
+func (database *Database) dsn(credentials DatabaseCredentials, name string) string {
+	return fmt.Sprintf(
+		"%s:%s@tcp(%s:%s)/%s?timeout=%s&clientFoundRows=true",
+		credentials.Username,
+		credentials.Password,
+		database.parameters.hostname,
+		database.parameters.port,
+		name,
+		database.parameters.timeout.String(),
+	)
+}
+
+func (database *Database) closeReplaceConnection(new *sql.DB, credentials DatabaseCredentials) {
 	/* */ database.connectionMutex.Lock()
 	defer database.connectionMutex.Unlock()
 
@@ -168,6 +249,16 @@ func (database *Database) closeReplaceConnection(new *sql.DB) {
 
 	// replace with a new connection
 	database.Connection = new
+	database.credentials = credentials
+}
+
+// connection returns the current connection.
+// It's replaced when the credentials are rotated.
+func (database *Database) connection() *sql.DB {
+	database.connectionMutex.Lock()
+	defer database.connectionMutex.Unlock()
+
+	return database.Connection
 }
 
 func (database *Database) Close() error {
@@ -29,8 +29,8 @@ type TestMysqlSuite struct {
 func (suite *TestMysqlSuite) SetupTest() {
 	suite.dbName = "test"
 	_, filename, _, _ := runtime.Caller(0)
-	storageAbiSql := "20230308171023_storage_abi.sql"
-	storageAbiPath := filepath.Join(filepath.Dir(filename), "..", "_db", "migrations", storageAbiSql)
+	storageAbiSql := "20230308171023_static_abi.sql"
+	storageAbiPath := filepath.Join(filepath.Dir(filename), "_db", "migrations", storageAbiSql)
 
 	// create_test_db := "create_test_db.sql"
 	// create_test_db_path := filepath.Join(filepath.Dir(filename), "..", "_db", create_test_db)
@@ -107,14 +107,14 @@ func (suite *TestMysqlSuite) SetupTest() {
 
 func (suite *TestMysqlSuite) TestInsert() {
 	// query
-	query := `INSERT INTO storage_abi (abi_id, body) VALUES (?, ?)`
+	query := `INSERT INTO abi (abi_id, body) VALUES (?, ?)`
 	arguments := []interface{}{"test_id", `[{}]`}
 
 	_, err := suite.dbCon.Query(suite.ctx, query, arguments)
 	suite.Require().NoError(err)
 
 	// query
-	query = `SELECT abi_id FROM storage_abi WHERE abi_id = ?`
+	query = `SELECT abi_id FROM abi WHERE abi_id = ?`
 	arguments = []interface{}{"test_id"}
 
 	_, err = suite.dbCon.Query(suite.ctx, query, arguments)
@@ -123,7 +123,7 @@ func (suite *TestMysqlSuite) TestInsert() {
 
 func (suite *TestMysqlSuite) TestSelect() {
 	// query
-	query := `SELECT abi_id FROM storage_abi WHERE abi_id = ?`
+	query := `SELECT abi_id FROM abi WHERE abi_id = ?`
 	arguments := []interface{}{"test_id"}
 
 	result, err := suite.dbCon.Query(suite.ctx, query, arguments)
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Seascape-Foundation/mysql-seascape-extension/handler"
+	"github.com/Seascape-Foundation/sds-common-lib/data_type/key_value"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/command"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/message"
+	"github.com/Seascape-Foundation/sds-service-lib/configuration"
+	"github.com/Seascape-Foundation/sds-service-lib/log"
+	"github.com/Seascape-Foundation/sds-service-lib/remote"
+	zmq "github.com/pebbe/zmq4"
+)
+
+// outboxTable is created by the outbox migration
+const outboxTable = "outbox"
+
+// OutboxConfigurations The configuration parameters of the outbox relay.
+//
+// SDS_OUTBOX_URL is the endpoint of the PUB socket, for example "tcp://*:4010".
+// If it's empty, then the relay is disabled, while the messages are still written to the outbox.
+// SDS_OUTBOX_INTERVAL is the milliseconds between the polls of the outbox table.
+// SDS_OUTBOX_BATCH is the maximum amount of the messages published per poll.
+// SDS_OUTBOX_RETENTION is the seconds the delivered messages are kept for the replay.
+// If it's zero, then the delivered messages are never deleted.
+var OutboxConfigurations = configuration.DefaultConfig{
+	Title: "Outbox",
+	Parameters: key_value.New(map[string]interface{}{
+		"SDS_OUTBOX_URL":       "",
+		"SDS_OUTBOX_INTERVAL":  uint64(500),
+		"SDS_OUTBOX_BATCH":     uint64(100),
+		"SDS_OUTBOX_RETENTION": uint64(604800),
+	}),
+}
+
+// outboxCleanupInterval is the time between the deletions of the expired delivered messages
+const outboxCleanupInterval = time.Minute
+
+// outboxCleanupBatch is the maximum amount of the messages deleted by one statement
+const outboxCleanupBatch = 1000
+
+// outbox relays the outbox messages to the subscribers.
+//
+// The messages are published before they are marked as delivered,
+// so after the failure the message is published again.
+// The at-least-once delivery covers only the outbox table to the socket:
+// the PUB socket drops the message if there is no subscriber or the subscriber's queue is full.
+// The subscribers that missed the messages request the replay.
+//
+// The messages are published in the order of the outbox ids, that are assigned when the message is written.
+// The concurrent transactions could commit in the other order, so the relay publishes only the messages
+// before the first id still pending in the open transaction, see bound.
+// The subscribers receive the increasing ids, and the replay from the id doesn't miss the messages committed later.
+// The extension is expected to be the only writer of the outbox table.
+type outbox struct {
+	url       string
+	interval  time.Duration
+	batch     uint64
+	retention time.Duration // zero if the delivered messages are kept forever
+	logger    log.Logger
+
+	mutex      sync.Mutex
+	replayFrom uint64 // the id of the next replayed message, zero if there is no replay
+
+	// the writes are serialized, so the id written later is always greater
+	writing sync.Mutex
+	pending map[uint64]bool // the ids written by the transactions that are not ended yet
+	written uint64          // the greatest written id, zero if it's not loaded yet
+}
+
+// newOutboxFromConfig returns the outbox relay set in the configuration
+func newOutboxFromConfig(appConfig *configuration.Config, logger log.Logger) (*outbox, error) {
+	interval := appConfig.GetUint64("SDS_OUTBOX_INTERVAL")
+	if interval == 0 {
+		return nil, fmt.Errorf("the 'SDS_OUTBOX_INTERVAL' can not be zero")
+	} else if interval > TimeoutCap*1000 {
+		return nil, fmt.Errorf("'SDS_OUTBOX_INTERVAL' can not be greater than %d (milliseconds)", TimeoutCap*1000)
+	}
+	batch := appConfig.GetUint64("SDS_OUTBOX_BATCH")
+	if batch == 0 {
+		return nil, fmt.Errorf("the 'SDS_OUTBOX_BATCH' can not be zero")
+	}
+
+	return &outbox{
+		url:       appConfig.GetString("SDS_OUTBOX_URL"),
+		interval:  time.Duration(interval) * time.Millisecond,
+		batch:     batch,
+		retention: time.Duration(appConfig.GetUint64("SDS_OUTBOX_RETENTION")) * time.Second,
+		logger:    logger,
+	}, nil
+}
+
+// enabled returns true if the relay publishes the messages
+func (o *outbox) enabled() bool {
+	return len(o.url) > 0
+}
+
+// replay publishes the messages again, starting from the id
+func (o *outbox) replay(from uint64) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.replayFrom = from
+}
+
+// replayed moves the replay to the next id.
+// The replay is finished if the next id is zero.
+// If the replay was restarted meanwhile, then it's kept.
+func (o *outbox) replayed(from uint64, next uint64) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.replayFrom == from {
+		o.replayFrom = next
+	}
+}
+
+func (o *outbox) replaying() uint64 {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	return o.replayFrom
+}
+
+// write writes the messages to the outbox table, if the statement changed any rows.
+// Returns the ids of the written messages, call finish with them after the transaction is ended.
+// The ids are returned even on failure, since the transaction could have written some of them.
+func (o *outbox) write(exec execer, service string, messages []handler.OutboxMessage, affected int64) ([]uint64, error) {
+	if affected == 0 || len(messages) == 0 {
+		return nil, nil
+	}
+
+	o.writing.Lock()
+	defer o.writing.Unlock()
+
+	if o.pending == nil {
+		o.pending = make(map[uint64]bool)
+	}
+	ids := make([]uint64, 0, len(messages))
+	for _, outboxMessage := range messages {
+		result, err := exec.Exec(`INSERT INTO `+outboxTable+` (topic, payload, service, created_at) VALUES (?, ?, ?, NOW(6))`,
+			outboxMessage.Topic, string(outboxMessage.Payload), service)
+		if err != nil {
+			return ids, fmt.Errorf("exec.Exec: %w", err)
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return ids, fmt.Errorf("result.LastInsertId: %w", err)
+		}
+		ids = append(ids, uint64(id))
+		o.pending[uint64(id)] = true
+		if uint64(id) > o.written {
+			o.written = uint64(id)
+		}
+	}
+	return ids, nil
+}
+
+// finish marks the messages of the committed or rolled back transaction as not pending
+func (o *outbox) finish(ids []uint64) {
+	if len(ids) == 0 {
+		return
+	}
+
+	o.writing.Lock()
+	defer o.writing.Unlock()
+
+	for _, id := range ids {
+		delete(o.pending, id)
+	}
+}
+
+// bound returns the id, that all messages before it are committed or rolled back.
+// It's the first pending id, or the next id after the greatest written id.
+//
+// The messages written before the start are committed,
+// so the greatest id is loaded from the table, before the extension writes any message.
+func (o *outbox) bound(connection *sql.DB) (uint64, error) {
+	o.writing.Lock()
+	defer o.writing.Unlock()
+
+	if o.written == 0 {
+		if err := connection.QueryRow(`SELECT COALESCE(MAX(outbox_id), 0) FROM ` + outboxTable).Scan(&o.written); err != nil {
+			return 0, fmt.Errorf("db.Connection.QueryRow: %w", err)
+		}
+	}
+	bound := o.written + 1
+	for id := range o.pending {
+		if id < bound {
+			bound = id
+		}
+	}
+	return bound, nil
+}
+
+// startOutbox binds the PUB socket and starts the relay in the background
+func (database *Database) startOutbox() error {
+	if !database.outbox.enabled() {
+		return nil
+	}
+
+	socket, err := zmq.NewSocket(zmq.PUB)
+	if err != nil {
+		return fmt.Errorf("zmq error for new pub socket: %w", err)
+	}
+	if err := socket.Bind(database.outbox.url); err != nil {
+		_ = socket.Close()
+		return fmt.Errorf("socket.Bind: %s: %w", database.outbox.url, err)
+	}
+
+	database.logger.Info("outbox relay started", "url", database.outbox.url, "interval", database.outbox.interval)
+	go database.runOutbox(socket)
+	return nil
+}
+
+// runOutbox publishes the outbox messages until the extension stops.
+// The socket is used only by this goroutine.
+//
+// The relay and the cleanup write to the outbox table,
+// so they are paused while the extension is not writable, see Database.writable.
+func (database *Database) runOutbox(socket *zmq.Socket) {
+	ticker := time.NewTicker(database.outbox.interval)
+	defer ticker.Stop()
+
+	var cleaned time.Time
+	for range ticker.C {
+		writable, err := database.writable()
+		if err != nil {
+			database.logger.Warn("outbox relay failed to check the mode, retrying", "error", err)
+			continue
+		}
+		if !writable {
+			continue
+		}
+
+		if database.outbox.retention > 0 && time.Since(cleaned) >= outboxCleanupInterval {
+			if err := database.cleanOutbox(); err != nil {
+				database.logger.Warn("outbox cleanup failed, retrying", "error", err)
+			}
+			cleaned = time.Now()
+		}
+
+		// publish the batches without waiting, until the outbox is drained
+		for {
+			published, err := database.relay(socket)
+			if err != nil {
+				database.logger.Warn("outbox relay failed, retrying", "error", err)
+				break
+			}
+			if published < database.outbox.batch {
+				break
+			}
+		}
+	}
+}
+
+// cleanOutbox deletes the delivered messages older than the retention, in the batches
+func (database *Database) cleanOutbox() error {
+	connection := database.connection()
+	if connection == nil {
+		return nil
+	}
+
+	for {
+		result, err := connection.Exec(`DELETE FROM `+outboxTable+` WHERE delivered_at < DATE_SUB(NOW(6), INTERVAL ? SECOND) LIMIT ?`,
+			uint64(database.outbox.retention/time.Second), outboxCleanupBatch)
+		if err != nil {
+			return fmt.Errorf("db.Connection.Exec: %w", err)
+		}
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("result.RowsAffected: %w", err)
+		}
+		if deleted < outboxCleanupBatch {
+			return nil
+		}
+	}
+}
+
+// relay publishes one batch of the outbox messages in the order of their ids,
+// then marks them as delivered. Returns the amount of the published messages.
+// Only the messages before the bound are published, so the pending message is never skipped.
+//
+// If the replay is requested, then the messages starting from the replay id are published,
+// including the delivered ones.
+func (database *Database) relay(socket *zmq.Socket) (uint64, error) {
+	connection := database.connection()
+	if connection == nil {
+		return 0, nil
+	}
+
+	bound, err := database.outbox.bound(connection)
+	if err != nil {
+		return 0, err
+	}
+
+	from := database.outbox.replaying()
+	query := `SELECT outbox_id, topic, payload, delivered_at IS NULL FROM ` + outboxTable + ` WHERE outbox_id < ?`
+	arguments := make([]interface{}, 0, 3)
+	arguments = append(arguments, bound)
+	if from > 0 {
+		query += ` AND outbox_id >= ?`
+		arguments = append(arguments, from)
+	} else {
+		query += ` AND delivered_at IS NULL`
+	}
+	query += ` ORDER BY outbox_id LIMIT ?`
+	arguments = append(arguments, database.outbox.batch)
+
+	rows, err := connection.Query(query, arguments...)
+	if err != nil {
+		return 0, fmt.Errorf("db.Connection.Query: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var published, last uint64
+	undelivered := make([]interface{}, 0, database.outbox.batch)
+	for rows.Next() {
+		var id uint64
+		var topic string
+		var payload []byte
+		var pending bool
+		if err := rows.Scan(&id, &topic, &payload, &pending); err != nil {
+			return published, fmt.Errorf("rows.Scan: %w", err)
+		}
+		if _, err := socket.SendMessage(topic, strconv.FormatUint(id, 10), payload); err != nil {
+			// the published messages are not marked, so they are published again
+			return published, fmt.Errorf("socket.SendMessage: %w", err)
+		}
+		published++
+		last = id
+		if pending {
+			undelivered = append(undelivered, id)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return published, fmt.Errorf("rows.Err: %w", err)
+	}
+
+	if len(undelivered) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(undelivered)), ", ")
+		_, err := connection.Exec(`UPDATE `+outboxTable+` SET delivered_at = NOW(6) WHERE delivered_at IS NULL AND outbox_id IN (`+placeholders+`)`,
+			undelivered...)
+		if err != nil {
+			return published, fmt.Errorf("db.Connection.Exec: %w", err)
+		}
+	}
+
+	if from > 0 {
+		next := last + 1
+		if published < database.outbox.batch {
+			next = 0
+		}
+		database.outbox.replayed(from, next)
+	}
+	return published, nil
+}
+
+// publishes the outbox messages again, starting from the id
+var onOutboxReplay = func(request message.Request, _ log.Logger, _ remote.Clients) message.Reply {
+	if db == nil {
+		return message.Fail("database is nil, please open the connection first")
+	}
+	if !db.outbox.enabled() {
+		return message.Fail("the outbox relay is disabled, set 'SDS_OUTBOX_URL'")
+	}
+
+	var parameters handler.OutboxReplayRequest
+	if err := request.Parameters.Interface(&parameters); err != nil {
+		return message.Fail("parameter validation:" + err.Error())
+	}
+	if parameters.From == 0 {
+		return message.Fail("parameter validation: missing from, the outbox ids start from 1")
+	}
+
+	db.outbox.replay(parameters.From)
+
+	reply := handler.OutboxReplayReply{}
+	replyMessage, err := command.Reply(&reply)
+	if err != nil {
+		return message.Fail("command.Reply: " + err.Error())
+	}
+
+	return replyMessage
+}
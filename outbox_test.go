@@ -0,0 +1,72 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/Seascape-Foundation/mysql-seascape-extension/handler"
+	"github.com/stretchr/testify/suite"
+)
+
+// outboxResult is the result of the outbox insert
+type outboxResult int64
+
+func (id outboxResult) LastInsertId() (int64, error) { return int64(id), nil }
+func (id outboxResult) RowsAffected() (int64, error) { return 1, nil }
+
+// outboxExecer assigns the increasing ids to the inserted messages
+type outboxExecer struct {
+	last *int64
+}
+
+func (exec outboxExecer) Exec(string, ...interface{}) (sql.Result, error) {
+	*exec.last++
+	return outboxResult(*exec.last), nil
+}
+
+// Define the suite, and absorb the built-in basic suite
+// functionality from testify - including a T() method which
+// returns the current testing context
+type TestOutboxSuite struct {
+	suite.Suite
+}
+
+func (suite *TestOutboxSuite) TestBound() {
+	var last int64 = 10
+	exec := outboxExecer{last: &last}
+	o := &outbox{written: 10}
+	messages := []handler.OutboxMessage{{Topic: "a", Payload: []byte(`{}`)}}
+
+	bound, err := o.bound(nil)
+	suite.Require().NoError(err)
+	suite.Require().Equal(uint64(11), bound)
+
+	// the statement that changed no rows writes no messages
+	ids, err := o.write(exec, Anonymous, messages, 0)
+	suite.Require().NoError(err)
+	suite.Require().Empty(ids)
+
+	first, err := o.write(exec, Anonymous, messages, 1)
+	suite.Require().NoError(err)
+	suite.Require().Equal([]uint64{11}, first)
+	second, err := o.write(exec, Anonymous, append(messages, messages...), 1)
+	suite.Require().NoError(err)
+	suite.Require().Equal([]uint64{12, 13}, second)
+
+	// the second transaction is committed first, but its messages wait for the first one
+	o.finish(second)
+	bound, err = o.bound(nil)
+	suite.Require().NoError(err)
+	suite.Require().Equal(uint64(11), bound)
+
+	o.finish(first)
+	bound, err = o.bound(nil)
+	suite.Require().NoError(err)
+	suite.Require().Equal(uint64(14), bound)
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestOutbox(t *testing.T) {
+	suite.Run(t, new(TestOutboxSuite))
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Seascape-Foundation/mysql-seascape-extension/handler"
+	"github.com/Seascape-Foundation/sds-common-lib/data_type/key_value"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/command"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/message"
+	"github.com/Seascape-Foundation/sds-service-lib/configuration"
+	"github.com/Seascape-Foundation/sds-service-lib/log"
+	"github.com/Seascape-Foundation/sds-service-lib/remote"
+)
+
+// queueTable is created by the queue_job migration
+const queueTable = "queue_job"
+
+// QueueConfigurations The configuration parameters of the job queue.
+//
+// SDS_QUEUE_VISIBILITY is the default seconds the claimed job is invisible to the other workers.
+// SDS_QUEUE_MAX_ATTEMPTS is the default amount of the claims before the job is dead-lettered.
+// SDS_QUEUE_CLAIM_LIMIT is the maximum amount of the jobs claimed at once.
+var QueueConfigurations = configuration.DefaultConfig{
+	Title: "Queue",
+	Parameters: key_value.New(map[string]interface{}{
+		"SDS_QUEUE_VISIBILITY":   uint64(30),
+		"SDS_QUEUE_MAX_ATTEMPTS": uint64(5),
+		"SDS_QUEUE_CLAIM_LIMIT":  uint64(100),
+	}),
+}
+
+// queue keeps the defaults of the job queue
+type queue struct {
+	visibility  time.Duration
+	maxAttempts uint64
+	claimLimit  uint64
+}
+
+// newQueueFromConfig returns the queue with the defaults set in the configuration
+func newQueueFromConfig(appConfig *configuration.Config) (*queue, error) {
+	visibility := appConfig.GetUint64("SDS_QUEUE_VISIBILITY")
+	if visibility > TimeoutCap {
+		return nil, fmt.Errorf("'SDS_QUEUE_VISIBILITY' can not be greater than %d (seconds)", TimeoutCap)
+	} else if visibility == 0 {
+		return nil, errors.New("the 'SDS_QUEUE_VISIBILITY' can not be zero")
+	}
+	maxAttempts := appConfig.GetUint64("SDS_QUEUE_MAX_ATTEMPTS")
+	if maxAttempts == 0 {
+		return nil, errors.New("the 'SDS_QUEUE_MAX_ATTEMPTS' can not be zero")
+	}
+	claimLimit := appConfig.GetUint64("SDS_QUEUE_CLAIM_LIMIT")
+	if claimLimit == 0 {
+		return nil, errors.New("the 'SDS_QUEUE_CLAIM_LIMIT' can not be zero")
+	}
+
+	return &queue{
+		visibility:  time.Duration(visibility) * time.Second,
+		maxAttempts: maxAttempts,
+		claimLimit:  claimLimit,
+	}, nil
+}
+
+// push adds the job to the queue, returns its id
+func (q *queue) push(connection *sql.DB, request handler.QueuePushRequest) (uint64, error) {
+	maxAttempts := request.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = q.maxAttempts
+	}
+
+	result, err := connection.Exec(`INSERT INTO `+queueTable+` (queue, payload, status, attempts, max_attempts, visible_at, created_at, updated_at)
+		VALUES (?, ?, ?, 0, ?, DATE_ADD(NOW(6), INTERVAL ? SECOND), NOW(6), NOW(6))`,
+		request.Queue, string(request.Payload), handler.QueueReady, maxAttempts, request.Delay)
+	if err != nil {
+		return 0, fmt.Errorf("db.Connection.Exec: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("result.LastInsertId: %w", err)
+	}
+	return uint64(id), nil
+}
+
+// claim the visible jobs for the service.
+//
+// The jobs claimed by other workers at the same moment are skipped, rather than waited for.
+// The claimed jobs which visibility timeout expired are visible again.
+// If such job had the last attempt, then it's dead-lettered instead of claimed,
+// so fewer jobs than the limit could be returned.
+func (q *queue) claim(connection *sql.DB, service string, request handler.QueueClaimRequest) ([]handler.QueueJob, error) {
+	limit := request.Limit
+	if limit == 0 {
+		limit = 1
+	} else if limit > q.claimLimit {
+		return nil, fmt.Errorf("the limit can not be greater than %d", q.claimLimit)
+	}
+	visibility := uint64(q.visibility / time.Second)
+	if request.Visibility > TimeoutCap {
+		return nil, fmt.Errorf("the visibility can not be greater than %d (seconds)", TimeoutCap)
+	} else if request.Visibility > 0 {
+		visibility = request.Visibility
+	}
+
+	tx, err := connection.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("db.Connection.Begin: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	rows, err := tx.Query(`SELECT job_id, payload, attempts, max_attempts FROM `+queueTable+`
+		WHERE queue = ? AND status IN (?, ?) AND visible_at <= NOW(6)
+		ORDER BY visible_at, job_id LIMIT ? FOR UPDATE SKIP LOCKED`,
+		request.Queue, handler.QueueReady, handler.QueueClaimed, limit)
+	if err != nil {
+		return nil, fmt.Errorf("tx.Query: %w", err)
+	}
+	jobs := make([]handler.QueueJob, 0, limit)
+	dead := make([]uint64, 0)
+	for rows.Next() {
+		var job handler.QueueJob
+		var payload []byte
+		var maxAttempts uint64
+		if err := rows.Scan(&job.JobId, &payload, &job.Attempts, &maxAttempts); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("rows.Scan: %w", err)
+		}
+		if job.Attempts >= maxAttempts {
+			dead = append(dead, job.JobId)
+			continue
+		}
+		job.Payload = string(payload)
+		jobs = append(jobs, job)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, fmt.Errorf("rows.Close: %w", err)
+	}
+
+	for _, id := range dead {
+		_, err := tx.Exec(`UPDATE `+queueTable+` SET status = ?, claim_token = NULL, updated_at = NOW(6),
+			last_error = COALESCE(last_error, 'the visibility timeout of the last attempt expired') WHERE job_id = ?`,
+			handler.QueueDead, id)
+		if err != nil {
+			return nil, fmt.Errorf("tx.Exec: %w", err)
+		}
+	}
+	for i := range jobs {
+		token, err := randomId()
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec(`UPDATE `+queueTable+` SET status = ?, attempts = attempts + 1, claim_token = ?, claimed_by = ?,
+			visible_at = DATE_ADD(NOW(6), INTERVAL ? SECOND), updated_at = NOW(6) WHERE job_id = ?`,
+			handler.QueueClaimed, token, service, visibility, jobs[i].JobId)
+		if err != nil {
+			return nil, fmt.Errorf("tx.Exec: %w", err)
+		}
+		jobs[i].ClaimToken = token
+		jobs[i].Attempts++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("tx.Commit: %w", err)
+	}
+	return jobs, nil
+}
+
+// ack removes the job claimed with the token
+func (q *queue) ack(connection *sql.DB, request handler.QueueAckRequest) error {
+	result, err := connection.Exec(`DELETE FROM `+queueTable+` WHERE job_id = ? AND claim_token = ? AND status = ?`,
+		request.JobId, request.ClaimToken, handler.QueueClaimed)
+	if err != nil {
+		return fmt.Errorf("db.Connection.Exec: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("result.RowsAffected: %w", err)
+	}
+	if affected == 0 {
+		return errNotClaimed(request.JobId)
+	}
+	return nil
+}
+
+// nack returns the job claimed with the token to the queue after the delay.
+// If it was the last attempt, then the job is dead-lettered.
+// Returns the status of the job.
+func (q *queue) nack(connection *sql.DB, request handler.QueueAckRequest) (string, error) {
+	if request.Delay > TimeoutCap {
+		return "", fmt.Errorf("the delay can not be greater than %d (seconds)", TimeoutCap)
+	}
+
+	tx, err := connection.Begin()
+	if err != nil {
+		return "", fmt.Errorf("db.Connection.Begin: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var attempts, maxAttempts uint64
+	err = tx.QueryRow(`SELECT attempts, max_attempts FROM `+queueTable+` WHERE job_id = ? AND claim_token = ? AND status = ? FOR UPDATE`,
+		request.JobId, request.ClaimToken, handler.QueueClaimed).Scan(&attempts, &maxAttempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", errNotClaimed(request.JobId)
+	} else if err != nil {
+		return "", fmt.Errorf("tx.QueryRow: %w", err)
+	}
+
+	status := handler.QueueReady
+	if attempts >= maxAttempts {
+		status = handler.QueueDead
+	}
+	_, err = tx.Exec(`UPDATE `+queueTable+` SET status = ?, claim_token = NULL, last_error = ?,
+		visible_at = DATE_ADD(NOW(6), INTERVAL ? SECOND), updated_at = NOW(6) WHERE job_id = ?`,
+		status, request.Error, request.Delay, request.JobId)
+	if err != nil {
+		return "", fmt.Errorf("tx.Exec: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("tx.Commit: %w", err)
+	}
+	return status, nil
+}
+
+func errNotClaimed(id uint64) error {
+	return fmt.Errorf("the job %d is not claimed with the token, its visibility timeout expired or it was acked", id)
+}
+
+// adds the job to the queue
+var onQueuePush = func(request message.Request, _ log.Logger, _ remote.Clients) message.Reply {
+	if db == nil || db.Connection == nil {
+		return message.Fail("database.Connection is nil, please open the connection first")
+	}
+
+	var parameters handler.QueuePushRequest
+	if err := request.Parameters.Interface(&parameters); err != nil {
+		return message.Fail("parameter validation:" + err.Error())
+	}
+	if err := parameters.Validate(); err != nil {
+		return message.Fail("parameter validation:" + err.Error())
+	}
+	if parameters.Delay > TimeoutCap {
+		return message.Fail(fmt.Sprintf("parameter validation: the delay can not be greater than %d (seconds)", TimeoutCap))
+	}
+
+	id, err := db.queue.push(db.Connection, parameters)
+	if err != nil {
+		return message.Fail("queue.push: " + err.Error())
+	}
+
+	reply := handler.QueuePushReply{JobId: id}
+	replyMessage, err := command.Reply(&reply)
+	if err != nil {
+		return message.Fail("command.Reply: " + err.Error())
+	}
+
+	return replyMessage
+}
+
+// claims the visible jobs of the queue
+var onQueueClaim = func(request message.Request, _ log.Logger, _ remote.Clients) message.Reply {
+	if db == nil || db.Connection == nil {
+		return message.Fail("database.Connection is nil, please open the connection first")
+	}
+
+	var parameters handler.QueueClaimRequest
+	if err := request.Parameters.Interface(&parameters); err != nil {
+		return message.Fail("parameter validation:" + err.Error())
+	}
+	if err := parameters.Validate(); err != nil {
+		return message.Fail("parameter validation:" + err.Error())
+	}
+
+	jobs, err := db.queue.claim(db.Connection, identity(request), parameters)
+	if err != nil {
+		return message.Fail("queue.claim: " + err.Error())
+	}
+
+	reply := handler.QueueClaimReply{Jobs: jobs}
+	replyMessage, err := command.Reply(&reply)
+	if err != nil {
+		return message.Fail("command.Reply: " + err.Error())
+	}
+
+	return replyMessage
+}
+
+// removes the processed job
+var onQueueAck = func(request message.Request, _ log.Logger, _ remote.Clients) message.Reply {
+	if db == nil || db.Connection == nil {
+		return message.Fail("database.Connection is nil, please open the connection first")
+	}
+
+	var parameters handler.QueueAckRequest
+	if err := request.Parameters.Interface(&parameters); err != nil {
+		return message.Fail("parameter validation:" + err.Error())
+	}
+	if err := parameters.Validate(); err != nil {
+		return message.Fail("parameter validation:" + err.Error())
+	}
+
+	if err := db.queue.ack(db.Connection, parameters); err != nil {
+		return message.Fail("queue.ack: " + err.Error())
+	}
+
+	reply := handler.QueueAckReply{}
+	replyMessage, err := command.Reply(&reply)
+	if err != nil {
+		return message.Fail("command.Reply: " + err.Error())
+	}
+
+	return replyMessage
+}
+
+// returns the failed job to the queue
+var onQueueNack = func(request message.Request, _ log.Logger, _ remote.Clients) message.Reply {
+	if db == nil || db.Connection == nil {
+		return message.Fail("database.Connection is nil, please open the connection first")
+	}
+
+	var parameters handler.QueueAckRequest
+	if err := request.Parameters.Interface(&parameters); err != nil {
+		return message.Fail("parameter validation:" + err.Error())
+	}
+	if err := parameters.Validate(); err != nil {
+		return message.Fail("parameter validation:" + err.Error())
+	}
+
+	status, err := db.queue.nack(db.Connection, parameters)
+	if err != nil {
+		return message.Fail("queue.nack: " + err.Error())
+	}
+
+	reply := handler.QueueAckReply{Status: status}
+	replyMessage, err := command.Reply(&reply)
+	if err != nil {
+		return message.Fail("command.Reply: " + err.Error())
+	}
+
+	return replyMessage
+}
@@ -0,0 +1,169 @@
+package schema
+
+import "sort"
+
+// DifferenceKind is the type of the schema drift
+type DifferenceKind string
+
+const (
+	MissingTable         DifferenceKind = "missing_table"
+	UnexpectedTable      DifferenceKind = "unexpected_table"
+	MissingColumn        DifferenceKind = "missing_column"
+	UnexpectedColumn     DifferenceKind = "unexpected_column"
+	ColumnMismatch       DifferenceKind = "column_mismatch"
+	MissingIndex         DifferenceKind = "missing_index"
+	UnexpectedIndex      DifferenceKind = "unexpected_index"
+	IndexMismatch        DifferenceKind = "index_mismatch"
+	MissingForeignKey    DifferenceKind = "missing_foreign_key"
+	UnexpectedForeignKey DifferenceKind = "unexpected_foreign_key"
+	ForeignKeyMismatch   DifferenceKind = "foreign_key_mismatch"
+)
+
+// Difference between the expected and the actual schema.
+//
+// The Name is the column, index or foreign key name.
+// It's empty if the whole table is missing or unexpected.
+type Difference struct {
+	Kind     DifferenceKind `json:"kind"`
+	Table    string         `json:"table"`
+	Name     string         `json:"name,omitempty"`
+	Expected string         `json:"expected,omitempty"`
+	Actual   string         `json:"actual,omitempty"`
+}
+
+// String returns the human-readable difference
+func (difference Difference) String() string {
+	target := difference.Table
+	if len(difference.Name) > 0 {
+		target += "." + difference.Name
+	}
+	text := string(difference.Kind) + " " + target
+	if len(difference.Expected) > 0 {
+		text += ", expected: " + difference.Expected
+	}
+	if len(difference.Actual) > 0 {
+		text += ", actual: " + difference.Actual
+	}
+
+	return text
+}
+
+// Diff compares the actual tables against the expected tables.
+// The tables listed in the ignore are not compared.
+//
+// The order of the columns is not compared.
+func Diff(expected []Table, actual []Table, ignore ...string) []Difference {
+	ignored := make(map[string]bool, len(ignore))
+	for _, name := range ignore {
+		ignored[name] = true
+	}
+
+	actualTables := make(map[string]Table, len(actual))
+	for _, table := range actual {
+		actualTables[table.Name] = table
+	}
+	expectedTables := make(map[string]bool, len(expected))
+
+	differences := make([]Difference, 0)
+	for _, table := range expected {
+		expectedTables[table.Name] = true
+		if ignored[table.Name] {
+			continue
+		}
+		actualTable, ok := actualTables[table.Name]
+		if !ok {
+			differences = append(differences, Difference{Kind: MissingTable, Table: table.Name})
+			continue
+		}
+		differences = append(differences, diffTable(table, actualTable)...)
+	}
+	for _, table := range actual {
+		if !expectedTables[table.Name] && !ignored[table.Name] {
+			differences = append(differences, Difference{Kind: UnexpectedTable, Table: table.Name})
+		}
+	}
+
+	return differences
+}
+
+// definition is the named part of the table: a column, an index or a foreign key
+type definition interface {
+	String() string
+}
+
+// diffTable compares the columns, indexes and foreign keys of the table
+func diffTable(expected Table, actual Table) []Difference {
+	differences := make([]Difference, 0)
+
+	expectedColumns := make(map[string]definition, len(expected.Columns))
+	for _, column := range expected.Columns {
+		expectedColumns[column.Name] = column
+	}
+	actualColumns := make(map[string]definition, len(actual.Columns))
+	for _, column := range actual.Columns {
+		actualColumns[column.Name] = column
+	}
+	differences = append(differences, diffDefinitions(expected.Name, expectedColumns, actualColumns, MissingColumn, UnexpectedColumn, ColumnMismatch)...)
+
+	expectedIndexes := make(map[string]definition, len(expected.Indexes))
+	for _, index := range expected.Indexes {
+		expectedIndexes[index.Name] = index
+	}
+	actualIndexes := make(map[string]definition, len(actual.Indexes))
+	for _, index := range actual.Indexes {
+		actualIndexes[index.Name] = index
+	}
+	differences = append(differences, diffDefinitions(expected.Name, expectedIndexes, actualIndexes, MissingIndex, UnexpectedIndex, IndexMismatch)...)
+
+	expectedForeignKeys := make(map[string]definition, len(expected.ForeignKeys))
+	for _, foreignKey := range expected.ForeignKeys {
+		expectedForeignKeys[foreignKey.Name] = foreignKey
+	}
+	actualForeignKeys := make(map[string]definition, len(actual.ForeignKeys))
+	for _, foreignKey := range actual.ForeignKeys {
+		actualForeignKeys[foreignKey.Name] = foreignKey
+	}
+	differences = append(differences, diffDefinitions(expected.Name, expectedForeignKeys, actualForeignKeys, MissingForeignKey, UnexpectedForeignKey, ForeignKeyMismatch)...)
+
+	return differences
+}
+
+// diffDefinitions compares the definitions by their names, the differences are sorted by the name
+func diffDefinitions(table string, expected map[string]definition, actual map[string]definition, missing, unexpected, mismatch DifferenceKind) []Difference {
+	differences := make([]Difference, 0)
+
+	for _, name := range sortedNames(expected) {
+		actualDefinition, ok := actual[name]
+		if !ok {
+			differences = append(differences, Difference{Kind: missing, Table: table, Name: name, Expected: expected[name].String()})
+			continue
+		}
+		if expected[name].String() != actualDefinition.String() {
+			differences = append(differences, Difference{
+				Kind:     mismatch,
+				Table:    table,
+				Name:     name,
+				Expected: expected[name].String(),
+				Actual:   actualDefinition.String(),
+			})
+		}
+	}
+	for _, name := range sortedNames(actual) {
+		if _, ok := expected[name]; !ok {
+			differences = append(differences, Difference{Kind: unexpected, Table: table, Name: name, Actual: actual[name].String()})
+		}
+	}
+
+	return differences
+}
+
+// sortedNames returns the keys of the definitions in the alphabetical order
+func sortedNames(definitions map[string]definition) []string {
+	names := make([]string, 0, len(definitions))
+	for name := range definitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
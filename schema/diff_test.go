@@ -0,0 +1,105 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// Define the suite, and absorb the built-in basic suite
+// functionality from testify - including a T() method which
+// returns the current testing context
+type TestDiffSuite struct {
+	suite.Suite
+	expected []Table
+}
+
+func (suite *TestDiffSuite) SetupTest() {
+	suite.expected = []Table{
+		{
+			Name: "abi",
+			Columns: []Column{
+				{Name: "abi_id", Type: "varchar(20)", Nullable: false, Key: "PRI"},
+				{Name: "body", Type: "json", Nullable: true},
+			},
+			Indexes: []Index{
+				{Name: "abi_id", Unique: true, Columns: []string{"abi_id"}},
+			},
+		},
+		{
+			Name: "smartcontract",
+			Columns: []Column{
+				{Name: "network_id", Type: "varchar(20)", Key: "PRI"},
+				{Name: "address", Type: "varchar(255)", Key: "PRI"},
+				{Name: "abi_id", Type: "varchar(20)", Key: "MUL"},
+			},
+			Indexes: []Index{
+				{Name: "PRIMARY", Unique: true, Columns: []string{"network_id", "address"}},
+				{Name: "abi_id", Unique: false, Columns: []string{"abi_id"}},
+			},
+			ForeignKeys: []ForeignKey{
+				{Name: "smartcontract_ibfk_1", Columns: []string{"abi_id"}, ReferencedTable: "abi", ReferencedColumns: []string{"abi_id"}},
+			},
+		},
+	}
+}
+
+func (suite *TestDiffSuite) TestNoDrift() {
+	// the order of the columns is not compared
+	actual := []Table{suite.expected[0], suite.expected[1]}
+	actual[0].Columns = []Column{suite.expected[0].Columns[1], suite.expected[0].Columns[0]}
+
+	differences := Diff(suite.expected, actual)
+	suite.Require().Empty(differences)
+}
+
+func (suite *TestDiffSuite) TestTables() {
+	actual := []Table{
+		suite.expected[0],
+		{Name: "goose_db_version"},
+		{Name: "storage_abi"},
+	}
+
+	differences := Diff(suite.expected, actual, "goose_db_version")
+	suite.Require().Equal([]Difference{
+		{Kind: MissingTable, Table: "smartcontract"},
+		{Kind: UnexpectedTable, Table: "storage_abi"},
+	}, differences)
+}
+
+func (suite *TestDiffSuite) TestColumns() {
+	actual := []Table{suite.expected[0], suite.expected[1]}
+	actual[0].Columns = []Column{
+		{Name: "abi_id", Type: "varchar(64)", Nullable: false, Key: "PRI"},
+		{Name: "created_at", Type: "datetime", Nullable: true},
+	}
+
+	differences := Diff(suite.expected, actual)
+	suite.Require().Equal([]Difference{
+		{Kind: ColumnMismatch, Table: "abi", Name: "abi_id", Expected: "varchar(20) NOT NULL PRI", Actual: "varchar(64) NOT NULL PRI"},
+		{Kind: MissingColumn, Table: "abi", Name: "body", Expected: "json NULL"},
+		{Kind: UnexpectedColumn, Table: "abi", Name: "created_at", Actual: "datetime NULL"},
+	}, differences)
+	suite.Require().Equal("column_mismatch abi.abi_id, expected: varchar(20) NOT NULL PRI, actual: varchar(64) NOT NULL PRI", differences[0].String())
+}
+
+func (suite *TestDiffSuite) TestKeys() {
+	actual := []Table{suite.expected[0], suite.expected[1]}
+	actual[1].Indexes = []Index{
+		{Name: "PRIMARY", Unique: true, Columns: []string{"address", "network_id"}},
+	}
+	actual[1].ForeignKeys = nil
+
+	differences := Diff(suite.expected, actual)
+	suite.Require().Equal([]Difference{
+		{Kind: IndexMismatch, Table: "smartcontract", Name: "PRIMARY", Expected: "UNIQUE (network_id, address)", Actual: "UNIQUE (address, network_id)"},
+		{Kind: MissingIndex, Table: "smartcontract", Name: "abi_id", Expected: "INDEX (abi_id)"},
+		{Kind: MissingForeignKey, Table: "smartcontract", Name: "smartcontract_ibfk_1", Expected: "(abi_id) REFERENCES abi (abi_id)"},
+	}, differences)
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestDiff(t *testing.T) {
+	suite.Run(t, new(TestDiffSuite))
+}
@@ -0,0 +1,294 @@
+// Package schema reads the structure of the mysql database from information_schema,
+// and compares two structures.
+package schema
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Querier is implemented by sql.DB, sql.Conn and sql.Tx
+type Querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Column of the table
+type Column struct {
+	Name      string  `json:"name"`
+	Type      string  `json:"type"`      // mysql column type, for example "varchar(20)" or "bigint unsigned"
+	DataType  string  `json:"data_type"` // mysql type without the length and attributes, for example "varchar"
+	Nullable  bool    `json:"nullable"`
+	Default   *string `json:"default,omitempty"`
+	Key       string  `json:"key,omitempty"`        // PRI, UNI or MUL
+	Extra     string  `json:"extra,omitempty"`      // for example "auto_increment"
+	MaxLength *int64  `json:"max_length,omitempty"` // for the string and binary columns
+	Precision *int64  `json:"precision,omitempty"`  // for the numeric columns
+	Scale     *int64  `json:"scale,omitempty"`      // for the numeric columns
+	Comment   string  `json:"comment,omitempty"`
+}
+
+// Index of the table. The primary key is the index named PRIMARY.
+type Index struct {
+	Name    string   `json:"name"`
+	Unique  bool     `json:"unique"`
+	Columns []string `json:"columns"`
+}
+
+// ForeignKey of the table
+type ForeignKey struct {
+	Name              string   `json:"name"`
+	Columns           []string `json:"columns"`
+	ReferencedTable   string   `json:"referenced_table"`
+	ReferencedColumns []string `json:"referenced_columns"`
+}
+
+// Table is the structure of the table
+type Table struct {
+	Name        string       `json:"name"`
+	PrimaryKey  []string     `json:"primary_key"`
+	Columns     []Column     `json:"columns"`
+	Indexes     []Index      `json:"indexes"`
+	ForeignKeys []ForeignKey `json:"foreign_keys"`
+}
+
+// Summary of the table returned in the list of tables
+type Summary struct {
+	Name    string `json:"name"`
+	Engine  string `json:"engine"`
+	Rows    int64  `json:"rows"` // estimated amount of rows
+	Comment string `json:"comment,omitempty"`
+}
+
+// String returns the column definition, for example "varchar(20) NOT NULL"
+func (column Column) String() string {
+	definition := column.Type
+	if column.Nullable {
+		definition += " NULL"
+	} else {
+		definition += " NOT NULL"
+	}
+	if column.Default != nil {
+		definition += " DEFAULT '" + *column.Default + "'"
+	}
+	if len(column.Key) > 0 {
+		definition += " " + column.Key
+	}
+	if len(column.Extra) > 0 {
+		definition += " " + column.Extra
+	}
+
+	return definition
+}
+
+// String returns the index definition, for example "UNIQUE (abi_id)"
+func (index Index) String() string {
+	kind := "INDEX"
+	if index.Unique {
+		kind = "UNIQUE"
+	}
+	return kind + " (" + strings.Join(index.Columns, ", ") + ")"
+}
+
+// String returns the foreign key definition, for example "(abi_id) REFERENCES abi (abi_id)"
+func (foreignKey ForeignKey) String() string {
+	return "(" + strings.Join(foreignKey.Columns, ", ") + ") REFERENCES " +
+		foreignKey.ReferencedTable + " (" + strings.Join(foreignKey.ReferencedColumns, ", ") + ")"
+}
+
+// List returns the summary of the tables in the database sorted by the name
+func List(q Querier, database string) ([]Summary, error) {
+	rows, err := q.Query(`SELECT TABLE_NAME, ENGINE, TABLE_ROWS, TABLE_COMMENT
+FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_TYPE = 'BASE TABLE' ORDER BY TABLE_NAME`, database)
+	if err != nil {
+		return nil, fmt.Errorf("query tables: %w", err)
+	}
+
+	summaries := make([]Summary, 0)
+	err = scan(rows, func(rows *sql.Rows) error {
+		var summary Summary
+		var engine sql.NullString
+		var amount sql.NullInt64
+		if err := rows.Scan(&summary.Name, &engine, &amount, &summary.Comment); err != nil {
+			return err
+		}
+		summary.Engine = engine.String
+		summary.Rows = amount.Int64
+		summaries = append(summaries, summary)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan tables: %w", err)
+	}
+
+	return summaries, nil
+}
+
+// Load returns the tables of the database sorted by the name.
+// If the names are given, then only those tables are returned.
+func Load(q Querier, database string, names ...string) ([]Table, error) {
+	tables := make(map[string]*Table)
+
+	filter, arguments := tableFilter(database, names)
+	rows, err := q.Query(`SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_TYPE = 'BASE TABLE'`+filter, arguments...)
+	if err != nil {
+		return nil, fmt.Errorf("query tables: %w", err)
+	}
+	err = scan(rows, func(rows *sql.Rows) error {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		tables[name] = &Table{
+			Name:        name,
+			PrimaryKey:  make([]string, 0),
+			Columns:     make([]Column, 0),
+			Indexes:     make([]Index, 0),
+			ForeignKeys: make([]ForeignKey, 0),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan tables: %w", err)
+	}
+
+	rows, err = q.Query(`SELECT TABLE_NAME, COLUMN_NAME, COLUMN_TYPE, DATA_TYPE, IS_NULLABLE, COLUMN_DEFAULT, COLUMN_KEY, EXTRA,
+CHARACTER_MAXIMUM_LENGTH, NUMERIC_PRECISION, NUMERIC_SCALE, COLUMN_COMMENT
+FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ?`+filter+` ORDER BY TABLE_NAME, ORDINAL_POSITION`, arguments...)
+	if err != nil {
+		return nil, fmt.Errorf("query columns: %w", err)
+	}
+	err = scan(rows, func(rows *sql.Rows) error {
+		var tableName, nullable string
+		var defaultValue sql.NullString
+		var maxLength, precision, scale sql.NullInt64
+		var column Column
+		err := rows.Scan(&tableName, &column.Name, &column.Type, &column.DataType, &nullable, &defaultValue, &column.Key, &column.Extra,
+			&maxLength, &precision, &scale, &column.Comment)
+		if err != nil {
+			return err
+		}
+		column.Nullable = nullable == "YES"
+		if defaultValue.Valid {
+			column.Default = &defaultValue.String
+		}
+		column.MaxLength = nullInt(maxLength)
+		column.Precision = nullInt(precision)
+		column.Scale = nullInt(scale)
+		if table, ok := tables[tableName]; ok {
+			table.Columns = append(table.Columns, column)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan columns: %w", err)
+	}
+
+	rows, err = q.Query(`SELECT TABLE_NAME, INDEX_NAME, NON_UNIQUE, COLUMN_NAME
+FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = ?`+filter+` ORDER BY TABLE_NAME, INDEX_NAME, SEQ_IN_INDEX`, arguments...)
+	if err != nil {
+		return nil, fmt.Errorf("query indexes: %w", err)
+	}
+	err = scan(rows, func(rows *sql.Rows) error {
+		var tableName, indexName string
+		var nonUnique int
+		var columnName sql.NullString // functional indexes have no column
+		if err := rows.Scan(&tableName, &indexName, &nonUnique, &columnName); err != nil {
+			return err
+		}
+		table, ok := tables[tableName]
+		if !ok {
+			return nil
+		}
+		last := len(table.Indexes) - 1
+		if last < 0 || table.Indexes[last].Name != indexName {
+			table.Indexes = append(table.Indexes, Index{Name: indexName, Unique: nonUnique == 0, Columns: make([]string, 0, 1)})
+			last++
+		}
+		table.Indexes[last].Columns = append(table.Indexes[last].Columns, columnName.String)
+		if indexName == "PRIMARY" {
+			table.PrimaryKey = append(table.PrimaryKey, columnName.String)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan indexes: %w", err)
+	}
+
+	rows, err = q.Query(`SELECT TABLE_NAME, CONSTRAINT_NAME, COLUMN_NAME, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME
+FROM information_schema.KEY_COLUMN_USAGE WHERE TABLE_SCHEMA = ? AND REFERENCED_TABLE_NAME IS NOT NULL`+filter+`
+ORDER BY TABLE_NAME, CONSTRAINT_NAME, ORDINAL_POSITION`, arguments...)
+	if err != nil {
+		return nil, fmt.Errorf("query foreign keys: %w", err)
+	}
+	err = scan(rows, func(rows *sql.Rows) error {
+		var tableName, constraintName, columnName, referencedTable, referencedColumn string
+		if err := rows.Scan(&tableName, &constraintName, &columnName, &referencedTable, &referencedColumn); err != nil {
+			return err
+		}
+		table, ok := tables[tableName]
+		if !ok {
+			return nil
+		}
+		last := len(table.ForeignKeys) - 1
+		if last < 0 || table.ForeignKeys[last].Name != constraintName {
+			table.ForeignKeys = append(table.ForeignKeys, ForeignKey{Name: constraintName, ReferencedTable: referencedTable})
+			last++
+		}
+		table.ForeignKeys[last].Columns = append(table.ForeignKeys[last].Columns, columnName)
+		table.ForeignKeys[last].ReferencedColumns = append(table.ForeignKeys[last].ReferencedColumns, referencedColumn)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan foreign keys: %w", err)
+	}
+
+	list := make([]Table, 0, len(tables))
+	for _, table := range tables {
+		list = append(list, *table)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	return list, nil
+}
+
+// tableFilter returns the condition that limits the query to the named tables, and the query arguments
+func tableFilter(database string, names []string) (string, []interface{}) {
+	arguments := []interface{}{database}
+	if len(names) == 0 {
+		return "", arguments
+	}
+
+	placeholders := make([]string, len(names))
+	for i, name := range names {
+		placeholders[i] = "?"
+		arguments = append(arguments, name)
+	}
+
+	return " AND TABLE_NAME IN (" + strings.Join(placeholders, ", ") + ")", arguments
+}
+
+func nullInt(value sql.NullInt64) *int64 {
+	if !value.Valid {
+		return nil
+	}
+	return &value.Int64
+}
+
+// scan calls the function for each row, then closes the rows
+func scan(rows *sql.Rows, row func(*sql.Rows) error) error {
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		if err := row(rows); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
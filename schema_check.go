@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/Seascape-Foundation/mysql-seascape-extension/handler"
+	"github.com/Seascape-Foundation/mysql-seascape-extension/schema"
+	"github.com/Seascape-Foundation/sds-common-lib/data_type/key_value"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/command"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/message"
+	"github.com/Seascape-Foundation/sds-service-lib/configuration"
+	"github.com/Seascape-Foundation/sds-service-lib/log"
+	"github.com/Seascape-Foundation/sds-service-lib/remote"
+	"github.com/go-sql-driver/mysql"
+	"github.com/pressly/goose/v3"
+)
+
+// Schema check modes on startup
+const (
+	SchemaCheckNone   = "none"
+	SchemaCheckWarn   = "warn"
+	SchemaCheckStrict = "strict"
+)
+
+// SchemaConfigurations The configuration parameters of the schema drift detection.
+//
+// SDS_SCHEMA_CHECK is one of: "none", "warn" or "strict".
+// In the "warn" mode, the differences between the live schema and the migrations are logged.
+// In the "strict" mode, the extension refuses to start if the schema drifted.
+//
+// The expected schema is built by applying the embedded migrations to the scratch database
+// given by SDS_SCHEMA_SCRATCH_DSN, for example "user:password@tcp(localhost:3306)/sds_scratch".
+// The tables of the scratch database are dropped before each check,
+// so it should be the empty database dedicated to the check.
+// The check is refused if the scratch database is the live database on the same server,
+// or if it has the tables that the migrations don't create.
+var SchemaConfigurations = configuration.DefaultConfig{
+	Title: "Schema",
+	Parameters: key_value.New(map[string]interface{}{
+		"SDS_SCHEMA_CHECK":       SchemaCheckNone,
+		"SDS_SCHEMA_SCRATCH_DSN": "",
+	}),
+}
+
+// scratchLockName is the advisory lock held while the migrations are applied to the scratch database
+const scratchLockName = "sds_schema_scratch"
+
+// expectedSchema applies the embedded migrations to the scratch database,
+// and returns its tables.
+func (database *Database) expectedSchema() ([]schema.Table, error) {
+	if len(database.schemaScratch) == 0 {
+		return nil, fmt.Errorf("the scratch database is not set, set 'SDS_SCHEMA_SCRATCH_DSN'")
+	}
+	config, err := mysql.ParseDSN(database.schemaScratch)
+	if err != nil {
+		return nil, fmt.Errorf("'SDS_SCHEMA_SCRATCH_DSN': %w", err)
+	}
+	if len(config.DBName) == 0 {
+		return nil, fmt.Errorf("'SDS_SCHEMA_SCRATCH_DSN' is missing the database name")
+	}
+	scratch, err := sql.Open("mysql", database.schemaScratch)
+	if err != nil {
+		return nil, fmt.Errorf("sql.Open: %w", err)
+	}
+	defer func() {
+		_ = scratch.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), database.parameters.timeout)
+	defer cancel()
+	conn, err := scratch.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("scratch.Conn: %w", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	// the checks of the concurrent calls and the other instances are not mixed
+	var acquired sql.NullInt64
+	timeout := int64(database.parameters.timeout.Seconds())
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", scratchLockName, timeout).Scan(&acquired); err != nil {
+		return nil, fmt.Errorf("GET_LOCK: %w", err)
+	}
+	if !acquired.Valid || acquired.Int64 != 1 {
+		return nil, fmt.Errorf("the scratch database is used by another check, try again later")
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", scratchLockName)
+	}()
+
+	// the same database could be reached by another host name, so the server and the database are compared
+	if err := database.notLive(ctx, conn); err != nil {
+		return nil, err
+	}
+	if err := dropTables(conn, config.DBName); err != nil {
+		return nil, fmt.Errorf("reset the scratch database: %w", err)
+	}
+	if err := goose.Up(scratch, migrationDir); err != nil {
+		return nil, fmt.Errorf("goose.Up: %w", err)
+	}
+
+	tables, err := schema.Load(scratch, config.DBName)
+	if err != nil {
+		return nil, fmt.Errorf("schema.Load(scratch): %w", err)
+	}
+
+	return tables, nil
+}
+
+// notLive returns an error if the scratch connection is connected to the live database
+func (database *Database) notLive(ctx context.Context, conn *sql.Conn) error {
+	live := database.connection()
+	if live == nil {
+		return fmt.Errorf("database.Connection is nil, the scratch database can not be compared to the live database")
+	}
+
+	var liveServer, liveName, scratchServer, scratchName sql.NullString
+	if err := live.QueryRowContext(ctx, "SELECT @@server_uuid, DATABASE()").Scan(&liveServer, &liveName); err != nil {
+		return fmt.Errorf("live server: %w", err)
+	}
+	if err := conn.QueryRowContext(ctx, "SELECT @@server_uuid, DATABASE()").Scan(&scratchServer, &scratchName); err != nil {
+		return fmt.Errorf("scratch server: %w", err)
+	}
+	if liveServer.String == scratchServer.String && strings.EqualFold(liveName.String, scratchName.String) {
+		return fmt.Errorf("'SDS_SCHEMA_SCRATCH_DSN' is the live database, the scratch database is required")
+	}
+	return nil
+}
+
+// dropTables drops all tables of the scratch database, including the migration version table.
+// If the database has the table that the migrations don't create, then nothing is dropped,
+// since the database is not the scratch database.
+func dropTables(conn *sql.Conn, name string) error {
+	ctx := context.Background()
+	allowed, err := migrationTables()
+	if err != nil {
+		return err
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = ?", name)
+	if err != nil {
+		return fmt.Errorf("query tables: %w", err)
+	}
+	tables := make([]string, 0)
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("rows.Scan: %w", err)
+		}
+		if !allowed[table] {
+			_ = rows.Close()
+			return fmt.Errorf("the '%s' table is not created by the migrations, '%s' is not the scratch database", table, name)
+		}
+		tables = append(tables, "`"+table+"`")
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows.Err: %w", err)
+	}
+	if len(tables) == 0 {
+		return nil
+	}
+
+	if _, err := conn.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS = 0"); err != nil {
+		return fmt.Errorf("disable foreign keys: %w", err)
+	}
+	defer func() {
+		_, _ = conn.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS = 1")
+	}()
+	if _, err := conn.ExecContext(ctx, "DROP TABLE "+strings.Join(tables, ", ")); err != nil {
+		return fmt.Errorf("drop tables: %w", err)
+	}
+	return nil
+}
+
+// schemaDiff returns the differences between the live schema and the embedded migrations.
+// The migration version table is not compared.
+func (database *Database) schemaDiff() ([]schema.Difference, error) {
+	expected, err := database.expectedSchema()
+	if err != nil {
+		return nil, fmt.Errorf("expectedSchema: %w", err)
+	}
+
+	actual, err := schema.Load(database.Connection, database.parameters.name)
+	if err != nil {
+		return nil, fmt.Errorf("schema.Load: %w", err)
+	}
+
+	return schema.Diff(expected, actual, goose.TableName()), nil
+}
+
+// checkSchema compares the live schema against the migrations on startup.
+//
+// In the warn mode, the differences and the failed check are logged.
+// In the strict mode, returns an error if the check failed or the schema drifted.
+func (database *Database) checkSchema(mode string) error {
+	switch mode {
+	case SchemaCheckNone:
+		return nil
+	case SchemaCheckWarn, SchemaCheckStrict:
+	default:
+		return fmt.Errorf("unsupported 'SDS_SCHEMA_CHECK' %s, expected '%s', '%s' or '%s'", mode, SchemaCheckNone, SchemaCheckWarn, SchemaCheckStrict)
+	}
+
+	differences, err := database.schemaDiff()
+	if err != nil {
+		if mode == SchemaCheckStrict {
+			return fmt.Errorf("schemaDiff: %w", err)
+		}
+		database.logger.Warn("failed to check the schema drift", "error", err)
+		return nil
+	}
+
+	for _, difference := range differences {
+		database.logger.Warn("schema drift", "difference", difference.String())
+	}
+	if len(differences) > 0 && mode == SchemaCheckStrict {
+		return fmt.Errorf("the live schema differs from the migrations in %d places", len(differences))
+	}
+
+	return nil
+}
+
+// returns the differences between the live schema and the migrations
+var onSchemaDiff = func(_ message.Request, _ log.Logger, _ remote.Clients) message.Reply {
+	if db == nil || db.Connection == nil {
+		return message.Fail("database.Connection is nil, please open the connection first")
+	}
+
+	differences, err := db.schemaDiff()
+	if err != nil {
+		return message.Fail("schemaDiff: " + err.Error())
+	}
+
+	reply := handler.SchemaDiffReply{
+		Drift:       len(differences) > 0,
+		Differences: differences,
+	}
+	replyMessage, err := command.Reply(&reply)
+	if err != nil {
+		return message.Fail("command.Reply: " + err.Error())
+	}
+
+	return replyMessage
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/pressly/goose/v3"
+	"github.com/stretchr/testify/suite"
+)
+
+// Define the suite, and absorb the built-in basic suite
+// functionality from testify - including a T() method which
+// returns the current testing context
+type TestSchemaCheckSuite struct {
+	suite.Suite
+}
+
+func (suite *TestSchemaCheckSuite) TestMigrationTables() {
+	tables, err := migrationTables()
+	suite.Require().NoError(err)
+	for _, table := range []string{goose.TableName(), "abi", "smartcontract", "configuration", "indexer_event", "outbox", "queue_job", "audit_log"} {
+		suite.Require().True(tables[table], table)
+	}
+	// the database with the other tables is not the scratch database
+	suite.Require().False(tables["secret_table"])
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestSchemaCheck(t *testing.T) {
+	suite.Run(t, new(TestSchemaCheckSuite))
+}
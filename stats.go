@@ -0,0 +1,171 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Seascape-Foundation/mysql-seascape-extension/handler"
+	"github.com/Seascape-Foundation/mysql-seascape-extension/trace"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/command"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/message"
+	"github.com/Seascape-Foundation/sds-service-lib/log"
+	"github.com/Seascape-Foundation/sds-service-lib/remote"
+)
+
+// statsLimit is the maximum amount of the fingerprints in the statistics.
+// The raw Where clauses produce the unique fingerprints, so the least called one is evicted.
+const statsLimit = 1000
+
+// queryStats keeps the in-memory statistics of the executed queries
+// grouped by their fingerprints. Similar to the pg_stat_statements of Postgres.
+type queryStats struct {
+	mutex sync.Mutex
+	stats map[string]*handler.QueryStat
+}
+
+// statement is the single execution of the query built by the handler builders.
+type statement struct {
+	query  string
+	tables []string
+	start  time.Time
+	span   *trace.Span
+}
+
+func newQueryStats() *queryStats {
+	return &queryStats{
+		stats: make(map[string]*handler.QueryStat),
+	}
+}
+
+// add the execution to the statistics of the fingerprint
+func (s *queryStats) add(fingerprint string, tables []string, duration time.Duration, rows int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stat, ok := s.stats[fingerprint]
+	if !ok {
+		if len(s.stats) >= statsLimit {
+			s.evict()
+		}
+		stat = &handler.QueryStat{
+			Fingerprint: fingerprint,
+			Tables:      tables,
+		}
+		s.stats[fingerprint] = stat
+	}
+
+	milliseconds := float64(duration) / float64(time.Millisecond)
+	stat.Calls++
+	if rows > 0 {
+		stat.Rows += uint64(rows)
+	}
+	stat.TotalTime += milliseconds
+	stat.AverageTime = stat.TotalTime / float64(stat.Calls)
+	if milliseconds > stat.MaxTime {
+		stat.MaxTime = milliseconds
+	}
+}
+
+// evict removes the least called fingerprint
+func (s *queryStats) evict() {
+	var least *handler.QueryStat
+	for _, stat := range s.stats {
+		if least == nil || stat.Calls < least.Calls {
+			least = stat
+		}
+	}
+	if least != nil {
+		delete(s.stats, least.Fingerprint)
+	}
+}
+
+// list returns the copy of the statistics sorted by the total time.
+// If reset is true, then the statistics are cleared.
+func (s *queryStats) list(reset bool) []handler.QueryStat {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	list := make([]handler.QueryStat, 0, len(s.stats))
+	for _, stat := range s.stats {
+		list = append(list, *stat)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].TotalTime > list[j].TotalTime
+	})
+
+	if reset {
+		s.stats = make(map[string]*handler.QueryStat)
+	}
+
+	return list
+}
+
+// newStatement starts measuring the query execution.
+// The statement span is the child of the command span passed in the request parameters.
+func (database *Database) newStatement(query string, request handler.DatabaseQueryRequest) *statement {
+	s := &statement{
+		query:  query,
+		tables: request.Tables,
+		start:  time.Now(),
+	}
+	database.startSpan(s, request.TraceParent)
+
+	return s
+}
+
+// done records the successfully executed statement in the statistics.
+// If the statement took longer than the slow query threshold, then it's logged.
+//
+// The rows is the amount of returned rows for reading and affected rows for writing.
+func (database *Database) done(s *statement, rows int64) {
+	duration := time.Since(s.start)
+	fingerprint := handler.Fingerprint(s.query)
+
+	database.stats.add(fingerprint, s.tables, duration, rows)
+
+	s.span.SetAttribute("statement", fingerprint)
+	s.span.SetAttribute("rows", rows)
+	s.span.End()
+
+	if database.parameters.slowQuery > 0 && duration > database.parameters.slowQuery {
+		database.logger.Warn("slow query",
+			"fingerprint", fingerprint,
+			"tables", s.tables,
+			"duration", duration,
+			"rows", rows,
+		)
+	}
+}
+
+// failed finishes the statement that returned an error.
+// The failed statements are not included in the statistics.
+func (database *Database) failed(s *statement, err error) {
+	s.span.SetAttribute("statement", handler.Fingerprint(s.query))
+	s.span.SetAttribute("error_code", errorCode(err))
+	s.span.SetError(err.Error())
+	s.span.End()
+}
+
+// returns the aggregated statistics of the executed queries
+var onQueryStats = func(request message.Request, _ log.Logger, _ remote.Clients) message.Reply {
+	if db == nil {
+		return message.Fail("database is nil, please open the connection first")
+	}
+
+	var parameters handler.QueryStatsRequest
+	err := request.Parameters.Interface(&parameters)
+	if err != nil {
+		return message.Fail("parameter validation:" + err.Error())
+	}
+
+	reply := handler.QueryStatsReply{
+		Stats: db.stats.list(parameters.Reset),
+	}
+	replyMessage, err := command.Reply(&reply)
+	if err != nil {
+		return message.Fail("command.Reply: " + err.Error())
+	}
+
+	return replyMessage
+}
@@ -0,0 +1,8 @@
+// Package tables has the row structs, the table and column names of the database.
+// The tables_gen.go is generated by sds-codegen from the migrations.
+// Update it after adding the migration:
+//
+//	SDS_CODEGEN_DSN="root:tiger@tcp(localhost:3306)/" go generate ./tables
+package tables
+
+//go:generate go run ../cmd/sds-codegen -migrations ../_db/migrations -package tables -out tables_gen.go
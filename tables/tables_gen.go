@@ -0,0 +1,311 @@
+// Code generated by sds-codegen from ../_db/migrations. DO NOT EDIT.
+
+package tables
+
+import (
+	"encoding/json"
+
+	"github.com/Seascape-Foundation/mysql-seascape-extension/client"
+)
+
+// AbiTable is the name of the abi table
+const AbiTable = "abi"
+
+// The columns of the abi table
+const (
+	AbiColumnAbiId = "abi_id"
+	AbiColumnBody  = "body"
+)
+
+// AbiColumns lists all columns of the abi table
+var AbiColumns = []string{
+	AbiColumnAbiId,
+	AbiColumnBody,
+}
+
+// Abi is the row of the abi table
+type Abi struct {
+	AbiId string          `db:"abi_id"`
+	Body  json.RawMessage `db:"body"`
+}
+
+// AbiQuery starts the query on the abi table
+func AbiQuery() *client.Query {
+	return client.Table(AbiTable)
+}
+
+// SelectAbi returns the rows of the abi table matching the query
+func SelectAbi(c *client.Client, q *client.Query) ([]Abi, error) {
+	var rows []Abi
+	if err := c.Select(q.Fields(AbiColumns...), &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// SelectOneAbi returns the first row of the abi table matching the query
+func SelectOneAbi(c *client.Client, q *client.Query) (*Abi, error) {
+	var row Abi
+	if err := c.SelectOne(q.Fields(AbiColumns...), &row); err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// InsertAbi inserts the row into the abi table
+func InsertAbi(c *client.Client, row *Abi) error {
+	return c.Insert(AbiQuery().Values(row))
+}
+
+// ConfigurationTable is the name of the configuration table
+const ConfigurationTable = "configuration"
+
+// The columns of the configuration table
+const (
+	ConfigurationColumnNetworkId         = "network_id"
+	ConfigurationColumnAddress           = "address"
+	ConfigurationColumnOrganization      = "organization"
+	ConfigurationColumnProject           = "project"
+	ConfigurationColumnGroupName         = "group_name"
+	ConfigurationColumnSmartcontractName = "smartcontract_name"
+)
+
+// ConfigurationColumns lists all columns of the configuration table
+var ConfigurationColumns = []string{
+	ConfigurationColumnNetworkId,
+	ConfigurationColumnAddress,
+	ConfigurationColumnOrganization,
+	ConfigurationColumnProject,
+	ConfigurationColumnGroupName,
+	ConfigurationColumnSmartcontractName,
+}
+
+// Configuration is the row of the configuration table
+type Configuration struct {
+	NetworkId         string `db:"network_id"`
+	Address           string `db:"address"`
+	Organization      string `db:"organization"`
+	Project           string `db:"project"`
+	GroupName         string `db:"group_name"`
+	SmartcontractName string `db:"smartcontract_name"`
+}
+
+// ConfigurationQuery starts the query on the configuration table
+func ConfigurationQuery() *client.Query {
+	return client.Table(ConfigurationTable)
+}
+
+// SelectConfiguration returns the rows of the configuration table matching the query
+func SelectConfiguration(c *client.Client, q *client.Query) ([]Configuration, error) {
+	var rows []Configuration
+	if err := c.Select(q.Fields(ConfigurationColumns...), &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// SelectOneConfiguration returns the first row of the configuration table matching the query
+func SelectOneConfiguration(c *client.Client, q *client.Query) (*Configuration, error) {
+	var row Configuration
+	if err := c.SelectOne(q.Fields(ConfigurationColumns...), &row); err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// InsertConfiguration inserts the row into the configuration table
+func InsertConfiguration(c *client.Client, row *Configuration) error {
+	return c.Insert(ConfigurationQuery().Values(row))
+}
+
+// IndexerEventTable is the name of the indexer_event table
+const IndexerEventTable = "indexer_event"
+
+// The columns of the indexer_event table
+const (
+	IndexerEventColumnNetworkId        = "network_id"
+	IndexerEventColumnAddress          = "address"
+	IndexerEventColumnTransactionId    = "transaction_id"
+	IndexerEventColumnTransactionIndex = "transaction_index"
+	IndexerEventColumnBlockNumber      = "block_number"
+	IndexerEventColumnBlockTimestamp   = "block_timestamp"
+	IndexerEventColumnLogIndex         = "log_index"
+	IndexerEventColumnEventName        = "event_name"
+	IndexerEventColumnEventParameters  = "event_parameters"
+)
+
+// IndexerEventColumns lists all columns of the indexer_event table
+var IndexerEventColumns = []string{
+	IndexerEventColumnNetworkId,
+	IndexerEventColumnAddress,
+	IndexerEventColumnTransactionId,
+	IndexerEventColumnTransactionIndex,
+	IndexerEventColumnBlockNumber,
+	IndexerEventColumnBlockTimestamp,
+	IndexerEventColumnLogIndex,
+	IndexerEventColumnEventName,
+	IndexerEventColumnEventParameters,
+}
+
+// IndexerEvent is the row of the indexer_event table
+type IndexerEvent struct {
+	NetworkId        string          `db:"network_id"`
+	Address          string          `db:"address"`
+	TransactionId    string          `db:"transaction_id"`
+	TransactionIndex uint16          `db:"transaction_index"`
+	BlockNumber      *uint64         `db:"block_number"`
+	BlockTimestamp   *uint64         `db:"block_timestamp"`
+	LogIndex         uint16          `db:"log_index"`
+	EventName        string          `db:"event_name"`
+	EventParameters  json.RawMessage `db:"event_parameters"`
+}
+
+// IndexerEventQuery starts the query on the indexer_event table
+func IndexerEventQuery() *client.Query {
+	return client.Table(IndexerEventTable)
+}
+
+// SelectIndexerEvent returns the rows of the indexer_event table matching the query
+func SelectIndexerEvent(c *client.Client, q *client.Query) ([]IndexerEvent, error) {
+	var rows []IndexerEvent
+	if err := c.Select(q.Fields(IndexerEventColumns...), &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// SelectOneIndexerEvent returns the first row of the indexer_event table matching the query
+func SelectOneIndexerEvent(c *client.Client, q *client.Query) (*IndexerEvent, error) {
+	var row IndexerEvent
+	if err := c.SelectOne(q.Fields(IndexerEventColumns...), &row); err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// InsertIndexerEvent inserts the row into the indexer_event table
+func InsertIndexerEvent(c *client.Client, row *IndexerEvent) error {
+	return c.Insert(IndexerEventQuery().Values(row))
+}
+
+// IndexerSmartcontractTable is the name of the indexer_smartcontract table
+const IndexerSmartcontractTable = "indexer_smartcontract"
+
+// The columns of the indexer_smartcontract table
+const (
+	IndexerSmartcontractColumnNetworkId      = "network_id"
+	IndexerSmartcontractColumnAddress        = "address"
+	IndexerSmartcontractColumnBlockNumber    = "block_number"
+	IndexerSmartcontractColumnBlockTimestamp = "block_timestamp"
+)
+
+// IndexerSmartcontractColumns lists all columns of the indexer_smartcontract table
+var IndexerSmartcontractColumns = []string{
+	IndexerSmartcontractColumnNetworkId,
+	IndexerSmartcontractColumnAddress,
+	IndexerSmartcontractColumnBlockNumber,
+	IndexerSmartcontractColumnBlockTimestamp,
+}
+
+// IndexerSmartcontract is the row of the indexer_smartcontract table
+type IndexerSmartcontract struct {
+	NetworkId      string  `db:"network_id"`
+	Address        string  `db:"address"`
+	BlockNumber    *uint64 `db:"block_number"`
+	BlockTimestamp *uint64 `db:"block_timestamp"`
+}
+
+// IndexerSmartcontractQuery starts the query on the indexer_smartcontract table
+func IndexerSmartcontractQuery() *client.Query {
+	return client.Table(IndexerSmartcontractTable)
+}
+
+// SelectIndexerSmartcontract returns the rows of the indexer_smartcontract table matching the query
+func SelectIndexerSmartcontract(c *client.Client, q *client.Query) ([]IndexerSmartcontract, error) {
+	var rows []IndexerSmartcontract
+	if err := c.Select(q.Fields(IndexerSmartcontractColumns...), &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// SelectOneIndexerSmartcontract returns the first row of the indexer_smartcontract table matching the query
+func SelectOneIndexerSmartcontract(c *client.Client, q *client.Query) (*IndexerSmartcontract, error) {
+	var row IndexerSmartcontract
+	if err := c.SelectOne(q.Fields(IndexerSmartcontractColumns...), &row); err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// InsertIndexerSmartcontract inserts the row into the indexer_smartcontract table
+func InsertIndexerSmartcontract(c *client.Client, row *IndexerSmartcontract) error {
+	return c.Insert(IndexerSmartcontractQuery().Values(row))
+}
+
+// SmartcontractTable is the name of the smartcontract table
+const SmartcontractTable = "smartcontract"
+
+// The columns of the smartcontract table
+const (
+	SmartcontractColumnNetworkId        = "network_id"
+	SmartcontractColumnAddress          = "address"
+	SmartcontractColumnAbiId            = "abi_id"
+	SmartcontractColumnTransactionId    = "transaction_id"
+	SmartcontractColumnTransactionIndex = "transaction_index"
+	SmartcontractColumnDeployer         = "deployer"
+	SmartcontractColumnBlockNumber      = "block_number"
+	SmartcontractColumnBlockTimestamp   = "block_timestamp"
+)
+
+// SmartcontractColumns lists all columns of the smartcontract table
+var SmartcontractColumns = []string{
+	SmartcontractColumnNetworkId,
+	SmartcontractColumnAddress,
+	SmartcontractColumnAbiId,
+	SmartcontractColumnTransactionId,
+	SmartcontractColumnTransactionIndex,
+	SmartcontractColumnDeployer,
+	SmartcontractColumnBlockNumber,
+	SmartcontractColumnBlockTimestamp,
+}
+
+// Smartcontract is the row of the smartcontract table
+type Smartcontract struct {
+	NetworkId        string  `db:"network_id"`
+	Address          string  `db:"address"`
+	AbiId            string  `db:"abi_id"`
+	TransactionId    string  `db:"transaction_id"`
+	TransactionIndex *uint16 `db:"transaction_index"`
+	Deployer         string  `db:"deployer"`
+	BlockNumber      uint64  `db:"block_number"`
+	BlockTimestamp   uint64  `db:"block_timestamp"`
+}
+
+// SmartcontractQuery starts the query on the smartcontract table
+func SmartcontractQuery() *client.Query {
+	return client.Table(SmartcontractTable)
+}
+
+// SelectSmartcontract returns the rows of the smartcontract table matching the query
+func SelectSmartcontract(c *client.Client, q *client.Query) ([]Smartcontract, error) {
+	var rows []Smartcontract
+	if err := c.Select(q.Fields(SmartcontractColumns...), &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// SelectOneSmartcontract returns the first row of the smartcontract table matching the query
+func SelectOneSmartcontract(c *client.Client, q *client.Query) (*Smartcontract, error) {
+	var row Smartcontract
+	if err := c.SelectOne(q.Fields(SmartcontractColumns...), &row); err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// InsertSmartcontract inserts the row into the smartcontract table
+func InsertSmartcontract(c *client.Client, row *Smartcontract) error {
+	return c.Insert(SmartcontractQuery().Values(row))
+}
@@ -0,0 +1,60 @@
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// WriterExporter writes the spans as JSON lines.
+// Intended for the local development.
+type WriterExporter struct {
+	mutex  sync.Mutex
+	writer io.Writer
+	closer io.Closer
+}
+
+// NewStdoutExporter writes the spans into the standard output
+func NewStdoutExporter() *WriterExporter {
+	return &WriterExporter{writer: os.Stdout}
+}
+
+// NewFileExporter appends the spans into the file.
+// The file is created if it doesn't exist.
+func NewFileExporter(path string) (*WriterExporter, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("os.OpenFile(%s): %w", path, err)
+	}
+
+	return &WriterExporter{writer: file, closer: file}, nil
+}
+
+// Export the span as a single JSON line
+func (exporter *WriterExporter) Export(span *Span) error {
+	span.mutex.Lock()
+	bytes, err := json.Marshal(span)
+	span.mutex.Unlock()
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+
+	exporter.mutex.Lock()
+	defer exporter.mutex.Unlock()
+
+	if _, err := exporter.writer.Write(append(bytes, '\n')); err != nil {
+		return fmt.Errorf("writer.Write: %w", err)
+	}
+
+	return nil
+}
+
+// Close the file. The standard output is not closed.
+func (exporter *WriterExporter) Close() error {
+	if exporter.closer == nil {
+		return nil
+	}
+	return exporter.closer.Close()
+}
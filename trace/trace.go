@@ -0,0 +1,167 @@
+// Package trace creates the spans of the database commands and statements.
+//
+// The spans are compatible with the W3C Trace Context, so the database extension
+// could be a part of the trace that started in another SDS service.
+// The trace context is passed in the request parameters as the "traceparent".
+//
+// The finished spans are given to the Exporter. The package provides
+// the WriterExporter that writes spans as JSON lines to the stdout or the file.
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ParentParameter is the name of the request parameter that keeps the trace context
+const ParentParameter = "traceparent"
+
+// Exporter sends the finished spans to the tracing backend
+type Exporter interface {
+	Export(span *Span) error
+	Close() error
+}
+
+// Context identifies the span within the trace.
+// The empty Context means that the span starts a new trace.
+type Context struct {
+	TraceId string
+	SpanId  string
+}
+
+// Span is the single operation within the trace
+type Span struct {
+	TraceId    string                 `json:"trace_id"`
+	SpanId     string                 `json:"span_id"`
+	ParentId   string                 `json:"parent_span_id,omitempty"`
+	Name       string                 `json:"name"`
+	StartTime  time.Time              `json:"start_time"`
+	EndTime    time.Time              `json:"end_time"`
+	Duration   float64                `json:"duration"` // milliseconds
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+
+	mutex  sync.Mutex
+	tracer *Tracer
+}
+
+// Tracer creates the spans and exports them once they are finished.
+// If the exporter is nil, then the spans are created but not exported.
+type Tracer struct {
+	exporter Exporter
+	onError  func(error)
+}
+
+// New tracer that exports the spans into the exporter.
+// The export errors are passed to the onError, since the tracing should never fail the request.
+func New(exporter Exporter, onError func(error)) *Tracer {
+	return &Tracer{
+		exporter: exporter,
+		onError:  onError,
+	}
+}
+
+// ParseTraceParent parses the W3C traceparent header:
+//
+//	00-<32 hex trace id>-<16 hex parent span id>-<2 hex flags>
+func ParseTraceParent(traceParent string) (Context, error) {
+	parts := strings.Split(traceParent, "-")
+	if len(parts) != 4 {
+		return Context{}, fmt.Errorf("traceparent '%s' should have 4 parts", traceParent)
+	}
+	if len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return Context{}, fmt.Errorf("traceparent '%s' parts have invalid length", traceParent)
+	}
+	for _, part := range parts {
+		if _, err := hex.DecodeString(part); err != nil {
+			return Context{}, fmt.Errorf("traceparent '%s' is not hex: %w", traceParent, err)
+		}
+	}
+	if parts[1] == strings.Repeat("0", 32) || parts[2] == strings.Repeat("0", 16) {
+		return Context{}, fmt.Errorf("traceparent '%s' has zero ids", traceParent)
+	}
+
+	return Context{TraceId: parts[1], SpanId: parts[2]}, nil
+}
+
+// Start a new span. If the parent context is empty, then the span starts a new trace.
+func (tracer *Tracer) Start(name string, parent Context) *Span {
+	span := &Span{
+		TraceId:    parent.TraceId,
+		SpanId:     randomId(8),
+		ParentId:   parent.SpanId,
+		Name:       name,
+		StartTime:  time.Now(),
+		Attributes: make(map[string]interface{}),
+		tracer:     tracer,
+	}
+	if len(span.TraceId) == 0 {
+		span.TraceId = randomId(16)
+	}
+
+	return span
+}
+
+// Close the exporter
+func (tracer *Tracer) Close() error {
+	if tracer.exporter == nil {
+		return nil
+	}
+	return tracer.exporter.Close()
+}
+
+// Context of the span to start the child spans
+func (span *Span) Context() Context {
+	return Context{TraceId: span.TraceId, SpanId: span.SpanId}
+}
+
+// TraceParent returns the span context in W3C traceparent format.
+// It's passed to the child operations.
+func (span *Span) TraceParent() string {
+	return "00-" + span.TraceId + "-" + span.SpanId + "-01"
+}
+
+// Child starts a new span within this span
+func (span *Span) Child(name string) *Span {
+	return span.tracer.Start(name, span.Context())
+}
+
+// SetAttribute of the span
+func (span *Span) SetAttribute(name string, value interface{}) {
+	span.mutex.Lock()
+	span.Attributes[name] = value
+	span.mutex.Unlock()
+}
+
+// SetError marks the span as failed
+func (span *Span) SetError(message string) {
+	span.mutex.Lock()
+	span.Error = message
+	span.mutex.Unlock()
+}
+
+// End the span and export it
+func (span *Span) End() {
+	span.mutex.Lock()
+	span.EndTime = time.Now()
+	span.Duration = float64(span.EndTime.Sub(span.StartTime)) / float64(time.Millisecond)
+	span.mutex.Unlock()
+
+	if span.tracer.exporter == nil {
+		return
+	}
+	if err := span.tracer.exporter.Export(span); err != nil && span.tracer.onError != nil {
+		span.tracer.onError(fmt.Errorf("exporter.Export: %w", err))
+	}
+}
+
+// randomId returns the random hex string of the given bytes length
+func randomId(length int) string {
+	bytes := make([]byte, length)
+	_, _ = rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
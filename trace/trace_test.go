@@ -0,0 +1,63 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// Define the suite, and absorb the built-in basic suite
+// functionality from testify - including a T() method which
+// returns the current testing context
+type TestTraceSuite struct {
+	suite.Suite
+}
+
+func (suite *TestTraceSuite) TestParseTraceParent() {
+	traceParent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	parent, err := ParseTraceParent(traceParent)
+	suite.Require().NoError(err)
+	suite.Require().Equal("4bf92f3577b34da6a3ce929d0e0e4736", parent.TraceId)
+	suite.Require().Equal("00f067aa0ba902b7", parent.SpanId)
+
+	_, err = ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7")
+	suite.Require().Error(err)
+	_, err = ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01")
+	suite.Require().Error(err)
+	_, err = ParseTraceParent("00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+	suite.Require().Error(err)
+}
+
+func (suite *TestTraceSuite) TestChildSpan() {
+	var buffer bytes.Buffer
+	tracer := New(&WriterExporter{writer: &buffer}, nil)
+
+	parent, err := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	suite.Require().NoError(err)
+
+	span := tracer.Start("select", parent)
+	child := span.Child("statement")
+	child.SetAttribute("rows", 2)
+	child.End()
+	span.End()
+
+	suite.Require().Equal(parent.TraceId, child.TraceId)
+	suite.Require().Equal(span.SpanId, child.ParentId)
+	suite.Require().Equal(parent.SpanId, span.ParentId)
+
+	lines := bytes.Split(bytes.TrimSpace(buffer.Bytes()), []byte("\n"))
+	suite.Require().Len(lines, 2)
+
+	var exported Span
+	suite.Require().NoError(json.Unmarshal(lines[0], &exported))
+	suite.Require().Equal("statement", exported.Name)
+	suite.Require().EqualValues(2, exported.Attributes["rows"])
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestTrace(t *testing.T) {
+	suite.Run(t, new(TestTraceSuite))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Seascape-Foundation/mysql-seascape-extension/trace"
+	"github.com/Seascape-Foundation/sds-common-lib/data_type/key_value"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/command"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/message"
+	"github.com/Seascape-Foundation/sds-service-lib/configuration"
+	"github.com/Seascape-Foundation/sds-service-lib/log"
+	"github.com/Seascape-Foundation/sds-service-lib/remote"
+	"github.com/go-sql-driver/mysql"
+)
+
+// TraceConfigurations The configuration parameters of the tracing.
+//
+// SDS_TRACE_EXPORTER is one of: "none", "stdout" or "file".
+// For the "file" exporter, the spans are appended to SDS_TRACE_FILE.
+var TraceConfigurations = configuration.DefaultConfig{
+	Title: "Trace",
+	Parameters: key_value.New(map[string]interface{}{
+		"SDS_TRACE_EXPORTER": "none",
+		"SDS_TRACE_FILE":     "./traces.jsonl",
+	}),
+}
+
+// newTracer returns the tracer with the exporter set in the configuration
+func newTracer(appConfig *configuration.Config, logger log.Logger) (*trace.Tracer, error) {
+	onError := func(err error) {
+		logger.Warn("failed to export the span", "error", err)
+	}
+
+	exporterType := appConfig.GetString("SDS_TRACE_EXPORTER")
+	switch exporterType {
+	case "none", "":
+		return trace.New(nil, onError), nil
+	case "stdout":
+		return trace.New(trace.NewStdoutExporter(), onError), nil
+	case "file":
+		exporter, err := trace.NewFileExporter(appConfig.GetString("SDS_TRACE_FILE"))
+		if err != nil {
+			return nil, fmt.Errorf("trace.NewFileExporter: %w", err)
+		}
+		return trace.New(exporter, onError), nil
+	}
+
+	return nil, fmt.Errorf("unsupported 'SDS_TRACE_EXPORTER' %s, expected 'none', 'stdout' or 'file'", exporterType)
+}
+
+// traced wraps the command handler into the span.
+//
+// If the request parameters have the trace context, then the span continues the caller's trace.
+// The command span's context replaces the trace context in the request parameters,
+// so the statements executed by the handler become the children of the command span.
+func (database *Database) traced(name command.Name, handle command.HandleFunc) command.HandleFunc {
+	return func(request message.Request, logger log.Logger, clients remote.Clients) message.Reply {
+		if request.Parameters == nil {
+			request.Parameters = key_value.Empty()
+		}
+
+		parent := trace.Context{}
+		traceParent, err := request.Parameters.GetString(trace.ParentParameter)
+		if err == nil {
+			parent, err = trace.ParseTraceParent(traceParent)
+			if err != nil {
+				logger.Warn("invalid trace context, starting a new trace", "error", err)
+			}
+		}
+
+		span := database.tracer.Start(name.String(), parent)
+		span.SetAttribute("command", name.String())
+		if tables, err := request.Parameters.GetStringList("tables"); err == nil {
+			span.SetAttribute("tables", tables)
+		}
+		request.Parameters.Set(trace.ParentParameter, span.TraceParent())
+
+		reply := handle(request, logger, clients)
+		if !reply.IsOK() {
+			span.SetError(reply.Message)
+		}
+		span.End()
+
+		return reply
+	}
+}
+
+// startSpan starts the span of the statement as the child of the command span.
+func (database *Database) startSpan(s *statement, traceParent string) {
+	parent, err := trace.ParseTraceParent(traceParent)
+	if err != nil {
+		parent = trace.Context{}
+	}
+
+	s.span = database.tracer.Start("statement", parent)
+	s.span.SetAttribute("tables", s.tables)
+}
+
+// errorCode returns the mysql error number.
+// If the error is not returned by mysql, then returns 0.
+func errorCode(err error) uint16 {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number
+	}
+
+	return 0
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Seascape-Foundation/mysql-seascape-extension/handler"
+	"github.com/Seascape-Foundation/sds-common-lib/data_type/key_value"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/command"
+	"github.com/Seascape-Foundation/sds-service-lib/communication/message"
+	"github.com/Seascape-Foundation/sds-service-lib/configuration"
+	"github.com/Seascape-Foundation/sds-service-lib/log"
+	"github.com/Seascape-Foundation/sds-service-lib/remote"
+)
+
+// TransactionConfigurations The configuration parameters of the transactions opened by the clients.
+//
+// The transaction that is not used for SDS_TRANSACTION_TIMEOUT seconds is rolled back.
+// SDS_TRANSACTION_LIMIT is the maximum amount of the open transactions.
+var TransactionConfigurations = configuration.DefaultConfig{
+	Title: "Transaction",
+	Parameters: key_value.New(map[string]interface{}{
+		"SDS_TRANSACTION_TIMEOUT": uint64(30),
+		"SDS_TRANSACTION_LIMIT":   uint64(64),
+	}),
+}
+
+// executor is implemented by sql.DB and sql.Tx
+type executor interface {
+	execer
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// transaction opened by the client service
+type transaction struct {
+	tx      *sql.Tx
+	service string // only the service that opened the transaction can use it
+	timer   *time.Timer
+	hooks   []func() // called after the transaction is committed
+	ended   []func() // called after the transaction is committed, rolled back or expired
+
+	uses       int    // the amount of the running statements, the transaction doesn't expire while it's used
+	generation uint64 // increased on each release, the timer of the previous release doesn't expire it
+}
+
+// transactions keeps the open transactions by their id
+type transactions struct {
+	mutex   sync.Mutex
+	list    map[string]*transaction
+	timeout time.Duration
+	limit   int
+	logger  log.Logger
+}
+
+func newTransactions(timeout time.Duration, limit int, logger log.Logger) *transactions {
+	return &transactions{
+		list:    make(map[string]*transaction),
+		timeout: timeout,
+		limit:   limit,
+		logger:  logger,
+	}
+}
+
+// newTransactionsFromConfig returns the transactions with the limits set in the configuration
+func newTransactionsFromConfig(appConfig *configuration.Config, logger log.Logger) (*transactions, error) {
+	timeout := appConfig.GetUint64("SDS_TRANSACTION_TIMEOUT")
+	if timeout > TimeoutCap {
+		return nil, fmt.Errorf("'SDS_TRANSACTION_TIMEOUT' can not be greater than %d (seconds)", TimeoutCap)
+	} else if timeout == 0 {
+		return nil, errors.New("the 'SDS_TRANSACTION_TIMEOUT' can not be zero")
+	}
+	limit := appConfig.GetUint64("SDS_TRANSACTION_LIMIT")
+	if limit == 0 {
+		return nil, errors.New("the 'SDS_TRANSACTION_LIMIT' can not be zero")
+	}
+
+	return newTransactions(time.Duration(timeout)*time.Second, int(limit), logger), nil
+}
+
+// begin starts the transaction for the service, returns its id
+func (t *transactions) begin(connection *sql.DB, service string) (string, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if len(t.list) >= t.limit {
+		return "", fmt.Errorf("too many open transactions, the limit is %d", t.limit)
+	}
+
+	id, err := randomId()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := connection.Begin()
+	if err != nil {
+		return "", fmt.Errorf("connection.Begin: %w", err)
+	}
+	t.list[id] = &transaction{
+		tx:      tx,
+		service: service,
+		timer: time.AfterFunc(t.timeout, func() {
+			t.expire(id, 0)
+		}),
+	}
+
+	return id, nil
+}
+
+// randomId returns the random hex id of the transaction or the job
+func randomId() (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("rand.Read: %w", err)
+	}
+	return hex.EncodeToString(random), nil
+}
+
+// get returns the transaction of the service and the function that releases it.
+// The timeout is stopped while the transaction is used,
+// and restarted when the last use is released, so the long statement doesn't expire it.
+//
+// The timer of the previous release could fire meanwhile, but it doesn't expire the transaction,
+// since the generation was changed.
+func (t *transactions) get(id string, service string) (*sql.Tx, func(), error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	opened, ok := t.list[id]
+	if !ok || opened.service != service {
+		return nil, nil, fmt.Errorf("transaction '%s' not found, it was finished or expired", id)
+	}
+	opened.timer.Stop()
+	opened.generation++
+	opened.uses++
+
+	released := false
+	release := func() {
+		if !released {
+			released = true
+			t.release(id, opened)
+		}
+	}
+	return opened.tx, release, nil
+}
+
+// release restarts the timeout of the transaction, if it's not used anymore
+func (t *transactions) release(id string, opened *transaction) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	opened.uses--
+	if opened.uses > 0 || t.list[id] != opened {
+		return
+	}
+	opened.generation++
+	generation := opened.generation
+	opened.timer = time.AfterFunc(t.timeout, func() {
+		t.expire(id, generation)
+	})
+}
+
+// afterCommit adds the hook that is called after the transaction of the service is committed.
+// The hooks are dropped if the transaction is rolled back or expired.
+func (t *transactions) afterCommit(id string, service string, hook func()) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	opened, ok := t.list[id]
+	if !ok || opened.service != service {
+		return fmt.Errorf("transaction '%s' not found, it was finished or expired", id)
+	}
+	opened.hooks = append(opened.hooks, hook)
+
+	return nil
+}
+
+// afterEnd adds the hook that is called after the transaction of the service is committed, rolled back or expired.
+// Unlike afterCommit, the hook is called even if the commit failed.
+func (t *transactions) afterEnd(id string, service string, hook func()) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	opened, ok := t.list[id]
+	if !ok || opened.service != service {
+		return fmt.Errorf("transaction '%s' not found, it was finished or expired", id)
+	}
+	opened.ended = append(opened.ended, hook)
+
+	return nil
+}
+
+// end commits or rolls back the transaction of the service
+func (t *transactions) end(id string, service string, commit bool) error {
+	t.mutex.Lock()
+	opened, ok := t.list[id]
+	if !ok || opened.service != service {
+		t.mutex.Unlock()
+		return fmt.Errorf("transaction '%s' not found, it was finished or expired", id)
+	}
+	delete(t.list, id)
+	t.mutex.Unlock()
+
+	opened.timer.Stop()
+	defer opened.finish()
+	if commit {
+		if err := opened.tx.Commit(); err != nil {
+			return fmt.Errorf("tx.Commit: %w", err)
+		}
+		for _, hook := range opened.hooks {
+			hook()
+		}
+		return nil
+	}
+	if err := opened.tx.Rollback(); err != nil {
+		return fmt.Errorf("tx.Rollback: %w", err)
+	}
+	return nil
+}
+
+// expire rolls back the transaction that was not used within the timeout.
+// The transaction is kept, if it's used or it was used after the timer of the generation started.
+func (t *transactions) expire(id string, generation uint64) {
+	t.mutex.Lock()
+	opened, ok := t.list[id]
+	if ok && (opened.generation != generation || opened.uses > 0) {
+		ok = false
+	}
+	if ok {
+		delete(t.list, id)
+	}
+	t.mutex.Unlock()
+	if !ok {
+		return
+	}
+
+	t.logger.Warn("transaction expired, rolling back", "transaction_id", id, "service", opened.service, "timeout", t.timeout)
+	if err := opened.tx.Rollback(); err != nil {
+		t.logger.Warn("failed to roll back the expired transaction", "transaction_id", id, "error", err)
+	}
+	opened.finish()
+}
+
+// finish calls the hooks of the ended transaction
+func (opened *transaction) finish() {
+	for _, hook := range opened.ended {
+		hook()
+	}
+}
+
+// executor returns the transaction if the request is a part of it.
+// Otherwise, returns the database connection.
+// The returned function releases the transaction, call it after the rows are closed.
+func (database *Database) executor(request message.Request, transactionId string) (executor, func(), error) {
+	if len(transactionId) == 0 {
+		return database.Connection, func() {}, nil
+	}
+
+	tx, release, err := database.transactions.get(transactionId, identity(request))
+	if err != nil {
+		return nil, nil, err
+	}
+	return tx, release, nil
+}
+
+// starts the transaction
+var onTxBegin = func(request message.Request, _ log.Logger, _ remote.Clients) message.Reply {
+	if db == nil || db.Connection == nil {
+		return message.Fail("database.Connection is nil, please open the connection first")
+	}
+
+	id, err := db.transactions.begin(db.Connection, identity(request))
+	if err != nil {
+		return message.Fail("transactions.begin: " + err.Error())
+	}
+
+	reply := handler.TxBeginReply{
+		TransactionId: id,
+	}
+	replyMessage, err := command.Reply(&reply)
+	if err != nil {
+		return message.Fail("command.Reply: " + err.Error())
+	}
+
+	return replyMessage
+}
+
+// commits the transaction
+var onTxCommit = func(request message.Request, _ log.Logger, _ remote.Clients) message.Reply {
+	return endTransaction(request, true)
+}
+
+// rolls back the transaction
+var onTxRollback = func(request message.Request, _ log.Logger, _ remote.Clients) message.Reply {
+	return endTransaction(request, false)
+}
+
+// endTransaction commits or rolls back the transaction given in the request
+func endTransaction(request message.Request, commit bool) message.Reply {
+	if db == nil || db.Connection == nil {
+		return message.Fail("database.Connection is nil, please open the connection first")
+	}
+
+	var parameters handler.TxRequest
+	err := request.Parameters.Interface(&parameters)
+	if err != nil {
+		return message.Fail("parameter validation:" + err.Error())
+	}
+	if len(parameters.TransactionId) == 0 {
+		return message.Fail("parameter validation: missing transaction_id")
+	}
+
+	if err := db.transactions.end(parameters.TransactionId, identity(request), commit); err != nil {
+		return message.Fail("transactions.end: " + err.Error())
+	}
+
+	reply := handler.TxReply{}
+	replyMessage, err := command.Reply(&reply)
+	if err != nil {
+		return message.Fail("command.Reply: " + err.Error())
+	}
+
+	return replyMessage
+}